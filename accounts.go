@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var errConflict = errors.New("конфликт")
+
+// defaultAccountID — счёт, созданный миграцией 0002. К нему привязаны операции,
+// записанные до появления счетов, и новые операции без account_id в запросе.
+const defaultAccountID int64 = 1
+
+// Account — место хранения денег: наличные, карта или вклад.
+type Account struct {
+	ID       int64
+	Name     string
+	Kind     string
+	Currency string
+}
+
+var accountKinds = map[string]bool{
+	"cash":    true,
+	"card":    true,
+	"deposit": true,
+}
+
+func validateAccount(name, kind string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("название счёта пустое")
+	}
+	if !accountKinds[kind] {
+		return fmt.Errorf("неизвестный тип счёта %q (ожидается cash, card или deposit)", kind)
+	}
+	return nil
+}
+
+// CreateAccount заводит счёт в валюте currency (по умолчанию рубли).
+// Валюту счёта потом поменять нельзя: все суммы операций хранятся в ней.
+func (l *Ledger) CreateAccount(name, kind, currency string) (Account, error) {
+	if kind == "" {
+		kind = "cash"
+	}
+	if err := validateAccount(name, kind); err != nil {
+		return Account{}, err
+	}
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return Account{}, err
+	}
+	if currency == "" {
+		currency = baseCurrency
+	}
+	res, err := l.db.Exec("INSERT INTO accounts (name, kind, currency) VALUES (?, ?, ?)", name, kind, currency)
+	if err != nil {
+		return Account{}, fmt.Errorf("сохранение счёта: %w", err)
+	}
+	id, _ := res.LastInsertId()
+	return Account{ID: id, Name: name, Kind: kind, Currency: currency}, nil
+}
+
+func (l *Ledger) ListAccounts() ([]Account, error) {
+	rows, err := l.db.Query("SELECT id, name, kind, currency FROM accounts ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("чтение счетов: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Account
+	for rows.Next() {
+		var a Account
+		if err := rows.Scan(&a.ID, &a.Name, &a.Kind, &a.Currency); err != nil {
+			return nil, fmt.Errorf("scan account: %w", err)
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (l *Ledger) GetAccount(id int64) (Account, error) {
+	var a Account
+	err := l.db.QueryRow("SELECT id, name, kind, currency FROM accounts WHERE id = ?", id).Scan(&a.ID, &a.Name, &a.Kind, &a.Currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Account{}, fmt.Errorf("%w: счёт %d", errNotFound, id)
+		}
+		return Account{}, fmt.Errorf("чтение счёта: %w", err)
+	}
+	return a, nil
+}
+
+func (l *Ledger) UpdateAccount(id int64, name, kind string) (Account, error) {
+	if id == 0 {
+		return Account{}, errors.New("id счёта не указан")
+	}
+	if err := validateAccount(name, kind); err != nil {
+		return Account{}, err
+	}
+	res, err := l.db.Exec("UPDATE accounts SET name = ?, kind = ? WHERE id = ?", name, kind, id)
+	if err != nil {
+		return Account{}, fmt.Errorf("обновление счёта: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return Account{}, fmt.Errorf("%w: счёт %d", errNotFound, id)
+	}
+	return l.GetAccount(id)
+}
+
+// DeleteAccount удаляет счёт без операций. Счёт с историей удалить нельзя:
+// иначе пропадут остатки и расходы в сводке.
+func (l *Ledger) DeleteAccount(id int64) error {
+	if id == 0 {
+		return errors.New("id счёта не указан")
+	}
+	var cnt int
+	if err := l.db.QueryRow("SELECT COUNT(*) FROM transactions WHERE account_id = ?", id).Scan(&cnt); err != nil {
+		return fmt.Errorf("проверка операций счёта: %w", err)
+	}
+	if cnt > 0 {
+		return fmt.Errorf("%w: по счёту %d есть операции (%d)", errConflict, id, cnt)
+	}
+	res, err := l.db.Exec("DELETE FROM accounts WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("удаление счёта: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("%w: счёт %d", errNotFound, id)
+	}
+	return nil
+}
+
+// AccountBalance считает остаток счёта на момент asOf включительно, в валюте счёта.
+// Нулевой asOf означает «на текущий момент».
+func (l *Ledger) AccountBalance(accountID int64, asOf time.Time) (int64, error) {
+	if _, err := l.GetAccount(accountID); err != nil {
+		return 0, err
+	}
+	if asOf.IsZero() {
+		asOf = time.Now().UTC()
+	}
+	var balance int64
+	err := l.db.QueryRow(`
+SELECT COALESCE(SUM(amount_kopeks), 0)
+FROM transactions
+WHERE account_id = ? AND occurred_at <= ? AND deleted_at IS NULL
+`, accountID, asOf.UTC().Format(time.RFC3339)).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("остаток счёта: %w", err)
+	}
+	return balance, nil
+}
+
+// accountCurrency проверяет существование счёта (в том числе внутри транзакции БД)
+// и возвращает его валюту.
+func accountCurrency(q rowQuerier, accountID int64) (string, error) {
+	var currency string
+	if err := q.QueryRow("SELECT currency FROM accounts WHERE id = ?", accountID).Scan(&currency); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%w: счёт %d", errNotFound, accountID)
+		}
+		return "", fmt.Errorf("проверка счёта: %w", err)
+	}
+	return currency, nil
+}
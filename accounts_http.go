@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type accountReq struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Currency string `json:"currency"` // только при создании
+}
+
+// handleAccounts поддерживает GET (список) и POST (создание).
+func (s *server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		accounts, err := s.ledger.ListAccounts()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, accounts)
+	case http.MethodPost:
+		var req accountReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		acc, err := s.ledger.CreateAccount(strings.TrimSpace(req.Name), req.Kind, req.Currency)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, acc)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAccountByID поддерживает GET/PUT/DELETE /accounts/{id} и GET /accounts/{id}/balance?as_of=YYYY-MM-DD&known_at=....
+func (s *server) handleAccountByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := splitIDPath(r.URL.Path, "/accounts/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if action == "balance" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleAccountBalance(w, r, id)
+		return
+	}
+	if action != "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		acc, err := s.ledger.GetAccount(id)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, acc)
+	case http.MethodPut:
+		var req accountReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		acc, err := s.ledger.UpdateAccount(id, strings.TrimSpace(req.Name), req.Kind)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, acc)
+	case http.MethodDelete:
+		if err := s.ledger.DeleteAccount(id); err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAccountBalance возвращает остаток счёта на конец дня as_of (по умолчанию —
+// на сейчас) по текущему учёту, а с known_at (момент или дата — конец дня) — таким,
+// каким его знал учёт в тот момент.
+func (s *server) handleAccountBalance(w http.ResponseWriter, r *http.Request, id int64) {
+	q := r.URL.Query()
+	asOf, err := parseDate(q.Get("as_of"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !asOf.IsZero() {
+		asOf = asOf.Add(24*time.Hour - time.Second)
+	}
+	knownAt, err := parseMoment("known_at", q.Get("known_at"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	acc, err := s.ledger.GetAccount(id)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	var balance int64
+	if knownAt.IsZero() {
+		balance, err = s.ledger.AccountBalance(id, asOf)
+	} else {
+		balance, err = s.ledger.AccountBalanceKnownAt(id, asOf, knownAt)
+	}
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"account_id": id,
+		"as_of":      timeOrNow(asOf).Format("2006-01-02"),
+		"currency":   acc.Currency,
+		"balance":    fromMinorUnits(balance, acc.Currency),
+	})
+}
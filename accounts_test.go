@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAccountBalanceAndSummaryFilter(t *testing.T) {
+	ledger := newTestLedger(t)
+
+	card, err := ledger.CreateAccount("Debit card", "card", "")
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	transport, err := ledger.CreateCategory("Transport")
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+
+	add := func(accountID, amount int64, day int) {
+		t.Helper()
+		_, err := ledger.AddTransaction(Transaction{
+			AccountID:    accountID,
+			CategoryID:   transport.ID,
+			AmountKopeks: amount,
+			OccurredAt:   time.Date(2024, time.September, day, 0, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatalf("add transaction: %v", err)
+		}
+	}
+	add(card.ID, 100_000, 1)
+	add(card.ID, -3_200, 2)
+	add(card.ID, -3_200, 10)
+	add(defaultAccountID, -5_000, 2)
+
+	balance, err := ledger.AccountBalance(card.ID, time.Date(2024, time.September, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+	if balance != 96_800 {
+		t.Fatalf("balance on 5 Sep expected 96800, got %d", balance)
+	}
+
+	summary, err := ledger.Summary(SummaryFilter{
+		From:      time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2024, time.September, 30, 0, 0, 0, 0, time.UTC),
+		AccountID: card.ID,
+	})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	got := findSummary(summary, transport.ID)
+	if got.ExpenseKopeks != -6_400 || got.Count != 3 {
+		t.Fatalf("card-only summary unexpected: %+v", got)
+	}
+
+	if err := ledger.DeleteAccount(card.ID); !errors.Is(err, errConflict) {
+		t.Fatalf("expected conflict deleting account with history, got %v", err)
+	}
+}
+
+func TestAddTransactionRequiresAccount(t *testing.T) {
+	ledger := newTestLedger(t)
+	cat, err := ledger.CreateCategory("Food")
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	_, err = ledger.AddTransaction(Transaction{AccountID: 999, CategoryID: cat.ID, AmountKopeks: -100, OccurredAt: time.Now()})
+	if !errors.Is(err, errNotFound) {
+		t.Fatalf("expected not found for missing account, got %v", err)
+	}
+}
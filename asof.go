@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// knownLinesSQL — то же, что transactionLinesSQL, но строки берутся из JSON-массива
+// в параметре запроса (см. linesJSON): так отчёты считаются по восстановленному
+// из журнала аудита состоянию теми же запросами, что и по текущему.
+const knownLinesSQL = `(
+	SELECT json_extract(value, '$.id') AS id,
+		json_extract(value, '$.account_id') AS account_id,
+		json_extract(value, '$.category_id') AS category_id,
+		json_extract(value, '$.amount_kopeks') AS amount_kopeks,
+		json_extract(value, '$.currency') AS currency,
+		json_extract(value, '$.occurred_at') AS occurred_at,
+		json_extract(value, '$.transfer_id') AS transfer_id,
+		json_extract(value, '$.refund') AS refund
+	FROM json_each(?)
+) AS transaction_lines`
+
+// linesSource возвращает источник строк для отчёта: текущие операции или, при
+// ненулевом knownAt, операции в том виде, в каком они были известны в knownAt.
+// args подставляются перед остальными параметрами запроса.
+func (l *Ledger) linesSource(knownAt time.Time) (source string, args []any, err error) {
+	if knownAt.IsZero() {
+		return transactionLinesSQL, nil, nil
+	}
+	txs, err := l.transactionsKnownAt(knownAt, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	lines, err := linesJSON(txs)
+	if err != nil {
+		return "", nil, err
+	}
+	return knownLinesSQL, []any{lines}, nil
+}
+
+// linesJSON раскладывает операции на строки учёта (как transactionLinesSQL) в JSON.
+func linesJSON(txs []Transaction) (string, error) {
+	type line struct {
+		ID           int64  `json:"id"`
+		AccountID    int64  `json:"account_id"`
+		CategoryID   any    `json:"category_id"`
+		AmountKopeks int64  `json:"amount_kopeks"`
+		Currency     string `json:"currency"`
+		OccurredAt   string `json:"occurred_at"`
+		TransferID   any    `json:"transfer_id"`
+		Refund       bool   `json:"refund"`
+	}
+	lines := make([]line, 0, len(txs))
+	for _, t := range txs {
+		base := line{
+			ID:           t.ID,
+			AccountID:    t.AccountID,
+			CategoryID:   nullID(t.CategoryID),
+			AmountKopeks: t.AmountKopeks,
+			Currency:     t.Currency,
+			OccurredAt:   t.OccurredAt.UTC().Format(time.RFC3339),
+			TransferID:   nullID(t.TransferID),
+			Refund:       t.Refund,
+		}
+		if len(t.Splits) == 0 {
+			lines = append(lines, base)
+			continue
+		}
+		for _, s := range t.Splits {
+			part := base
+			part.CategoryID = s.CategoryID
+			part.AmountKopeks = s.AmountKopeks
+			lines = append(lines, part)
+		}
+	}
+	data, err := json.Marshal(lines)
+	if err != nil {
+		return "", fmt.Errorf("строки операций: %w", err)
+	}
+	return string(data), nil
+}
+
+// transactionsKnownAt восстанавливает операции такими, какими они были известны
+// в момент at. Для операции с записями в журнале аудита берётся снимок After
+// последней записи не позже at (удаление — операции не было), а если все записи
+// позже — снимок Before первой из них. Операции без записей берутся как есть,
+// если к at они уже были внесены (created_at; до миграции 0021 он неизвестен и
+// операция считается известной всегда) и ещё не удалены в корзину.
+// accountID != 0 оставляет только операции этого счёта (по восстановленному снимку).
+func (l *Ledger) transactionsKnownAt(at time.Time, accountID int64) ([]Transaction, error) {
+	cutoff := at.UTC().Format(time.RFC3339)
+
+	rows, err := l.db.Query("SELECT "+transactionColumns+" FROM transactions"+`
+WHERE (created_at IS NULL OR created_at <= ?)
+AND (deleted_at IS NULL OR deleted_at > ?)
+AND NOT EXISTS (SELECT 1 FROM audit_log a WHERE a.entity = ? AND a.entity_id = transactions.id)
+AND (? = 0 OR account_id = ?)
+ORDER BY id`, cutoff, cutoff, auditTransaction, accountID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("чтение операций: %w", err)
+	}
+	var out []Transaction
+	var ids []int64
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan transaction: %w", err)
+		}
+		out = append(out, t)
+		ids = append(ids, t.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	splits, err := loadTransactionSplits(l.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Splits = splits[out[i].ID]
+	}
+
+	// Из журнала нужны только две записи на операцию: последняя не позже at и,
+	// если таких нет, первая после. Пустой снимок — операции в тот момент не было.
+	// Счёт проверяется по выбранному снимку: операцию могли перенести на другой счёт.
+	rows, err = l.db.Query(`
+SELECT entity_id, state FROM (
+	SELECT entity_id, after AS state FROM audit_log
+	WHERE id IN (SELECT MAX(id) FROM audit_log WHERE entity = ? AND at <= ? GROUP BY entity_id)
+	AND after IS NOT NULL
+	UNION ALL
+	SELECT a.entity_id, a.before FROM audit_log a
+	WHERE a.id IN (SELECT MIN(id) FROM audit_log WHERE entity = ? AND at > ? GROUP BY entity_id)
+	AND a.before IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM audit_log p WHERE p.entity = a.entity AND p.entity_id = a.entity_id AND p.at <= ?)
+)
+WHERE ? = 0 OR json_extract(state, '$.AccountID') = ?
+ORDER BY entity_id`, auditTransaction, cutoff, auditTransaction, cutoff, cutoff, accountID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("чтение журнала аудита: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var state string
+		if err := rows.Scan(&id, &state); err != nil {
+			return nil, fmt.Errorf("scan audit: %w", err)
+		}
+		var t Transaction
+		if err := json.Unmarshal([]byte(state), &t); err != nil {
+			return nil, fmt.Errorf("снимок операции %d: %w", id, err)
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// AccountBalanceKnownAt считает остаток счёта на момент asOf (как AccountBalance,
+// нулевой — сейчас) так, как его показал бы учёт в момент knownAt: без операций,
+// внесённых или исправленных после knownAt. Операции задним числом, внесённые до
+// knownAt, учитываются.
+func (l *Ledger) AccountBalanceKnownAt(accountID int64, asOf, knownAt time.Time) (int64, error) {
+	if _, err := l.GetAccount(accountID); err != nil {
+		return 0, err
+	}
+	if asOf.IsZero() {
+		asOf = time.Now().UTC()
+	}
+	txs, err := l.transactionsKnownAt(knownAt, accountID)
+	if err != nil {
+		return 0, err
+	}
+	var balance int64
+	for _, t := range txs {
+		if !t.OccurredAt.After(asOf) {
+			balance += t.AmountKopeks
+		}
+	}
+	return balance, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummaryAndBalanceAsOfUseAuditHistory(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	day := time.Date(2024, time.March, 20, 0, 0, 0, 0, time.UTC)
+	add := func(amount int64) Transaction {
+		t.Helper()
+		saved, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: amount, OccurredAt: day})
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		return saved
+	}
+	// Журнал пишет текущее время, поэтому записи «переносим» в нужные моменты.
+	stamp := func(at string) {
+		t.Helper()
+		if _, err := ledger.db.Exec("UPDATE audit_log SET at = ? WHERE at > ?", at, "2025"); err != nil {
+			t.Fatalf("stamp: %v", err)
+		}
+	}
+
+	edited := add(-1_000)
+	deleted := add(-2_000)
+	stamp("2024-04-01T10:00:00Z")
+
+	edited.AmountKopeks = -1_500
+	if _, err := ledger.UpdateTransaction(edited); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := ledger.DeleteTransaction(deleted.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	add(-4_000)
+	stamp("2024-04-05T10:00:00Z")
+
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC)
+	sent := time.Date(2024, time.April, 2, 0, 0, 0, 0, time.UTC)
+	summary, err := ledger.Summary(SummaryFilter{From: from, To: to, KnownAt: sent})
+	if err != nil {
+		t.Fatalf("summary as of: %v", err)
+	}
+	if s := findSummary(summary, food.ID); s.ExpenseKopeks != -3_000 || s.Count != 2 {
+		t.Fatalf("as-of summary must reproduce the sent report: %+v", s)
+	}
+	summary, _ = ledger.Summary(SummaryFilter{From: from, To: to})
+	if s := findSummary(summary, food.ID); s.ExpenseKopeks != -5_500 || s.Count != 2 {
+		t.Fatalf("current summary: %+v", s)
+	}
+	if summary, _ := ledger.Summary(SummaryFilter{From: from, To: to, KnownAt: time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC)}); len(summary) != 0 {
+		t.Fatalf("nothing was known before the first entry: %+v", summary)
+	}
+
+	if balance, err := ledger.AccountBalanceKnownAt(defaultAccountID, sent, sent); err != nil || balance != -3_000 {
+		t.Fatalf("balance as of: %d %v", balance, err)
+	}
+	if balance, _ := ledger.AccountBalance(defaultAccountID, time.Time{}); balance != -5_500 {
+		t.Fatalf("current balance: %d", balance)
+	}
+
+	// Очистка корзины не меняет прошлые отчёты: снимок остаётся в журнале.
+	if _, err := ledger.PurgeTrash(time.Now()); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if balance, _ := ledger.AccountBalanceKnownAt(defaultAccountID, sent, sent); balance != -3_000 {
+		t.Fatalf("balance as of after purge: %d", balance)
+	}
+}
+
+func TestBalanceAsOfTracksTransfers(t *testing.T) {
+	ledger := newTestLedger(t)
+	deposit, err := ledger.CreateAccount("Savings", "deposit", "")
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	stamp := func(at string) {
+		t.Helper()
+		if _, err := ledger.db.Exec("UPDATE audit_log SET at = ? WHERE at > ?", at, "2025"); err != nil {
+			t.Fatalf("stamp audit: %v", err)
+		}
+		if _, err := ledger.db.Exec("UPDATE transactions SET created_at = ? WHERE created_at > ?", at, "2025"); err != nil {
+			t.Fatalf("stamp transactions: %v", err)
+		}
+	}
+
+	// Перевод задним числом (20 марта), внесённый 1 апреля и удалённый 5 апреля.
+	tr, err := ledger.CreateTransfer(Transfer{FromAccountID: defaultAccountID, ToAccountID: deposit.ID, AmountKopeks: 5_000,
+		OccurredAt: time.Date(2024, time.March, 20, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	stamp("2024-04-01T10:00:00Z")
+	if err := ledger.DeleteTransfer(tr.ID); err != nil {
+		t.Fatalf("delete transfer: %v", err)
+	}
+	stamp("2024-04-05T10:00:00Z")
+
+	for _, tc := range []struct {
+		at   time.Time
+		want int64
+	}{
+		{time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2024, time.April, 2, 0, 0, 0, 0, time.UTC), -5_000},
+		{time.Date(2024, time.April, 6, 0, 0, 0, 0, time.UTC), 0},
+	} {
+		if balance, err := ledger.AccountBalanceKnownAt(defaultAccountID, tc.at, tc.at); err != nil || balance != tc.want {
+			t.Fatalf("balance as of %s: %d %v, expected %d", tc.at.Format(time.DateOnly), balance, err, tc.want)
+		}
+	}
+
+	// Строка без записей в журнале не видна до момента, когда её внесли.
+	food, _ := ledger.CreateCategory("Food")
+	unaudited, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -700,
+		OccurredAt: time.Date(2024, time.March, 20, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := ledger.db.Exec("DELETE FROM audit_log WHERE entity = ? AND entity_id = ?", auditTransaction, unaudited.ID); err != nil {
+		t.Fatalf("drop audit: %v", err)
+	}
+	if balance, _ := ledger.AccountBalanceKnownAt(defaultAccountID, time.Time{}, time.Date(2024, time.April, 6, 0, 0, 0, 0, time.UTC)); balance != 0 {
+		t.Fatalf("unaudited transaction entered later leaked into the past: %d", balance)
+	}
+	if balance, _ := ledger.AccountBalanceKnownAt(defaultAccountID, time.Time{}, time.Now()); balance != -700 {
+		t.Fatalf("unaudited transaction must count once entered: %d", balance)
+	}
+}
+
+func TestBalanceOnDateVersusKnownAt(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	add := func(amount int64, day int) {
+		t.Helper()
+		if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: amount,
+			OccurredAt: time.Date(2024, time.March, day, 12, 0, 0, 0, time.UTC)}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	stamp := func(at string) {
+		t.Helper()
+		for _, q := range []string{"UPDATE audit_log SET at = ? WHERE at > ?", "UPDATE transactions SET created_at = ? WHERE created_at > ?"} {
+			if _, err := ledger.db.Exec(q, at, "2025"); err != nil {
+				t.Fatalf("stamp: %v", err)
+			}
+		}
+	}
+	add(-1_000, 10)
+	stamp("2024-03-31T10:00:00Z")
+	// Задним числом, 10 апреля: расход от 15 марта и операция после 20 марта.
+	add(-300, 15)
+	add(-5_000, 25)
+	stamp("2024-04-10T10:00:00Z")
+
+	endOfMarch20 := time.Date(2024, time.March, 20, 23, 59, 59, 0, time.UTC)
+	// Остаток на дату по текущему учёту включает всё, что внесено задним числом.
+	if balance, err := ledger.AccountBalance(defaultAccountID, endOfMarch20); err != nil || balance != -1_300 {
+		t.Fatalf("balance on date: %d %v", balance, err)
+	}
+	// Тот же остаток, каким его знал учёт 1 апреля.
+	knownAt := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	if balance, err := ledger.AccountBalanceKnownAt(defaultAccountID, endOfMarch20, knownAt); err != nil || balance != -1_000 {
+		t.Fatalf("balance on date known at April 1: %d %v", balance, err)
+	}
+	if balance, _ := ledger.AccountBalanceKnownAt(defaultAccountID, endOfMarch20, time.Now()); balance != -1_300 {
+		t.Fatalf("balance known now must match the current ledger: %d", balance)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Операции журнала аудита.
+const (
+	auditCreate  = "create"
+	auditUpdate  = "update"
+	auditDelete  = "delete"
+	auditMerge   = "merge"
+	auditRestore = "restore"
+	auditPurge   = "purge"
+)
+
+// Сущности журнала аудита.
+const (
+	auditCategory    = "category"
+	auditBudget      = "budget"
+	auditTransaction = "transaction"
+)
+
+// systemActor пишется в журнал для изменений без автора: планировщик,
+// миграции данных, вызовы Ledger без WithActor.
+const systemActor = "system"
+
+// AuditEntry — запись журнала аудита. Before и After — JSON-снимки сущности
+// (для бюджета EntityID — id категории); Before пуст при создании, After — при удалении.
+type AuditEntry struct {
+	ID        int64
+	At        time.Time
+	Actor     string
+	Operation string
+	Entity    string
+	EntityID  int64
+	Before    json.RawMessage
+	After     json.RawMessage
+}
+
+// AuditFilter отбирает записи журнала; пустые поля не ограничивают выборку.
+// Время записи — в [From, To). Limit 0 — 100 записей, отрицательный — все.
+type AuditFilter struct {
+	Entity    string
+	EntityID  int64
+	Actor     string
+	Operation string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// WithActor возвращает Ledger, который подписывает изменения в журнале аудита
+// именем actor. Исходный Ledger не меняется.
+func (l *Ledger) WithActor(actor string) *Ledger {
+	c := *l
+	c.actor = strings.TrimSpace(actor)
+	return &c
+}
+
+func (l *Ledger) auditActor() string {
+	if l.actor == "" {
+		return systemActor
+	}
+	return l.actor
+}
+
+// audit дописывает запись в журнал внутри транзакции изменения, так что
+// откат изменения откатывает и запись. nil в before/after — нет снимка.
+func (l *Ledger) audit(txObj *sql.Tx, operation, entity string, id int64, before, after any) error {
+	snapshot := func(v any) (any, error) {
+		if v == nil {
+			return nil, nil
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("снимок %s %d: %w", entity, id, err)
+		}
+		return string(data), nil
+	}
+	b, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	a, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+	if _, err := txObj.Exec(
+		"INSERT INTO audit_log (at, actor, operation, entity, entity_id, before, after) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		time.Now().UTC().Format(time.RFC3339), l.auditActor(), operation, entity, id, b, a,
+	); err != nil {
+		return fmt.Errorf("запись в журнал аудита: %w", err)
+	}
+	return nil
+}
+
+// auditSnapshot читает текущее состояние сущности; отсутствующая даёт nil.
+func auditSnapshot(q querier, entity string, id int64) (any, error) {
+	var v any
+	var err error
+	switch entity {
+	case auditCategory:
+		v, err = getCategory(q, id)
+	case auditBudget:
+		v, err = getBudget(q, id)
+	case auditTransaction:
+		v, err = getTransaction(q, id)
+	default:
+		return nil, fmt.Errorf("неизвестная сущность журнала %q", entity)
+	}
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// auditChanges снимает сущности ids до и после change и пишет по записи на
+// каждую изменившуюся. Удобно для пакетных изменений вроде переноса операций
+// при слиянии.
+func (l *Ledger) auditChanges(txObj *sql.Tx, operation, entity string, ids []int64, change func() error) error {
+	before := make([]any, len(ids))
+	for i, id := range ids {
+		v, err := auditSnapshot(txObj, entity, id)
+		if err != nil {
+			return err
+		}
+		before[i] = v
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	for i, id := range ids {
+		after, err := auditSnapshot(txObj, entity, id)
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(before[i], after) {
+			continue
+		}
+		if err := l.audit(txObj, operation, entity, id, before[i], after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditChange — auditChanges для одной сущности.
+func (l *Ledger) auditChange(txObj *sql.Tx, operation, entity string, id int64, change func() error) error {
+	return l.auditChanges(txObj, operation, entity, []int64{id}, change)
+}
+
+// selectIDs выполняет запрос, возвращающий одну колонку id.
+func selectIDs(q rowsQuerier, query string, args ...any) ([]int64, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AuditLog возвращает записи журнала по фильтру f, новые — первыми.
+func (l *Ledger) AuditLog(f AuditFilter) ([]AuditEntry, error) {
+	if f.Limit == 0 {
+		f.Limit = 100
+	}
+	var from, to any
+	if !f.From.IsZero() {
+		from = f.From.UTC().Format(time.RFC3339)
+	}
+	if !f.To.IsZero() {
+		to = f.To.UTC().Format(time.RFC3339)
+	}
+	rows, err := l.db.Query(`
+SELECT id, at, actor, operation, entity, entity_id, COALESCE(before, ''), COALESCE(after, '')
+FROM audit_log
+WHERE (? = '' OR entity = ?)
+AND (? = 0 OR entity_id = ?)
+AND (? = '' OR actor = ?)
+AND (? = '' OR operation = ?)
+AND (? IS NULL OR at >= ?)
+AND (? IS NULL OR at < ?)
+ORDER BY id DESC
+LIMIT ? OFFSET ?`,
+		f.Entity, f.Entity, f.EntityID, f.EntityID, f.Actor, f.Actor, f.Operation, f.Operation,
+		from, from, to, to, f.Limit, f.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("чтение журнала аудита: %w", err)
+	}
+	defer rows.Close()
+
+	var out []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var at, before, after string
+		if err := rows.Scan(&e.ID, &at, &e.Actor, &e.Operation, &e.Entity, &e.EntityID, &before, &after); err != nil {
+			return nil, fmt.Errorf("scan audit: %w", err)
+		}
+		e.At, _ = time.Parse(time.RFC3339, at)
+		if before != "" {
+			e.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			e.After = json.RawMessage(after)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// TransactionHistory возвращает все записи журнала об операции id, от первой к последней.
+func (l *Ledger) TransactionHistory(id int64) ([]AuditEntry, error) {
+	entries, err := l.AuditLog(AuditFilter{Entity: auditTransaction, EntityID: id, Limit: -1})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		if _, err := l.GetTransaction(id); err != nil {
+			return nil, err
+		}
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
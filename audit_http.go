@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// actorHeader — заголовок с автором изменения для журнала аудита.
+const actorHeader = "X-Actor"
+
+// ledgerFor возвращает Ledger, подписывающий изменения автором запроса из
+// заголовка X-Actor (без заголовка — "api").
+func (s *server) ledgerFor(r *http.Request) *Ledger {
+	actor := strings.TrimSpace(r.Header.Get(actorHeader))
+	if actor == "" {
+		actor = "api"
+	}
+	return s.ledger.WithActor(actor)
+}
+
+// handleAudit — GET /audit?entity=transaction&entity_id=7&actor=...&operation=update&from=...&to=...&limit=100&offset=0:
+// журнал изменений, новые записи первыми. to включает весь указанный день.
+func (s *server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	entityID, err := parseIDParam(q, "entity_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	from, err := parseDate(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := parseDate(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, 1)
+	}
+	f := AuditFilter{
+		Entity:    q.Get("entity"),
+		EntityID:  entityID,
+		Actor:     q.Get("actor"),
+		Operation: q.Get("operation"),
+		From:      from,
+		To:        to,
+	}
+	if l := q.Get("limit"); l != "" {
+		if f.Limit, err = strconv.Atoi(l); err != nil || f.Limit <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("limit должен быть положительным числом"))
+			return
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if f.Offset, err = strconv.Atoi(o); err != nil || f.Offset < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("offset должен быть неотрицательным числом"))
+			return
+		}
+	}
+	entries, err := s.ledger.AuditLog(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleTransactionHistory — GET /transactions/{id}/history: все изменения
+// операции от создания до последнего.
+func (s *server) handleTransactionHistory(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	history, err := s.ledger.TransactionHistory(id)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
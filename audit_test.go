@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAuditLogRecordsMutationsWithActor(t *testing.T) {
+	ledger := newTestLedger(t)
+	alice := ledger.WithActor("alice")
+	food, err := alice.CreateCategory("Food")
+	if err != nil {
+		t.Fatalf("category: %v", err)
+	}
+	cafe, _ := alice.CreateCategory("Cafe")
+	if _, err := alice.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 10_000}); err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+
+	day := time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)
+	saved, err := alice.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -1_000, OccurredAt: day})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	saved.AmountKopeks = -1_500
+	if _, err := ledger.WithActor("bob").UpdateTransaction(saved); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := ledger.MergeCategories(food.ID, cafe.ID); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if err := alice.DeleteTransaction(saved.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	history, err := ledger.TransactionHistory(saved.ID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	var ops, actors []string
+	for _, e := range history {
+		ops = append(ops, e.Operation)
+		actors = append(actors, e.Actor)
+	}
+	if len(history) != 4 || ops[0] != auditCreate || ops[1] != auditUpdate || ops[2] != auditUpdate || ops[3] != auditDelete {
+		t.Fatalf("unexpected history operations: %v", ops)
+	}
+	if actors[0] != "alice" || actors[1] != "bob" || actors[2] != systemActor {
+		t.Fatalf("unexpected actors: %v", actors)
+	}
+	if history[0].Before != nil || history[3].After != nil {
+		t.Fatalf("create has no before, delete has no after: %+v", history)
+	}
+	var before, after Transaction
+	if err := json.Unmarshal(history[1].Before, &before); err != nil {
+		t.Fatalf("before: %v", err)
+	}
+	if err := json.Unmarshal(history[1].After, &after); err != nil {
+		t.Fatalf("after: %v", err)
+	}
+	if before.AmountKopeks != -1_000 || after.AmountKopeks != -1_500 {
+		t.Fatalf("update must keep old and new amount: %d -> %d", before.AmountKopeks, after.AmountKopeks)
+	}
+	if err := json.Unmarshal(history[2].After, &after); err != nil || after.CategoryID != cafe.ID {
+		t.Fatalf("merge must be recorded on moved transactions: %+v %v", after, err)
+	}
+
+	budgets, err := ledger.AuditLog(AuditFilter{Entity: auditBudget, EntityID: food.ID})
+	if err != nil || len(budgets) != 2 || budgets[0].Operation != auditMerge || budgets[1].Operation != auditCreate {
+		t.Fatalf("unexpected budget audit: %+v %v", budgets, err)
+	}
+	byAlice, err := ledger.AuditLog(AuditFilter{Actor: "alice", Entity: auditCategory})
+	if err != nil || len(byAlice) != 2 {
+		t.Fatalf("actor filter: %+v %v", byAlice, err)
+	}
+	merged, err := ledger.AuditLog(AuditFilter{Entity: auditCategory, EntityID: food.ID, Operation: auditMerge})
+	if err != nil || len(merged) != 1 || merged[0].After != nil {
+		t.Fatalf("merged category must be recorded: %+v %v", merged, err)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Периоды бюджета.
+const (
+	periodWeekly    = "weekly"
+	periodMonthly   = "monthly"
+	periodQuarterly = "quarterly"
+	periodYearly    = "yearly"
+)
+
+var budgetPeriods = map[string]bool{
+	periodWeekly:    true,
+	periodMonthly:   true,
+	periodQuarterly: true,
+	periodYearly:    true,
+}
+
+// periodMonths — длина периода в месяцах; у недельного бюджета 0.
+var periodMonths = map[string]int{
+	periodMonthly:   1,
+	periodQuarterly: 3,
+	periodYearly:    12,
+}
+
+// Уровни алертов бюджета.
+const (
+	// severityCritical — лимит превышен.
+	severityCritical = "critical"
+	// severityWarning — пройден один из порогов бюджета.
+	severityWarning = "warning"
+	// severityInfo — лимит пока не достигнут, но при текущем темпе будет превышен к концу периода.
+	severityInfo = "info"
+)
+
+// normalizeThresholds проверяет пороги, сортирует их и убирает повторы.
+func normalizeThresholds(in []int) ([]int, error) {
+	out := slices.Clone(in)
+	for _, pct := range out {
+		if pct < 1 || pct > 100 {
+			return nil, fmt.Errorf("порог бюджета %d%% вне диапазона 1–100", pct)
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+func formatThresholds(thresholds []int) string {
+	parts := make([]string, len(thresholds))
+	for i, pct := range thresholds {
+		parts[i] = strconv.Itoa(pct)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseThresholds(s string) []int {
+	var out []int
+	for _, part := range strings.Split(s, ",") {
+		if pct, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			out = append(out, pct)
+		}
+	}
+	return out
+}
+
+// defaultHistoryPeriods — сколько последних периодов показывает история бюджета по умолчанию.
+const defaultHistoryPeriods = 12
+
+// dayOf отбрасывает время: периоды бюджетов считаются в календарных днях.
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// addMonthsClamped сдвигает дату на n месяцев, не перескакивая в следующий месяц:
+// от 31 января через месяц получается 29 (28) февраля, а не 2 марта.
+func addMonthsClamped(t time.Time, n int) time.Time {
+	months := int(t.Month()) - 1 + n
+	year := t.Year() + floorDiv(months, 12)
+	month := time.Month(months - floorDiv(months, 12)*12 + 1)
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return time.Date(year, month, min(t.Day(), lastDay), 0, 0, 0, 0, time.UTC)
+}
+
+// calendarPeriodStart — начало календарного периода, содержащего now.
+func calendarPeriodStart(period string, now time.Time) time.Time {
+	day := dayOf(now)
+	switch period {
+	case periodWeekly:
+		offset := (int(day.Weekday()) + 6) % 7 // понедельник — 0
+		return day.AddDate(0, 0, -offset)
+	case periodQuarterly:
+		return time.Date(day.Year(), (day.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+	case periodYearly:
+		return time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// periodContaining возвращает начало периода бюджета, в который попадает at,
+// и начало следующего периода.
+func periodContaining(b Budget, at time.Time) (from, next time.Time) {
+	start, at := dayOf(b.StartDate), dayOf(at)
+	months := periodMonths[b.Period]
+	if months == 0 {
+		k := floorDiv(int(at.Sub(start).Hours()/24), 7)
+		from = start.AddDate(0, 0, 7*k)
+		return from, from.AddDate(0, 0, 7)
+	}
+	diff := (at.Year()-start.Year())*12 + int(at.Month()) - int(start.Month())
+	k := floorDiv(diff, months)
+	if from = addMonthsClamped(start, k*months); from.After(at) {
+		k--
+		from = addMonthsClamped(start, k*months)
+	}
+	return from, addMonthsClamped(start, (k+1)*months)
+}
+
+// spentCache считает траты категорий, переиспользуя одну сводку для бюджетов
+// с одинаковыми валютой и периодом.
+type spentCache struct {
+	l     *Ledger
+	byKey map[string]map[int64]CategorySummary
+}
+
+func newSpentCache(l *Ledger) *spentCache {
+	return &spentCache{l: l, byKey: make(map[string]map[int64]CategorySummary)}
+}
+
+// get возвращает расходы категории бюджета вместе с подкатегориями за [from, to]
+// в валюте бюджета.
+func (c *spentCache) get(b Budget, from, to time.Time) (int64, error) {
+	key := fmt.Sprintf("%s|%s|%s", b.Currency, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	byCat, ok := c.byKey[key]
+	if !ok {
+		summary, err := c.l.Summary(SummaryFilter{From: from, To: to, Currency: b.Currency, RollUp: true})
+		if err != nil {
+			return 0, err
+		}
+		byCat = make(map[int64]CategorySummary, len(summary))
+		for _, s := range summary {
+			byCat[s.CategoryID] = s
+		}
+		c.byKey[key] = byCat
+	}
+	return -byCat[b.CategoryID].ExpenseKopeks, nil
+}
+
+// newBudgetAlert заполняет алерт для трат spent при действующем лимите limit.
+// Severity выставляется только за превышение; пороги и прогноз — забота вызывающего.
+func newBudgetAlert(b Budget, limit, spent int64, from, to time.Time) BudgetAlert {
+	a := BudgetAlert{
+		CategoryID:      b.CategoryID,
+		CategoryName:    b.CategoryName,
+		Currency:        b.Currency,
+		PeriodStart:     from,
+		PeriodEnd:       to,
+		LimitKopeks:     limit,
+		BaseLimitKopeks: b.LimitKopeks,
+		SpentKopeks:     spent,
+		ForecastKopeks:  spent,
+	}
+	if limit > 0 {
+		a.UsedPercent = int(spent * 100 / limit)
+	}
+	if spent > limit {
+		a.Severity = severityCritical
+		a.ExceededByKopeks = spent - limit
+	}
+	return a
+}
+
+// evaluatePeriod строит алерт по периоду бюджета на день at: превышение,
+// наибольший пройденный порог и прогноз по текущему темпу трат.
+// ok == false — предупреждать не о чем.
+func evaluatePeriod(b Budget, p BudgetPeriodReport, at time.Time) (a BudgetAlert, ok bool) {
+	a = newBudgetAlert(b, p.EffectiveLimitKopeks, p.SpentKopeks, p.PeriodStart, p.PeriodEnd)
+	a.Period = b.Period
+	a.CarriedKopeks = p.CarriedKopeks
+
+	if limit := p.EffectiveLimitKopeks; limit > 0 {
+		for _, pct := range b.Thresholds {
+			if p.SpentKopeks*100 >= int64(pct)*limit {
+				a.ThresholdPercent = pct
+			}
+		}
+	}
+
+	// Прогноз: средние траты за прошедшие дни периода, умноженные на его длину.
+	total := int64(p.PeriodEnd.Sub(p.PeriodStart).Hours()/24) + 1
+	elapsed := min(int64(dayOf(at).Sub(p.PeriodStart).Hours()/24)+1, total)
+	if elapsed > 0 {
+		a.ForecastKopeks = p.SpentKopeks * total / elapsed
+	}
+
+	switch {
+	case a.Severity == severityCritical:
+	case a.ThresholdPercent > 0:
+		a.Severity = severityWarning
+	case a.ForecastKopeks > p.EffectiveLimitKopeks:
+		a.Severity = severityInfo
+	default:
+		return BudgetAlert{}, false
+	}
+	return a, true
+}
+
+// convert переводит суммы алерта в currency по курсу на день at (пустая currency — без пересчёта).
+func (a *BudgetAlert) convert(conv *rateConverter, currency string, at time.Time) error {
+	if currency == "" || currency == a.Currency {
+		return nil
+	}
+	day := at.Format("2006-01-02")
+	for _, v := range []*int64{&a.LimitKopeks, &a.BaseLimitKopeks, &a.CarriedKopeks, &a.SpentKopeks, &a.ExceededByKopeks, &a.ForecastKopeks} {
+		var err error
+		if *v, err = conv.convert(*v, a.Currency, currency, day); err != nil {
+			return err
+		}
+	}
+	a.Currency = currency
+	return nil
+}
+
+// BudgetAlerts проверяет каждый бюджет в его собственном периоде, содержащем at
+// (нулевой at — сегодня): месячный — за текущий месяц, недельный — за текущую неделю.
+// Траты сравниваются с действующим лимитом (с учётом переноса) и порогами бюджета;
+// кроме того, предупреждает, если текущий темп трат приведёт к перерасходу.
+// Бюджеты, которые ещё не начали действовать, пропускаются.
+func (l *Ledger) BudgetAlerts(at time.Time, reportCurrency string) ([]BudgetAlert, error) {
+	reportCurrency, err := normalizeCurrency(reportCurrency)
+	if err != nil {
+		return nil, err
+	}
+	at = dayOf(timeOrNow(at))
+	budgets, err := l.listBudgets()
+	if err != nil {
+		return nil, err
+	}
+
+	conv := newRateConverter(l.db)
+	var alerts []BudgetAlert
+	for _, b := range budgets {
+		periods, err := l.budgetPeriods(b, at, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(periods) == 0 {
+			continue
+		}
+		a, ok := evaluatePeriod(b, periods[0], at)
+		if !ok {
+			continue
+		}
+		if err := a.convert(conv, reportCurrency, at); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, nil
+}
+
+// BudgetPeriodReport — план и факт бюджета за один период [PeriodStart, PeriodEnd].
+type BudgetPeriodReport struct {
+	PeriodStart          time.Time
+	PeriodEnd            time.Time
+	Currency             string
+	LimitKopeks          int64 // базовый лимит
+	CarriedKopeks        int64 // перенос из прошлых периодов (только у бюджетов с Rollover)
+	EffectiveLimitKopeks int64
+	SpentKopeks          int64
+	RemainingKopeks      int64 // EffectiveLimitKopeks - SpentKopeks, отрицательный при перерасходе
+}
+
+// budgetPeriods считает план/факт последних keep периодов бюджета до периода,
+// содержащего at, включительно (старые первыми; keep <= 0 — все с StartDate).
+// Для переноса проходятся все периоды с начала бюджета: суммы не хранятся,
+// поэтому правка прошлых операций сразу меняет текущий лимит.
+func (l *Ledger) budgetPeriods(b Budget, at time.Time, keep int) ([]BudgetPeriodReport, error) {
+	at = dayOf(at)
+	if at.Before(b.StartDate) {
+		return nil, nil
+	}
+
+	// Границы периодов от первого нужного до текущего.
+	var starts []time.Time
+	for day := at; !day.Before(b.StartDate); {
+		from, _ := periodContaining(b, day)
+		starts = append(starts, from)
+		if !b.Rollover && keep > 0 && len(starts) == keep {
+			break
+		}
+		day = from.AddDate(0, 0, -1)
+	}
+	slices.Reverse(starts)
+	_, end := periodContaining(b, at)
+
+	spent, err := l.categorySpentByDay(b, starts[0], end)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]BudgetPeriodReport, len(starts))
+	var carried int64
+	for i, from := range starts {
+		next := end
+		if i+1 < len(starts) {
+			next = starts[i+1]
+		}
+		p := BudgetPeriodReport{
+			PeriodStart:          from,
+			PeriodEnd:            next.AddDate(0, 0, -1),
+			Currency:             b.Currency,
+			LimitKopeks:          b.LimitKopeks,
+			CarriedKopeks:        carried,
+			EffectiveLimitKopeks: b.LimitKopeks + carried,
+		}
+		for _, d := range spent {
+			if !d.day.Before(from) && d.day.Before(next) {
+				p.SpentKopeks += d.amount
+			}
+		}
+		p.RemainingKopeks = p.EffectiveLimitKopeks - p.SpentKopeks
+		if b.Rollover {
+			carried = p.RemainingKopeks
+		}
+		out[i] = p
+	}
+	if keep > 0 && len(out) > keep {
+		out = out[len(out)-keep:]
+	}
+	return out, nil
+}
+
+type daySpent struct {
+	day    time.Time
+	amount int64
+}
+
+// categorySpentByDay возвращает расходы категории бюджета и её подкатегорий по дням
+// за [from, to) в валюте бюджета (каждый день — по своему курсу, как в Summary).
+func (l *Ledger) categorySpentByDay(b Budget, from, to time.Time) ([]daySpent, error) {
+	rows, err := l.db.Query(`
+SELECT substr(occurred_at, 1, 10) AS day, currency, SUM(-amount_kopeks)
+FROM `+transactionLinesSQL+`
+WHERE `+categorySubtreeSQL+` AND transfer_id IS NULL AND amount_kopeks < 0
+AND occurred_at >= ? AND occurred_at < ?
+GROUP BY day, currency
+ORDER BY day`, b.CategoryID, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("расходы по бюджету: %w", err)
+	}
+	defer rows.Close()
+
+	conv := newRateConverter(l.db)
+	var out []daySpent
+	for rows.Next() {
+		var day, currency string
+		var amount int64
+		if err := rows.Scan(&day, &currency, &amount); err != nil {
+			return nil, fmt.Errorf("scan spent: %w", err)
+		}
+		if amount, err = conv.convert(amount, currency, b.Currency, day); err != nil {
+			return nil, err
+		}
+		d, _ := time.Parse("2006-01-02", day)
+		out = append(out, daySpent{day: d, amount: amount})
+	}
+	return out, rows.Err()
+}
+
+// withCarry заполняет перенос и действующий лимит бюджета на период, содержащий at.
+func (l *Ledger) withCarry(b Budget, at time.Time) (Budget, error) {
+	if !b.Rollover {
+		return b, nil
+	}
+	periods, err := l.budgetPeriods(b, at, 1)
+	if err != nil || len(periods) == 0 {
+		return b, err
+	}
+	b.CarriedKopeks = periods[0].CarriedKopeks
+	b.EffectiveLimitKopeks = periods[0].EffectiveLimitKopeks
+	return b, nil
+}
+
+// BudgetHistory возвращает план/факт бюджета категории за periods последних
+// периодов до периода, содержащего at, включительно (старые первыми).
+// История не уходит раньше StartDate. Лимит хранится один, поэтому для прошлых
+// периодов показывается текущий.
+func (l *Ledger) BudgetHistory(categoryID int64, at time.Time, periods int) ([]BudgetPeriodReport, error) {
+	b, err := getBudget(l.db, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if periods <= 0 {
+		periods = defaultHistoryPeriods
+	}
+	return l.budgetPeriods(b, timeOrNow(at), periods)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// handleBudgetByID поддерживает GET /budgets/{category_id} и
+// GET /budgets/{category_id}/history?periods=12&at=YYYY-MM-DD — план/факт по прошедшим периодам.
+func (s *server) handleBudgetByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	categoryID, action, err := splitIDPath(r.URL.Path, "/budgets/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch action {
+	case "":
+		b, err := s.ledger.GetBudget(categoryID)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, b)
+	case "history":
+		s.handleBudgetHistory(w, r, categoryID)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *server) handleBudgetHistory(w http.ResponseWriter, r *http.Request, categoryID int64) {
+	q := r.URL.Query()
+	at, err := parseDate(q.Get("at"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	periods := 0
+	if raw := q.Get("periods"); raw != "" {
+		if periods, err = strconv.Atoi(raw); err != nil || periods <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("periods должен быть положительным числом"))
+			return
+		}
+	}
+
+	history, err := s.ledger.BudgetHistory(categoryID, at, periods)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+
+	type periodResp struct {
+		PeriodStart    string `json:"period_start"`
+		PeriodEnd      string `json:"period_end"`
+		Currency       string `json:"currency"`
+		Limit          Money  `json:"limit"`
+		Carried        Money  `json:"carried"`
+		EffectiveLimit Money  `json:"effective_limit"`
+		Spent          Money  `json:"spent"`
+		Remaining      Money  `json:"remaining"`
+	}
+	resp := make([]periodResp, 0, len(history))
+	for _, p := range history {
+		resp = append(resp, periodResp{
+			PeriodStart:    p.PeriodStart.Format("2006-01-02"),
+			PeriodEnd:      p.PeriodEnd.Format("2006-01-02"),
+			Currency:       p.Currency,
+			Limit:          fromMinorUnits(p.LimitKopeks, p.Currency),
+			Carried:        fromMinorUnits(p.CarriedKopeks, p.Currency),
+			EffectiveLimit: fromMinorUnits(p.EffectiveLimitKopeks, p.Currency),
+			Spent:          fromMinorUnits(p.SpentKopeks, p.Currency),
+			Remaining:      fromMinorUnits(p.RemainingKopeks, p.Currency),
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodContaining(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		period     string
+		start, at  time.Time
+		from, next time.Time
+	}{
+		{periodMonthly, date(2024, 1, 31), date(2024, 3, 5), date(2024, 2, 29), date(2024, 3, 31)},
+		{periodMonthly, date(2024, 1, 10), date(2024, 3, 10), date(2024, 3, 10), date(2024, 4, 10)},
+		{periodWeekly, date(2024, 4, 1), date(2024, 4, 14), date(2024, 4, 8), date(2024, 4, 15)},
+		{periodQuarterly, date(2024, 1, 1), date(2024, 8, 20), date(2024, 7, 1), date(2024, 10, 1)},
+		{periodYearly, date(2023, 7, 1), date(2024, 6, 30), date(2023, 7, 1), date(2024, 7, 1)},
+	}
+	for _, tc := range tests {
+		from, next := periodContaining(Budget{Period: tc.period, StartDate: tc.start}, tc.at)
+		if !from.Equal(tc.from) || !next.Equal(tc.next) {
+			t.Fatalf("%s from %s at %s: got [%s, %s), want [%s, %s)", tc.period, tc.start.Format("2006-01-02"), tc.at.Format("2006-01-02"),
+				from.Format("2006-01-02"), next.Format("2006-01-02"), tc.from.Format("2006-01-02"), tc.next.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestBudgetAlertsUseCurrentPeriodAndHistory(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	fun, _ := ledger.CreateCategory("Fun")
+
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 10_000, StartDate: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("monthly budget: %v", err)
+	}
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: fun.ID, LimitKopeks: 1_000, Period: periodWeekly, StartDate: time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("weekly budget: %v", err)
+	}
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: fun.ID, LimitKopeks: 1_000, Period: "daily"}); err == nil {
+		t.Fatal("unknown period must be rejected")
+	}
+
+	add := func(categoryID, amount int64, day time.Time) {
+		t.Helper()
+		if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: categoryID, AmountKopeks: amount, OccurredAt: day}); err != nil {
+			t.Fatalf("add transaction: %v", err)
+		}
+	}
+	add(food.ID, -15_000, time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC)) // февраль — перерасход
+	add(food.ID, -4_000, time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC))
+	add(fun.ID, -800, time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC))  // неделя 4–10 марта
+	add(fun.ID, -800, time.Date(2024, time.March, 12, 0, 0, 0, 0, time.UTC)) // неделя 11–17 марта
+	add(fun.ID, -800, time.Date(2024, time.March, 13, 0, 0, 0, 0, time.UTC))
+
+	alerts, err := ledger.BudgetAlerts(time.Date(2024, time.March, 14, 0, 0, 0, 0, time.UTC), "")
+	if err != nil {
+		t.Fatalf("alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].CategoryID != fun.ID || alerts[0].ExceededByKopeks != 600 ||
+		!alerts[0].PeriodStart.Equal(time.Date(2024, time.March, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("only the current fun week should be exceeded: %+v", alerts)
+	}
+
+	history, err := ledger.BudgetHistory(food.ID, time.Date(2024, time.March, 14, 0, 0, 0, 0, time.UTC), 0)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(history) != 3 || history[1].SpentKopeks != 15_000 || history[1].RemainingKopeks != -5_000 || history[2].SpentKopeks != 4_000 {
+		t.Fatalf("history unexpected: %+v", history)
+	}
+}
+
+func TestBudgetRolloverFollowsTransactionEdits(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Groceries")
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 10_000, Rollover: true, StartDate: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+	add := func(amount int64, day time.Time) Transaction {
+		t.Helper()
+		saved, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: amount, OccurredAt: day})
+		if err != nil {
+			t.Fatalf("add transaction: %v", err)
+		}
+		return saved
+	}
+	march := add(-7_000, time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)) // недорасход 3000
+	add(-12_000, time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC))      // перерасход 2000
+	add(-12_000, time.Date(2024, time.April, 5, 0, 0, 0, 0, time.UTC))
+
+	april := time.Date(2024, time.April, 20, 0, 0, 0, 0, time.UTC)
+	history, err := ledger.BudgetHistory(food.ID, april, 0)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	// Февраль: -2000 в март; март: 8000 - 7000 = 1000 в апрель.
+	if len(history) != 3 || history[1].CarriedKopeks != -2_000 || history[2].CarriedKopeks != 1_000 || history[2].EffectiveLimitKopeks != 11_000 {
+		t.Fatalf("carry unexpected: %+v", history)
+	}
+	alerts, err := ledger.BudgetAlerts(april, "")
+	if err != nil {
+		t.Fatalf("alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].BaseLimitKopeks != 10_000 || alerts[0].LimitKopeks != 11_000 || alerts[0].ExceededByKopeks != 1_000 {
+		t.Fatalf("alert must use effective limit: %+v", alerts)
+	}
+
+	// Правка мартовской операции сразу меняет перенос в апрель.
+	march.AmountKopeks = -5_000
+	if _, err := ledger.UpdateTransaction(march); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	alerts, err = ledger.BudgetAlerts(april, "")
+	if err != nil {
+		t.Fatalf("alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Severity == severityCritical || alerts[0].LimitKopeks != 13_000 {
+		t.Fatalf("13000 effective limit must cover April spending: %+v", alerts)
+	}
+}
+
+func TestBudgetThresholdsAndForecast(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	fun, _ := ledger.CreateCategory("Fun")
+	start := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 30_000, StartDate: start, Thresholds: []int{80, 50, 80}}); err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: fun.ID, LimitKopeks: 30_000, StartDate: start}); err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: fun.ID, LimitKopeks: 30_000, Thresholds: []int{150}}); err == nil {
+		t.Fatal("threshold above 100% must be rejected")
+	}
+	if b, _ := ledger.GetBudget(food.ID); len(b.Thresholds) != 2 || b.Thresholds[0] != 50 {
+		t.Fatalf("thresholds must be sorted and deduplicated: %+v", b.Thresholds)
+	}
+
+	day := time.Date(2024, time.June, 10, 0, 0, 0, 0, time.UTC)
+	for _, tx := range []Transaction{
+		{CategoryID: food.ID, AmountKopeks: -16_000}, // 53% лимита на 10-й день из 30: прогноз 48000
+		{CategoryID: fun.ID, AmountKopeks: -12_000},  // 40%, порогов нет, прогноз 36000
+	} {
+		tx.AccountID, tx.OccurredAt = defaultAccountID, day
+		if _, err := ledger.AddTransaction(tx); err != nil {
+			t.Fatalf("add transaction: %v", err)
+		}
+	}
+
+	alerts, err := ledger.BudgetAlerts(day, "")
+	if err != nil {
+		t.Fatalf("alerts: %v", err)
+	}
+	bySeverity := map[int64]BudgetAlert{}
+	for _, a := range alerts {
+		bySeverity[a.CategoryID] = a
+	}
+	if a := bySeverity[food.ID]; a.Severity != severityWarning || a.ThresholdPercent != 50 || a.ForecastKopeks != 48_000 {
+		t.Fatalf("food: expected 50%% warning, got %+v", a)
+	}
+	if a := bySeverity[fun.ID]; a.Severity != severityInfo || a.ForecastKopeks != 36_000 {
+		t.Fatalf("fun: expected forecast info, got %+v", a)
+	}
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Типы категорий: какой знак суммы допускают операции в категории.
+const (
+	categoryKindIncome  = "income"
+	categoryKindExpense = "expense"
+	categoryKindNeutral = "neutral"
+)
+
+var categoryKinds = map[string]bool{
+	categoryKindIncome:  true,
+	categoryKindExpense: true,
+	categoryKindNeutral: true,
+}
+
+// categorySubtreeSQL — условие «категория операции — id или любая её подкатегория»;
+// параметр — id корня поддерева.
+const categorySubtreeSQL = `category_id IN (
+	WITH RECURSIVE subtree(id) AS (
+		SELECT ?
+		UNION ALL
+		SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+	)
+	SELECT id FROM subtree)`
+
+// CategoryNode — категория с подкатегориями для дерева.
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode
+}
+
+// categoryParents возвращает родителя каждой категории (0 — верхний уровень).
+func categoryParents(q rowsQuerier) (map[int64]int64, error) {
+	rows, err := q.Query("SELECT id, COALESCE(parent_id, 0) FROM categories")
+	if err != nil {
+		return nil, fmt.Errorf("чтение иерархии категорий: %w", err)
+	}
+	defer rows.Close()
+
+	parents := make(map[int64]int64)
+	for rows.Next() {
+		var id, parentID int64
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, fmt.Errorf("scan category: %w", err)
+		}
+		parents[id] = parentID
+	}
+	return parents, rows.Err()
+}
+
+// ancestors возвращает id и всех предков категории, начиная с неё самой.
+// Длина пути ограничена числом категорий на случай испорченных данных.
+func ancestors(parents map[int64]int64, id int64) []int64 {
+	var out []int64
+	for id != 0 && len(out) <= len(parents) {
+		out = append(out, id)
+		id = parents[id]
+	}
+	return out
+}
+
+// kindAllows сообщает, допускает ли тип категории сумму amount. Нулевая сумма
+// и операции с refund допустимы в любой категории.
+func kindAllows(kind string, amount int64, refund bool) bool {
+	switch {
+	case refund || amount == 0:
+		return true
+	case kind == categoryKindIncome:
+		return amount > 0
+	case kind == categoryKindExpense:
+		return amount < 0
+	default:
+		return true
+	}
+}
+
+func categoryKind(q rowQuerier, categoryID int64) (string, error) {
+	var kind string
+	if err := q.QueryRow("SELECT kind FROM categories WHERE id = ?", categoryID).Scan(&kind); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%w: категория %d", errNotFound, categoryID)
+		}
+		return "", fmt.Errorf("чтение категории: %w", err)
+	}
+	return kind, nil
+}
+
+// categoryKindsByID возвращает тип каждой категории; архивные — только с includeArchived.
+func categoryKindsByID(q rowsQuerier, includeArchived bool) (map[int64]string, error) {
+	rows, err := q.Query("SELECT id, kind FROM categories WHERE (? OR archived = 0)", includeArchived)
+	if err != nil {
+		return nil, fmt.Errorf("чтение типов категорий: %w", err)
+	}
+	defer rows.Close()
+
+	kinds := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var kind string
+		if err := rows.Scan(&id, &kind); err != nil {
+			return nil, fmt.Errorf("scan category: %w", err)
+		}
+		kinds[id] = kind
+	}
+	return kinds, rows.Err()
+}
+
+// checkCategorySign проверяет, что категория операции существует и её тип
+// допускает знак суммы. Доход в категории расходов (и наоборот) проходит только
+// с явным Refund.
+func checkCategorySign(q rowQuerier, t Transaction) error {
+	kind, err := categoryKind(q, t.CategoryID)
+	if err != nil {
+		return err
+	}
+	if kindAllows(kind, t.AmountKopeks, t.Refund) {
+		return nil
+	}
+	if kind == categoryKindExpense {
+		return fmt.Errorf("категория %d — для расходов, а сумма положительная; для возврата укажите refund", t.CategoryID)
+	}
+	return fmt.Errorf("категория %d — для доходов, а сумма отрицательная; для сторно укажите refund", t.CategoryID)
+}
+
+// checkCategoryActive возвращает errConflict для архивной категории.
+func checkCategoryActive(q rowQuerier, categoryID int64) error {
+	var archived bool
+	if err := q.QueryRow("SELECT archived FROM categories WHERE id = ?", categoryID).Scan(&archived); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: категория %d", errNotFound, categoryID)
+		}
+		return fmt.Errorf("чтение категории: %w", err)
+	}
+	if archived {
+		return fmt.Errorf("%w: категория %d в архиве и не принимает новые операции", errConflict, categoryID)
+	}
+	return nil
+}
+
+// checkNoActiveRecurring возвращает errConflict, если по категории categoryID
+// ещё будут создаваться операции из шаблона: архивная категория их не примет.
+func checkNoActiveRecurring(q rowQuerier, categoryID int64) error {
+	var count int
+	if err := q.QueryRow(`
+SELECT COUNT(*) FROM recurring_templates
+WHERE category_id = ? AND (end_date IS NULL OR posted_through IS NULL OR posted_through < end_date)`, categoryID).Scan(&count); err != nil {
+		return fmt.Errorf("проверка шаблонов категории: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: категорию %d используют повторяющиеся шаблоны: %d; смените в них категорию или удалите их", errConflict, categoryID, count)
+	}
+	return nil
+}
+
+// checkCategoryName возвращает errConflict, если имя name уже занято другой
+// категорией (не exceptID).
+func checkCategoryName(q rowQuerier, name string, exceptID int64) error {
+	var id int64
+	err := q.QueryRow("SELECT id FROM categories WHERE name = ? AND id != ?", name, exceptID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("проверка имени категории: %w", err)
+	}
+	return fmt.Errorf("%w: категория с именем %q уже есть (id %d)", errConflict, name, id)
+}
+
+func (l *Ledger) GetCategory(id int64) (Category, error) {
+	return getCategory(l.db, id)
+}
+
+func getCategory(q rowQuerier, id int64) (Category, error) {
+	c, err := scanCategory(q.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Category{}, fmt.Errorf("%w: категория %d", errNotFound, id)
+	}
+	if err != nil {
+		return Category{}, fmt.Errorf("чтение категории: %w", err)
+	}
+	return c, nil
+}
+
+// CategoryPatch — изменяемые поля категории; nil — не менять.
+type CategoryPatch struct {
+	Name     *string
+	Archived *bool
+}
+
+// UpdateCategory переименовывает категорию и/или меняет признак архива.
+// Занятое другой категорией имя — errConflict; категорию, по которой ещё
+// создаёт операции повторяющийся шаблон, в архив не убрать (тоже errConflict).
+func (l *Ledger) UpdateCategory(id int64, patch CategoryPatch) (Category, error) {
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Category{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	if err := checkCategory(txObj, id); err != nil {
+		return Category{}, err
+	}
+	err = l.auditChange(txObj, auditUpdate, auditCategory, id, func() error {
+		if patch.Name != nil {
+			name := strings.TrimSpace(*patch.Name)
+			if name == "" {
+				return errors.New("название категории пустое")
+			}
+			if err := checkCategoryName(txObj, name, id); err != nil {
+				return err
+			}
+			if _, err := txObj.Exec("UPDATE categories SET name = ? WHERE id = ?", name, id); err != nil {
+				return fmt.Errorf("переименование категории: %w", err)
+			}
+		}
+		if patch.Archived != nil {
+			if *patch.Archived {
+				if err := checkNoActiveRecurring(txObj, id); err != nil {
+					return err
+				}
+			}
+			if _, err := txObj.Exec("UPDATE categories SET archived = ? WHERE id = ?", *patch.Archived, id); err != nil {
+				return fmt.Errorf("архивирование категории: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Category{}, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return Category{}, fmt.Errorf("commit: %w", err)
+	}
+	return l.GetCategory(id)
+}
+
+// SetCategoryParent переносит категорию id внутрь parentID (0 — на верхний уровень).
+// Нельзя сделать категорию подкатегорией самой себя или своего потомка.
+func (l *Ledger) SetCategoryParent(id, parentID int64) (Category, error) {
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Category{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	if err := checkCategory(txObj, id); err != nil {
+		return Category{}, err
+	}
+	if parentID != 0 {
+		if err := checkCategory(txObj, parentID); err != nil {
+			return Category{}, err
+		}
+		parents, err := categoryParents(txObj)
+		if err != nil {
+			return Category{}, err
+		}
+		if slices.Contains(ancestors(parents, parentID), id) {
+			return Category{}, fmt.Errorf("категория %d не может быть вложена в свою подкатегорию %d", id, parentID)
+		}
+	}
+	err = l.auditChange(txObj, auditUpdate, auditCategory, id, func() error {
+		if _, err := txObj.Exec("UPDATE categories SET parent_id = ? WHERE id = ?", nullID(parentID), id); err != nil {
+			return fmt.Errorf("перенос категории: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Category{}, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return Category{}, fmt.Errorf("commit: %w", err)
+	}
+	return l.GetCategory(id)
+}
+
+// checkKindFits возвращает errConflict, если у операций и строк разбивки
+// категории categoryID (кроме refund) знак не подходит для типа kind.
+func checkKindFits(q rowQuerier, categoryID int64, kind string) error {
+	var wrongSign int
+	if err := q.QueryRow(`
+SELECT COUNT(*) FROM `+transactionLinesSQL+`
+WHERE category_id = ? AND refund = 0
+AND ((? = 'income' AND amount_kopeks < 0) OR (? = 'expense' AND amount_kopeks > 0))`, categoryID, kind, kind).Scan(&wrongSign); err != nil {
+		return fmt.Errorf("проверка операций категории: %w", err)
+	}
+	if wrongSign > 0 {
+		return fmt.Errorf("%w: в категории %d операций с неподходящим для типа %s знаком: %d (отметьте их refund или перенесите)",
+			errConflict, categoryID, kind, wrongSign)
+	}
+	return nil
+}
+
+// SetCategoryKind меняет тип категории. Если в ней уже есть операции с
+// недопустимым для нового типа знаком (без refund), возвращает errConflict.
+func (l *Ledger) SetCategoryKind(id int64, kind string) (Category, error) {
+	if !categoryKinds[kind] {
+		return Category{}, fmt.Errorf("неизвестный тип категории %q (ожидается income, expense или neutral)", kind)
+	}
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Category{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	if err := checkCategory(txObj, id); err != nil {
+		return Category{}, err
+	}
+	if err := checkKindFits(txObj, id, kind); err != nil {
+		return Category{}, err
+	}
+	err = l.auditChange(txObj, auditUpdate, auditCategory, id, func() error {
+		if _, err := txObj.Exec("UPDATE categories SET kind = ? WHERE id = ?", kind, id); err != nil {
+			return fmt.Errorf("смена типа категории: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Category{}, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return Category{}, fmt.Errorf("commit: %w", err)
+	}
+	return l.GetCategory(id)
+}
+
+// CategoryMerge — итог слияния категорий.
+type CategoryMerge struct {
+	Target            Category
+	MovedTransactions int64
+	// BudgetMerged — бюджет исходной категории перенесён или добавлен к бюджету целевой.
+	BudgetMerged bool
+}
+
+// MergeCategories переносит в targetID всё, что ссылается на sourceID: операции,
+// строки разбивки, правила, шаблоны повторяющихся операций и профили импорта, — и удаляет sourceID.
+// Бюджет исходной категории переходит к целевой, а если он есть у обеих, лимиты
+// складываются. Подкатегории исходной переходят к её родителю.
+func (l *Ledger) MergeCategories(sourceID, targetID int64) (CategoryMerge, error) {
+	if sourceID == 0 || targetID == 0 {
+		return CategoryMerge{}, errors.New("id категорий не указаны")
+	}
+	if sourceID == targetID {
+		return CategoryMerge{}, errors.New("категорию нельзя объединить с самой собой")
+	}
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return CategoryMerge{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	if err := checkCategory(txObj, sourceID); err != nil {
+		return CategoryMerge{}, err
+	}
+	targetKind, err := categoryKind(txObj, targetID)
+	if err != nil {
+		return CategoryMerge{}, err
+	}
+	if err := checkKindFits(txObj, sourceID, targetKind); err != nil {
+		return CategoryMerge{}, err
+	}
+
+	var merge CategoryMerge
+	moved, err := categoryTransactionIDs(txObj, sourceID)
+	if err != nil {
+		return CategoryMerge{}, err
+	}
+	err = l.auditChanges(txObj, auditUpdate, auditTransaction, moved, func() error {
+		res, err := txObj.Exec("UPDATE transactions SET category_id = ? WHERE category_id = ?", targetID, sourceID)
+		if err != nil {
+			return fmt.Errorf("перенос операций: %w", err)
+		}
+		merge.MovedTransactions, _ = res.RowsAffected()
+		res, err = txObj.Exec("UPDATE transaction_splits SET category_id = ? WHERE category_id = ?", targetID, sourceID)
+		if err != nil {
+			return fmt.Errorf("перенос строк разбивки: %w", err)
+		}
+		movedSplits, _ := res.RowsAffected()
+		merge.MovedTransactions += movedSplits
+		return nil
+	})
+	if err != nil {
+		return CategoryMerge{}, err
+	}
+	err = l.auditChanges(txObj, auditMerge, auditBudget, []int64{sourceID, targetID}, func() error {
+		merge.BudgetMerged, err = mergeBudget(txObj, sourceID, targetID)
+		return err
+	})
+	if err != nil {
+		return CategoryMerge{}, err
+	}
+	for _, table := range []string{"category_rules", "recurring_templates", "import_profiles"} {
+		if _, err := txObj.Exec("UPDATE "+table+" SET category_id = ? WHERE category_id = ?", targetID, sourceID); err != nil {
+			return CategoryMerge{}, fmt.Errorf("перенос ссылок %s: %w", table, err)
+		}
+	}
+	if err := l.removeCategory(txObj, sourceID, auditMerge); err != nil {
+		return CategoryMerge{}, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return CategoryMerge{}, fmt.Errorf("commit: %w", err)
+	}
+	if merge.Target, err = l.GetCategory(targetID); err != nil {
+		return CategoryMerge{}, err
+	}
+	return merge, nil
+}
+
+// mergeBudget передаёт бюджет sourceID категории targetID. Если бюджет есть у
+// обеих, лимит исходной пересчитывается в валюту целевой по сегодняшнему курсу
+// и добавляется к её лимиту; бюджеты с разными периодами не складываются.
+func mergeBudget(txObj *sql.Tx, sourceID, targetID int64) (bool, error) {
+	type budgetRow struct {
+		limit            int64
+		currency, period string
+	}
+	read := func(categoryID int64) (budgetRow, bool, error) {
+		var b budgetRow
+		err := txObj.QueryRow("SELECT limit_kopeks, currency, period FROM budgets WHERE category_id = ?", categoryID).
+			Scan(&b.limit, &b.currency, &b.period)
+		if errors.Is(err, sql.ErrNoRows) {
+			return budgetRow{}, false, nil
+		}
+		if err != nil {
+			return budgetRow{}, false, fmt.Errorf("чтение бюджета: %w", err)
+		}
+		return b, true, nil
+	}
+
+	source, ok, err := read(sourceID)
+	if err != nil || !ok {
+		return false, err
+	}
+	target, ok, err := read(targetID)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		if _, err := txObj.Exec("UPDATE budgets SET category_id = ? WHERE category_id = ?", targetID, sourceID); err != nil {
+			return false, fmt.Errorf("перенос бюджета: %w", err)
+		}
+		return true, nil
+	}
+	if source.period != target.period {
+		return false, fmt.Errorf("%w: бюджеты категорий %d и %d на разные периоды (%s и %s), объедините их вручную",
+			errConflict, sourceID, targetID, source.period, target.period)
+	}
+	limit, err := newRateConverter(txObj).convert(source.limit, source.currency, target.currency, time.Now().UTC().Format("2006-01-02"))
+	if err != nil {
+		return false, err
+	}
+	if _, err := txObj.Exec("UPDATE budgets SET limit_kopeks = limit_kopeks + ? WHERE category_id = ?", limit, targetID); err != nil {
+		return false, fmt.Errorf("объединение бюджетов: %w", err)
+	}
+	return true, nil
+}
+
+// categoryTransactionIDs возвращает id операций категории, в том числе
+// разбитых операций со строкой в ней.
+func categoryTransactionIDs(q rowsQuerier, categoryID int64) ([]int64, error) {
+	ids, err := selectIDs(q, `
+SELECT id FROM transactions WHERE category_id = ?
+UNION SELECT transaction_id FROM transaction_splits WHERE category_id = ?`, categoryID, categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("выборка операций категории: %w", err)
+	}
+	return ids, nil
+}
+
+// removeCategory удаляет категорию, подняв её подкатегории к её родителю.
+// Оставшиеся операции и бюджет удаляются каскадом; разбитая операция со строкой
+// в этой категории удаляется целиком, чтобы сумма строк не разошлась с её суммой.
+// operation — запись журнала о самой категории (удаление или слияние).
+func (l *Ledger) removeCategory(txObj *sql.Tx, id int64, operation string) error {
+	children, err := selectIDs(txObj, "SELECT id FROM categories WHERE parent_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("выборка подкатегорий: %w", err)
+	}
+	err = l.auditChanges(txObj, auditUpdate, auditCategory, children, func() error {
+		if _, err := txObj.Exec(`
+UPDATE categories SET parent_id = (SELECT parent_id FROM categories WHERE id = ?) WHERE parent_id = ?`, id, id); err != nil {
+			return fmt.Errorf("перенос подкатегорий: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	txIDs, err := categoryTransactionIDs(txObj, id)
+	if err != nil {
+		return err
+	}
+	return l.auditChange(txObj, operation, auditCategory, id, func() error {
+		return l.auditChange(txObj, auditDelete, auditBudget, id, func() error {
+			return l.auditChanges(txObj, auditDelete, auditTransaction, txIDs, func() error {
+				if _, err := txObj.Exec(`
+DELETE FROM transactions WHERE id IN (SELECT transaction_id FROM transaction_splits WHERE category_id = ?)`, id); err != nil {
+					return fmt.Errorf("удаление разбитых операций: %w", err)
+				}
+				if _, err := txObj.Exec("DELETE FROM categories WHERE id = ?", id); err != nil {
+					return fmt.Errorf("удаление категории: %w", err)
+				}
+				return nil
+			})
+		})
+	})
+}
+
+// CategoryTree возвращает категории верхнего уровня с вложенными подкатегориями,
+// на каждом уровне — по имени. Без includeArchived архивные категории не
+// показываются, а их подкатегории поднимаются на верхний уровень.
+func (l *Ledger) CategoryTree(includeArchived bool) ([]*CategoryNode, error) {
+	cats, err := l.ListCategories(includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[int64]*CategoryNode, len(cats))
+	for _, c := range cats {
+		nodes[c.ID] = &CategoryNode{Category: c}
+	}
+	roots := []*CategoryNode{}
+	for _, c := range cats {
+		if parent, ok := nodes[c.ParentID]; ok {
+			parent.Children = append(parent.Children, nodes[c.ID])
+		} else {
+			roots = append(roots, nodes[c.ID])
+		}
+	}
+	return roots, nil
+}
+
+// categoryAncestorsJoin подключает к строкам учёта все категории-предки их
+// категории (и её саму) как ca.ancestor_id, так что группировка по нему даёт
+// сводку с подкатегориями. Строки без категории остаются с ca.ancestor_id NULL.
+const categoryAncestorsJoin = `LEFT JOIN (
+	WITH RECURSIVE anc(descendant_id, ancestor_id) AS (
+		SELECT id, id FROM categories
+		UNION ALL
+		SELECT a.descendant_id, c.parent_id FROM anc a JOIN categories c ON c.id = a.ancestor_id
+		WHERE c.parent_id IS NOT NULL
+	)
+	SELECT descendant_id, ancestor_id FROM anc
+) ca ON ca.descendant_id = transaction_lines.category_id`
+
+// KindSummary — итог операций по типу категорий в минимальных единицах Currency.
+// TotalKopeks — сумма со знаком: возвраты уменьшают расходы, сторно — доходы.
+type KindSummary struct {
+	Kind        string
+	Currency    string
+	TotalKopeks int64
+	Count       int
+}
+
+// SummaryByKind группирует сводку f по типам категорий: доходы, расходы и
+// нейтральные (к ним же относятся операции без категории).
+func (l *Ledger) SummaryByKind(f SummaryFilter) ([]KindSummary, error) {
+	f.RollUp = false
+	summary, err := l.Summary(f)
+	if err != nil {
+		return nil, err
+	}
+	kinds, err := categoryKindsByID(l.db, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []KindSummary
+	for _, s := range summary {
+		kind := kinds[s.CategoryID]
+		if kind == "" {
+			kind = categoryKindNeutral
+		}
+		i := slices.IndexFunc(out, func(k KindSummary) bool { return k.Kind == kind && k.Currency == s.Currency })
+		if i < 0 {
+			out = append(out, KindSummary{Kind: kind, Currency: s.Currency})
+			i = len(out) - 1
+		}
+		out[i].TotalKopeks += s.NetKopeks
+		out[i].Count += s.Count
+	}
+	order := map[string]int{categoryKindIncome: 0, categoryKindExpense: 1, categoryKindNeutral: 2}
+	slices.SortFunc(out, func(a, b KindSummary) int {
+		return cmp.Or(cmp.Compare(order[a.Kind], order[b.Kind]), cmp.Compare(a.Currency, b.Currency))
+	})
+	return out, nil
+}
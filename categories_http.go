@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// handleCategoryTree — GET /categories/tree: категории с вложенными подкатегориями.
+func (s *server) handleCategoryTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	includeArchived, err := parseBoolParam(r.URL.Query(), "include_archived")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	tree, err := s.ledger.CategoryTree(includeArchived)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tree)
+}
+
+// handleCategoryPatch — PATCH /categories/{id} с {"name": "...", "archived": true}:
+// переименование (занятое имя — 409) и архивирование; отсутствующие поля не меняются.
+func (s *server) handleCategoryPatch(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		Name     *string `json:"name"`
+		Archived *bool   `json:"archived"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+		return
+	}
+	cat, err := s.ledgerFor(r).UpdateCategory(id, CategoryPatch{Name: req.Name, Archived: req.Archived})
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cat)
+}
+
+// handleCategoryParent — PUT /categories/{id}/parent с {"parent_id": N}
+// переносит категорию; parent_id 0 поднимает её на верхний уровень.
+func (s *server) handleCategoryParent(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ParentID int64 `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+		return
+	}
+	cat, err := s.ledgerFor(r).SetCategoryParent(id, req.ParentID)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cat)
+}
+
+// handleCategoryKind — PUT /categories/{id}/kind с {"kind": "income"|"expense"|"neutral"}.
+func (s *server) handleCategoryKind(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+		return
+	}
+	cat, err := s.ledgerFor(r).SetCategoryKind(id, req.Kind)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cat)
+}
+
+// handleSummaryByKind — GET /summary/kinds: итоги по типам категорий с теми же
+// параметрами, что и /summary (кроме rollup).
+func (s *server) handleSummaryByKind(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := parseSummaryFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	summary, err := s.ledger.SummaryByKind(filter)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+
+	type kindResp struct {
+		Kind     string `json:"kind"`
+		Currency string `json:"currency"`
+		Total    Money  `json:"total"`
+		Count    int    `json:"count"`
+	}
+	resp := make([]kindResp, 0, len(summary))
+	for _, k := range summary {
+		resp = append(resp, kindResp{Kind: k.Kind, Currency: k.Currency, Total: fromMinorUnits(k.TotalKopeks, k.Currency), Count: k.Count})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleCategoryMerge — POST /categories/{id}/merge с {"target_id": N}: перенести всё
+// из категории id в N и удалить id.
+func (s *server) handleCategoryMerge(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		TargetID int64 `json:"target_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+		return
+	}
+	merge, err := s.ledgerFor(r).MergeCategories(id, req.TargetID)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, merge)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCategoryTreeRejectsCycles(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	groceries, err := ledger.AddCategory(Category{Name: "Groceries", ParentID: food.ID})
+	if err != nil {
+		t.Fatalf("create subcategory: %v", err)
+	}
+	fruit, _ := ledger.AddCategory(Category{Name: "Fruit", ParentID: groceries.ID})
+	if _, err := ledger.AddCategory(Category{Name: "Orphan", ParentID: 999}); !errors.Is(err, errNotFound) {
+		t.Fatalf("unknown parent must be rejected, got %v", err)
+	}
+
+	if _, err := ledger.SetCategoryParent(food.ID, fruit.ID); err == nil {
+		t.Fatal("moving a category under its descendant must fail")
+	}
+	if _, err := ledger.SetCategoryParent(food.ID, food.ID); err == nil {
+		t.Fatal("category cannot be its own parent")
+	}
+
+	tree, err := ledger.CategoryTree(false)
+	if err != nil {
+		t.Fatalf("tree: %v", err)
+	}
+	if len(tree) != 1 || len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 {
+		t.Fatalf("unexpected tree: %+v", tree)
+	}
+
+	moved, err := ledger.SetCategoryParent(fruit.ID, 0)
+	if err != nil || moved.ParentID != 0 {
+		t.Fatalf("move to top level: %+v %v", moved, err)
+	}
+}
+
+func TestRollUpCountsSplitTransactionOnce(t *testing.T) {
+	ledger := newTestLedger(t)
+	home, _ := ledger.CreateCategory("Home")
+	cleaning, _ := ledger.AddCategory(Category{Name: "Cleaning", ParentID: home.ID})
+	repairs, _ := ledger.AddCategory(Category{Name: "Repairs", ParentID: home.ID})
+
+	day := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, AmountKopeks: -3_000, OccurredAt: day, Splits: []TransactionSplit{
+		{CategoryID: cleaning.ID, AmountKopeks: -1_000},
+		{CategoryID: repairs.ID, AmountKopeks: -2_000},
+	}}); err != nil {
+		t.Fatalf("add split: %v", err)
+	}
+	if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, AmountKopeks: -500, OccurredAt: day}); err != nil {
+		t.Fatalf("add uncategorized: %v", err)
+	}
+
+	rolled, err := ledger.Summary(SummaryFilter{From: day, To: day, RollUp: true})
+	if err != nil {
+		t.Fatalf("rolled summary: %v", err)
+	}
+	if got := findSummary(rolled, home.ID); got.ExpenseKopeks != -3_000 || got.Count != 1 {
+		t.Fatalf("split operation must count once in the common parent: %+v", got)
+	}
+	if got := findSummary(rolled, repairs.ID); got.ExpenseKopeks != -2_000 || got.Count != 1 {
+		t.Fatalf("leaf keeps its own line: %+v", got)
+	}
+	if got := findSummary(rolled, 0); got.ExpenseKopeks != -500 || got.Count != 1 {
+		t.Fatalf("uncategorized row must stay as is: %+v", got)
+	}
+}
+
+func TestSummaryAndBudgetsRollUpSubcategories(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	groceries, _ := ledger.AddCategory(Category{Name: "Groceries", ParentID: food.ID})
+	restaurants, _ := ledger.AddCategory(Category{Name: "Restaurants", ParentID: food.ID})
+
+	day := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	for _, tx := range []Transaction{
+		{CategoryID: food.ID, AmountKopeks: -1_000},
+		{CategoryID: groceries.ID, AmountKopeks: -3_000},
+		{CategoryID: restaurants.ID, AmountKopeks: -5_000},
+	} {
+		tx.AccountID, tx.OccurredAt = defaultAccountID, day
+		if _, err := ledger.AddTransaction(tx); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+
+	flat, err := ledger.Summary(SummaryFilter{From: day, To: day})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if got := findSummary(flat, food.ID); got.ExpenseKopeks != -1_000 {
+		t.Fatalf("flat summary must not roll up: %+v", got)
+	}
+	rolled, err := ledger.Summary(SummaryFilter{From: day, To: day, RollUp: true})
+	if err != nil {
+		t.Fatalf("rolled summary: %v", err)
+	}
+	if got := findSummary(rolled, food.ID); got.ExpenseKopeks != -9_000 || got.Count != 3 {
+		t.Fatalf("parent must include subcategories: %+v", got)
+	}
+	if got := findSummary(rolled, groceries.ID); got.ExpenseKopeks != -3_000 {
+		t.Fatalf("leaf keeps its own total: %+v", got)
+	}
+
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 8_000, StartDate: start}); err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+	alerts, err := ledger.BudgetAlerts(day, "")
+	if err != nil {
+		t.Fatalf("alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].SpentKopeks != 9_000 || alerts[0].Severity != severityCritical {
+		t.Fatalf("budget on parent must count subcategories: %+v", alerts)
+	}
+	exceeded, err := ledger.ExceededBudgets(start, day, "")
+	if err != nil {
+		t.Fatalf("exceeded: %v", err)
+	}
+	if len(exceeded) != 1 || exceeded[0].SpentKopeks != 9_000 {
+		t.Fatalf("legacy range alerts must count subcategories: %+v", exceeded)
+	}
+}
+
+func TestCategoryKindValidatesSignAndGroupsReports(t *testing.T) {
+	ledger := newTestLedger(t)
+	salary, _ := ledger.AddCategory(Category{Name: "Salary", Kind: categoryKindIncome})
+	transport, _ := ledger.AddCategory(Category{Name: "Transport", Kind: categoryKindExpense})
+	taxi, _ := ledger.AddCategory(Category{Name: "Taxi", ParentID: transport.ID})
+	if taxi.Kind != categoryKindExpense {
+		t.Fatalf("subcategory must inherit parent kind, got %q", taxi.Kind)
+	}
+	if _, err := ledger.AddCategory(Category{Name: "Bad", Kind: "savings"}); err == nil {
+		t.Fatal("unknown kind must be rejected")
+	}
+
+	day := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	add := func(categoryID, amount int64, refund bool) (Transaction, error) {
+		return ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: categoryID, AmountKopeks: amount, OccurredAt: day, Refund: refund})
+	}
+	if _, err := add(taxi.ID, 50_000, false); err == nil {
+		t.Fatal("positive amount in expense category must be rejected")
+	}
+	if _, err := add(salary.ID, -100_000, false); err == nil {
+		t.Fatal("negative amount in income category must be rejected")
+	}
+	if _, err := add(salary.ID, 100_000, false); err != nil {
+		t.Fatalf("salary: %v", err)
+	}
+	spent, err := add(taxi.ID, -30_000, false)
+	if err != nil {
+		t.Fatalf("taxi: %v", err)
+	}
+	if _, err := add(taxi.ID, 5_000, true); err != nil {
+		t.Fatalf("refund must be accepted: %v", err)
+	}
+
+	spent.AmountKopeks = 30_000
+	if _, err := ledger.UpdateTransaction(spent); err == nil {
+		t.Fatal("update must validate sign too")
+	}
+
+	if _, err := ledger.SetCategoryKind(transport.ID, categoryKindIncome); err != nil {
+		t.Fatalf("empty parent can change kind: %v", err)
+	}
+	if _, err := ledger.SetCategoryKind(taxi.ID, categoryKindIncome); !errors.Is(err, errConflict) {
+		t.Fatalf("kind change must respect existing operations, got %v", err)
+	}
+
+	kinds, err := ledger.SummaryByKind(SummaryFilter{From: day, To: day})
+	if err != nil {
+		t.Fatalf("summary by kind: %v", err)
+	}
+	if len(kinds) != 2 || kinds[0].Kind != categoryKindIncome || kinds[0].TotalKopeks != 100_000 ||
+		kinds[1].Kind != categoryKindExpense || kinds[1].TotalKopeks != -25_000 || kinds[1].Count != 2 {
+		t.Fatalf("unexpected kinds: %+v", kinds)
+	}
+}
+
+func TestDeleteCategoryRequiresReassignOrCascade(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	cafe, _ := ledger.AddCategory(Category{Name: "Cafe", ParentID: food.ID})
+	coffee, _ := ledger.AddCategory(Category{Name: "Coffee", ParentID: cafe.ID})
+	old, _ := ledger.CreateCategory("Old")
+	empty, _ := ledger.CreateCategory("Empty")
+
+	day := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	for _, categoryID := range []int64{cafe.ID, cafe.ID, old.ID} {
+		if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: categoryID, AmountKopeks: -1_000, OccurredAt: day}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: cafe.ID, LimitKopeks: 5_000}); err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 20_000}); err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+
+	if err := ledger.DeleteCategory(cafe.ID, CategoryDeleteOptions{}); !errors.Is(err, errConflict) {
+		t.Fatalf("delete with transactions must be refused, got %v", err)
+	}
+	if err := ledger.DeleteCategory(empty.ID, CategoryDeleteOptions{}); err != nil {
+		t.Fatalf("delete empty category: %v", err)
+	}
+
+	if err := ledger.DeleteCategory(cafe.ID, CategoryDeleteOptions{ReassignTo: food.ID}); err != nil {
+		t.Fatalf("delete with reassign: %v", err)
+	}
+	summary, err := ledger.Summary(SummaryFilter{From: day, To: day})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if got := findSummary(summary, food.ID); got.Count != 2 {
+		t.Fatalf("transactions must move to target: %+v", summary)
+	}
+	budget, err := ledger.GetBudget(food.ID)
+	if err != nil || budget.LimitKopeks != 25_000 {
+		t.Fatalf("budgets must combine: %+v %v", budget, err)
+	}
+	moved, err := ledger.GetCategory(coffee.ID)
+	if err != nil || moved.ParentID != food.ID {
+		t.Fatalf("subcategory must move to the deleted category's parent: %+v %v", moved, err)
+	}
+
+	if err := ledger.DeleteCategory(old.ID, CategoryDeleteOptions{Cascade: true}); err != nil {
+		t.Fatalf("cascade delete: %v", err)
+	}
+	if summary, _ := ledger.Summary(SummaryFilter{From: day, To: day}); findSummary(summary, old.ID).Count != 0 {
+		t.Fatalf("cascade must remove transactions: %+v", summary)
+	}
+}
+
+func TestMergeCategoriesChecksKindAndMovesReferences(t *testing.T) {
+	ledger := newTestLedger(t)
+	salary, _ := ledger.AddCategory(Category{Name: "Salary", Kind: categoryKindIncome})
+	taxi, _ := ledger.AddCategory(Category{Name: "Taxi", Kind: categoryKindExpense})
+	transport, _ := ledger.AddCategory(Category{Name: "Transport", Kind: categoryKindExpense})
+
+	day := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: taxi.ID, AmountKopeks: -1_000, OccurredAt: day}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	rule, err := ledger.SaveCategoryRule(CategoryRule{CategoryID: taxi.ID, NoteContains: "такси"})
+	if err != nil {
+		t.Fatalf("rule: %v", err)
+	}
+
+	if _, err := ledger.MergeCategories(taxi.ID, salary.ID); !errors.Is(err, errConflict) {
+		t.Fatalf("merging expenses into income must be refused, got %v", err)
+	}
+	merge, err := ledger.MergeCategories(taxi.ID, transport.ID)
+	if err != nil || merge.MovedTransactions != 1 || merge.Target.ID != transport.ID {
+		t.Fatalf("merge: %+v %v", merge, err)
+	}
+	if rule, err = ledger.GetCategoryRule(rule.ID); err != nil || rule.CategoryID != transport.ID {
+		t.Fatalf("rule must follow the merge: %+v %v", rule, err)
+	}
+	if _, err := ledger.GetCategory(taxi.ID); !errors.Is(err, errNotFound) {
+		t.Fatalf("source category must be gone, got %v", err)
+	}
+}
+
+func TestRenameAndArchiveCategory(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	old, _ := ledger.CreateCategory("Old phone plan")
+
+	rename := func(id int64, name string) (Category, error) {
+		return ledger.UpdateCategory(id, CategoryPatch{Name: &name})
+	}
+	if _, err := rename(old.ID, "Food"); !errors.Is(err, errConflict) {
+		t.Fatalf("duplicate name must be a conflict, got %v", err)
+	}
+	if _, err := ledger.CreateCategory("Food"); !errors.Is(err, errConflict) {
+		t.Fatalf("duplicate create must be a conflict, got %v", err)
+	}
+	if got, err := rename(old.ID, " Mobile "); err != nil || got.Name != "Mobile" {
+		t.Fatalf("rename: %+v %v", got, err)
+	}
+
+	day := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+	past, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: old.ID, AmountKopeks: -50_000, OccurredAt: day})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	archived := true
+	if _, err := ledger.UpdateCategory(old.ID, CategoryPatch{Archived: &archived}); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	cats, err := ledger.ListCategories(false)
+	if err != nil || len(cats) != 1 || cats[0].ID != food.ID {
+		t.Fatalf("archived category must be hidden: %+v %v", cats, err)
+	}
+	if all, _ := ledger.ListCategories(true); len(all) != 2 {
+		t.Fatalf("include archived: %+v", all)
+	}
+
+	if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: old.ID, AmountKopeks: -1_000, OccurredAt: day}); !errors.Is(err, errConflict) {
+		t.Fatalf("archived category must reject new transactions, got %v", err)
+	}
+	past.Note = "за март"
+	if _, err := ledger.UpdateTransaction(past); err != nil {
+		t.Fatalf("old transactions stay editable: %v", err)
+	}
+	summary, err := ledger.Summary(SummaryFilter{From: day, To: day})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if got := findSummary(summary, old.ID); got.ExpenseKopeks != -50_000 {
+		t.Fatalf("history must keep the archived category: %+v", summary)
+	}
+}
+
+func TestArchiveCategoryRefusedWhileRecurringUsesIt(t *testing.T) {
+	ledger := newTestLedger(t)
+	gym, _ := ledger.CreateCategory("Gym")
+	tpl, err := ledger.SaveRecurring(RecurringTemplate{AccountID: defaultAccountID, CategoryID: gym.ID, AmountKopeks: -3_000,
+		Frequency: frequencyMonthly, StartDate: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("save template: %v", err)
+	}
+
+	archived := true
+	if _, err := ledger.UpdateCategory(gym.ID, CategoryPatch{Archived: &archived}); !errors.Is(err, errConflict) {
+		t.Fatalf("archiving a category of an active template must conflict, got %v", err)
+	}
+	if err := ledger.DeleteRecurring(tpl.ID); err != nil {
+		t.Fatalf("delete template: %v", err)
+	}
+	if got, err := ledger.UpdateCategory(gym.ID, CategoryPatch{Archived: &archived}); err != nil || !got.Archived {
+		t.Fatalf("archive without templates: %+v %v", got, err)
+	}
+}
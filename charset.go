@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// cp1251High — символы Windows-1251 для байтов 0x80–0xBF. Байты 0xC0–0xFF
+// соответствуют подряд идущим А–я (U+0410–U+044F) и считаются арифметически.
+var cp1251High = [64]rune{
+	0x0402, 0x0403, 0x201A, 0x0453, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x20AC, 0x2030, 0x0409, 0x2039, 0x040A, 0x040C, 0x040B, 0x040F,
+	0x0452, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0xFFFD, 0x2122, 0x0459, 0x203A, 0x045A, 0x045C, 0x045B, 0x045F,
+	0x00A0, 0x040E, 0x045E, 0x0408, 0x00A4, 0x0490, 0x00A6, 0x00A7,
+	0x0401, 0x00A9, 0x0404, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x0407,
+	0x00B0, 0x00B1, 0x0406, 0x0456, 0x0491, 0x00B5, 0x00B6, 0x00B7,
+	0x0451, 0x2116, 0x0454, 0x00BB, 0x0458, 0x0405, 0x0455, 0x0457,
+}
+
+func decodeWindows1251(b []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(b) * 2)
+	for _, c := range b {
+		switch {
+		case c < 0x80:
+			sb.WriteByte(c)
+		case c < 0xC0:
+			sb.WriteRune(cp1251High[c-0x80])
+		default:
+			sb.WriteRune(0x0410 + rune(c-0xC0))
+		}
+	}
+	return sb.String()
+}
+
+// decodeText переводит содержимое файла в UTF-8. Поддерживаются utf-8
+// (BOM отбрасывается) и windows-1251 (она же cp1251).
+func decodeText(b []byte, encoding string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "utf-8", "utf8":
+		s := strings.TrimPrefix(string(b), "\uFEFF")
+		if !utf8.ValidString(s) {
+			return "", fmt.Errorf("файл не в UTF-8: проверьте кодировку профиля")
+		}
+		return s, nil
+	case "windows-1251", "cp1251":
+		return decodeWindows1251(b), nil
+	default:
+		return "", fmt.Errorf("неподдерживаемая кодировка %q", encoding)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errNoRate = errors.New("нет курса")
+
+// baseCurrency — валюта, в которой велась книга до появления мультивалютности.
+const baseCurrency = "RUB"
+
+// currencyExponents — число знаков после запятой (minor unit) по ISO 4217
+// для валют, которые принимает приложение.
+var currencyExponents = map[string]int{
+	"RUB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"KZT": 2,
+	"BYN": 2,
+	"UAH": 2,
+	"TRY": 2,
+	"GEL": 2,
+	"AMD": 2,
+	"AED": 2,
+	"THB": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"KWD": 3,
+	"BHD": 3,
+	"OMR": 3,
+}
+
+// normalizeCurrency приводит код к верхнему регистру и проверяет, что валюта известна.
+// Пустая строка остаётся пустой: вызывающий код подставляет значение по умолчанию.
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return "", nil
+	}
+	if _, ok := currencyExponents[code]; !ok {
+		return "", fmt.Errorf("неизвестная валюта %q", code)
+	}
+	return code, nil
+}
+
+func currencyScale(code string) float64 {
+	return math.Pow10(currencyExponents[code])
+}
+
+// fromMinorUnits оборачивает сумму в минимальных единицах для ответов API;
+// обратное преобразование — parseMoney.
+func fromMinorUnits(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// SetRate сохраняет курс currency→quote на дату day (перезаписывая прежний).
+func (l *Ledger) SetRate(day time.Time, currency, quote string, rate float64) error {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return err
+	}
+	quote, err = normalizeCurrency(quote)
+	if err != nil {
+		return err
+	}
+	if currency == "" || quote == "" || currency == quote {
+		return errors.New("нужны две разные валюты")
+	}
+	if !(rate > 0) || math.IsInf(rate, 0) {
+		return errors.New("курс должен быть положительным числом")
+	}
+	if day.IsZero() {
+		return errors.New("дата курса не указана")
+	}
+	_, err = l.db.Exec(`
+INSERT INTO exchange_rates (rate_date, currency, quote, rate) VALUES (?, ?, ?, ?)
+ON CONFLICT(currency, quote, rate_date) DO UPDATE SET rate = excluded.rate
+`, day.UTC().Format("2006-01-02"), currency, quote, rate)
+	if err != nil {
+		return fmt.Errorf("сохранение курса: %w", err)
+	}
+	return nil
+}
+
+// ImportRates загружает курсы из CSV вида "date,currency,quote,rate"
+// (например "2024-05-02,USD,RUB,91.78"). Строка заголовка и пустые строки пропускаются.
+// Возвращает число сохранённых курсов.
+func (l *Ledger) ImportRates(r io.Reader) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	n := 0
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return n, fmt.Errorf("курсы, строка %d: %w", line, err)
+		}
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(rec[0]), "date") {
+			continue
+		}
+		if len(rec) != 4 {
+			return n, fmt.Errorf("курсы, строка %d: ожидается 4 поля, получено %d", line, len(rec))
+		}
+		day, err := time.Parse("2006-01-02", strings.TrimSpace(rec[0]))
+		if err != nil {
+			return n, fmt.Errorf("курсы, строка %d: дата должна быть в формате YYYY-MM-DD", line)
+		}
+		rate, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(rec[3]), ",", "."), 64)
+		if err != nil {
+			return n, fmt.Errorf("курсы, строка %d: некорректный курс", line)
+		}
+		if err := l.SetRate(day, rec[1], rec[2], rate); err != nil {
+			return n, fmt.Errorf("курсы, строка %d: %w", line, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Rate — курс из таблицы exchange_rates.
+type Rate struct {
+	Date     string
+	Currency string
+	Quote    string
+	Rate     float64
+}
+
+func (l *Ledger) ListRates(currency string) ([]Rate, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := l.db.Query(`
+SELECT rate_date, currency, quote, rate FROM exchange_rates
+WHERE (? = '' OR currency = ? OR quote = ?)
+ORDER BY rate_date DESC, currency, quote`, currency, currency, currency)
+	if err != nil {
+		return nil, fmt.Errorf("чтение курсов: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Rate
+	for rows.Next() {
+		var r Rate
+		if err := rows.Scan(&r.Date, &r.Currency, &r.Quote, &r.Rate); err != nil {
+			return nil, fmt.Errorf("scan rate: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// rateConverter переводит суммы между валютами по курсу на дату операции.
+// Берётся последний известный курс не позже этой даты: прямой, обратный
+// или кросс-курс через рубль. Найденные курсы кешируются на время одного отчёта.
+type rateConverter struct {
+	q     rowQuerier
+	cache map[string]float64
+}
+
+func newRateConverter(q rowQuerier) *rateConverter {
+	return &rateConverter{q: q, cache: make(map[string]float64)}
+}
+
+func (c *rateConverter) convert(minor int64, from, to, day string) (int64, error) {
+	if from == to || minor == 0 {
+		return minor, nil
+	}
+	rate, err := c.rate(from, to, day)
+	if err != nil {
+		return 0, err
+	}
+	major := float64(minor) / currencyScale(from)
+	return int64(math.Round(major * rate * currencyScale(to))), nil
+}
+
+func (c *rateConverter) rate(from, to, day string) (float64, error) {
+	key := from + to + day
+	if r, ok := c.cache[key]; ok {
+		return r, nil
+	}
+	r, err := c.lookup(from, to, day)
+	if errors.Is(err, errNoRate) && from != baseCurrency && to != baseCurrency {
+		var a, b float64
+		if a, err = c.lookup(from, baseCurrency, day); err == nil {
+			if b, err = c.lookup(baseCurrency, to, day); err == nil {
+				r = a * b
+			}
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errNoRate) {
+			return 0, fmt.Errorf("%w %s→%s на %s", errNoRate, from, to, day)
+		}
+		return 0, err
+	}
+	c.cache[key] = r
+	return r, nil
+}
+
+// lookup ищет прямой или обратный курс на дату day или раньше.
+func (c *rateConverter) lookup(from, to, day string) (float64, error) {
+	var rate float64
+	var inverse bool
+	err := c.q.QueryRow(`
+SELECT rate, inverse FROM (
+	SELECT rate, 0 AS inverse, rate_date FROM exchange_rates WHERE currency = ? AND quote = ? AND rate_date <= ?
+	UNION ALL
+	SELECT 1.0 / rate, 1 AS inverse, rate_date FROM exchange_rates WHERE currency = ? AND quote = ? AND rate_date <= ?
+)
+ORDER BY rate_date DESC, inverse
+LIMIT 1`, from, to, day, to, from, day).Scan(&rate, &inverse)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errNoRate
+		}
+		return 0, fmt.Errorf("чтение курса: %w", err)
+	}
+	return rate, nil
+}
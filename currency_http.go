@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// loadRatesFile подгружает курсы из локального CSV, если файл есть.
+func loadRatesFile(ledger *Ledger, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+	return ledger.ImportRates(f)
+}
+
+// handleRates поддерживает GET (список курсов, ?currency=USD) и POST.
+// POST принимает либо CSV "date,currency,quote,rate" (Content-Type: text/csv),
+// либо JSON одного курса.
+func (s *server) handleRates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rates, err := s.ledger.ListRates(r.URL.Query().Get("currency"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rates)
+	case http.MethodPost:
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			n, err := s.ledger.ImportRates(io.LimitReader(r.Body, 10<<20))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, map[string]int{"imported": n})
+			return
+		}
+
+		var req struct {
+			Date     string  `json:"date"` // YYYY-MM-DD
+			Currency string  `json:"currency"`
+			Quote    string  `json:"quote"`
+			Rate     float64 `json:"rate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		day, err := parseDate(req.Date)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.ledger.SetRate(day, req.Currency, req.Quote, req.Rate); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]int{"imported": 1})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryConvertsByTransactionDateRate(t *testing.T) {
+	ledger := newTestLedger(t)
+
+	usd, err := ledger.CreateAccount("USD card", "card", "usd")
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	if usd.Currency != "USD" {
+		t.Fatalf("expected normalized currency USD, got %q", usd.Currency)
+	}
+	food, err := ledger.CreateCategory("Food")
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+
+	n, err := ledger.ImportRates(strings.NewReader("date,currency,quote,rate\n2024-05-01,USD,RUB,90\n2024-05-10,USD,RUB,100\n"))
+	if err != nil || n != 2 {
+		t.Fatalf("import rates: n=%d err=%v", n, err)
+	}
+
+	add := func(accountID, amount int64, day int) {
+		t.Helper()
+		_, err := ledger.AddTransaction(Transaction{AccountID: accountID, CategoryID: food.ID, AmountKopeks: amount, OccurredAt: time.Date(2024, time.May, day, 0, 0, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatalf("add transaction: %v", err)
+		}
+	}
+	add(usd.ID, -1_000, 5)           // $10 по 90 (курс с 1 мая действует до 10-го)
+	add(usd.ID, -1_000, 12)          // $10 по 100
+	add(defaultAccountID, -5_000, 5) // 50 ₽
+
+	from := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC)
+
+	byCurrency, err := ledger.Summary(SummaryFilter{From: from, To: to})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if len(byCurrency) != 2 {
+		t.Fatalf("expected one row per currency, got %+v", byCurrency)
+	}
+
+	inRub, err := ledger.Summary(SummaryFilter{From: from, To: to, Currency: "RUB"})
+	if err != nil {
+		t.Fatalf("summary in RUB: %v", err)
+	}
+	got := findSummary(inRub, food.ID)
+	if got.ExpenseKopeks != -(90_000+100_000+5_000) || got.Count != 3 || got.Currency != "RUB" {
+		t.Fatalf("RUB summary unexpected: %+v", got)
+	}
+
+	// Лимит в рублях, траты в долларах пересчитываются по курсу на дату операции.
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 150_000, Currency: "RUB"}); err != nil {
+		t.Fatalf("set budget: %v", err)
+	}
+	alerts, err := ledger.ExceededBudgets(from, to, "USD")
+	if err != nil {
+		t.Fatalf("alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Currency != "USD" || alerts[0].ExceededByKopeks != 450 {
+		t.Fatalf("USD alert unexpected: %+v", alerts)
+	}
+
+	if _, err := ledger.Summary(SummaryFilter{From: from, To: to, Currency: "EUR"}); !errors.Is(err, errNoRate) {
+		t.Fatalf("expected errNoRate without EUR rates, got %v", err)
+	}
+}
+
+func TestTransactionCurrencyMustMatchAccount(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, err := ledger.CreateCategory("Food")
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	_, err = ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -100, Currency: "USD", OccurredAt: time.Now()})
+	if err == nil {
+		t.Fatal("expected error for USD transaction on RUB account")
+	}
+}
+
+func TestMinorUnitsRespectExponent(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     int64
+	}{
+		{amount: "12.34", currency: "USD", want: 1234},
+		{amount: "1500", currency: "JPY", want: 1500},
+		{amount: "1.234", currency: "BHD", want: 1234},
+	}
+	for _, tc := range tests {
+		got, err := parseMoney(tc.amount, tc.currency)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.currency, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.currency, tc.want, got)
+		}
+		if s := fromMinorUnits(got, tc.currency).String(); s != tc.amount {
+			t.Fatalf("%s: expected %q, got %q", tc.currency, tc.amount, s)
+		}
+	}
+}
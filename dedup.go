@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// normalizeNote приводит комментарий к виду, устойчивому к мелким различиям
+// между выгрузками: регистр, ё/е, лишние пробелы.
+func normalizeNote(note string) string {
+	note = strings.ToLower(note)
+	note = strings.ReplaceAll(note, "ё", "е")
+	return strings.Join(strings.Fields(note), " ")
+}
+
+// transactionFingerprint строит отпечаток импортируемой строки. ordinal — номер
+// среди одинаковых строк одной выписки (две покупки кофе за 150 ₽ в один день —
+// это две операции), поэтому повторная загрузка той же выписки совпадёт
+// построчно, а законные повторы внутри неё не склеятся.
+func transactionFingerprint(t Transaction, reference string, ordinal int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%s|%d|%s|%s|%s|%d",
+		t.AccountID,
+		t.OccurredAt.UTC().Format("2006-01-02"),
+		t.AmountKopeks,
+		t.Currency,
+		normalizeNote(t.Note),
+		strings.TrimSpace(reference),
+		ordinal,
+	)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// findByFingerprint возвращает ID операции с таким отпечатком или 0.
+func findByFingerprint(q rowQuerier, fingerprint string) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT id FROM transactions WHERE fingerprint = ?", fingerprint).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("поиск дубликата: %w", err)
+	}
+	return id, nil
+}
+
+// requestHash — отпечаток содержимого запроса для проверки Idempotency-Key.
+func requestHash(t Transaction) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%d|%d|%s|%s|%s|%s", t.AccountID, t.CategoryID, t.AmountKopeks, t.Currency, t.OccurredAt.UTC().Format(time.RFC3339), t.Note, t.Counterparty)
+	// Необязательные поля добавляются, только если заданы, чтобы не изменились хеши уже сохранённых ключей.
+	if t.Refund {
+		fmt.Fprint(h, "|refund")
+	}
+	if tags, err := normalizeTags(t.Tags); err == nil && len(tags) > 0 {
+		fmt.Fprintf(h, "|tags:%s", strings.Join(tags, ","))
+	}
+	for _, s := range t.Splits {
+		fmt.Fprintf(h, "|split:%d:%d:%s", s.CategoryID, s.AmountKopeks, s.Note)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AddTransactionIdempotent работает как AddTransaction, но запоминает key.
+// Повтор с тем же ключом и тем же содержимым возвращает ранее созданную операцию
+// и replayed == true; тот же ключ с другим содержимым — errConflict.
+func (l *Ledger) AddTransactionIdempotent(key string, t Transaction) (saved Transaction, replayed bool, err error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		saved, err = l.AddTransaction(t)
+		return saved, false, err
+	}
+	if len(key) > 255 {
+		return Transaction{}, false, errors.New("Idempotency-Key длиннее 255 символов")
+	}
+
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Transaction{}, false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	// Валюту подставляем до хеширования: запрос без currency и с валютой счёта — один и тот же.
+	if err := resolveCurrency(txObj, &t); err != nil {
+		return Transaction{}, false, err
+	}
+	t.OccurredAt = t.OccurredAt.UTC()
+	hash := requestHash(t)
+
+	var storedHash string
+	var txID int64
+	err = txObj.QueryRow("SELECT request_hash, transaction_id FROM idempotency_keys WHERE key = ?", key).Scan(&storedHash, &txID)
+	switch {
+	case err == nil:
+		if storedHash != hash {
+			return Transaction{}, false, fmt.Errorf("%w: Idempotency-Key уже использован для другого запроса", errConflict)
+		}
+		saved, err := getTransaction(txObj, txID)
+		return saved, true, err
+	case !errors.Is(err, sql.ErrNoRows):
+		return Transaction{}, false, fmt.Errorf("чтение Idempotency-Key: %w", err)
+	}
+
+	if err := categorize(txObj, &t); err != nil {
+		return Transaction{}, false, err
+	}
+	saved, err = l.addTransaction(txObj, t)
+	if err != nil {
+		return Transaction{}, false, err
+	}
+	if _, err := txObj.Exec(
+		"INSERT INTO idempotency_keys (key, request_hash, transaction_id, created_at) VALUES (?, ?, ?, ?)",
+		key, hash, saved.ID, time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return Transaction{}, false, fmt.Errorf("сохранение Idempotency-Key: %w", err)
+	}
+	if err := txObj.Commit(); err != nil {
+		return Transaction{}, false, fmt.Errorf("commit: %w", err)
+	}
+	return saved, false, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReimportSkipsDuplicatesButKeepsRepeatsWithinFile(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, err := ledger.CreateCategory("Food")
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	profile, err := ledger.SaveImportProfile(ImportProfile{
+		Name:              "Bank",
+		Delimiter:         ";",
+		HasHeader:         true,
+		DateColumn:        "date",
+		AmountColumn:      "amount",
+		DescriptionColumn: "note",
+		DateFormat:        "YYYY-MM-DD",
+		CategoryID:        food.ID,
+	})
+	if err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+
+	// Две одинаковые покупки кофе — разные операции.
+	statement := []byte("date;amount;note\n" +
+		"2024-03-01;-150;Кофе\n" +
+		"2024-03-01;-150;Кофе\n" +
+		"2024-03-02;-900;Такси\n")
+	first, err := ledger.ImportCSV(profile.ID, statement, ImportOptions{Commit: true})
+	if err != nil {
+		t.Fatalf("first import: %v", err)
+	}
+	if first.Imported != 3 || first.Skipped != 0 {
+		t.Fatalf("first import unexpected: %+v", first)
+	}
+
+	// Та же выписка с лишними пробелами и другим регистром плюс одна новая строка.
+	again := []byte("date;amount;note\n" +
+		"2024-03-01;-150;  КОФЕ\n" +
+		"2024-03-01;-150;Кофе\n" +
+		"2024-03-02;-900;Такси\n" +
+		"2024-03-03;-200;Кофе\n")
+	second, err := ledger.ImportCSV(profile.ID, again, ImportOptions{Commit: true})
+	if err != nil {
+		t.Fatalf("second import: %v", err)
+	}
+	if second.Imported != 1 || second.Skipped != 3 {
+		t.Fatalf("re-import must skip known rows: %+v", second)
+	}
+
+	flagged, err := ledger.ImportCSV(profile.ID, again, ImportOptions{OnDuplicate: duplicatesFlag})
+	if err != nil {
+		t.Fatalf("flag preview: %v", err)
+	}
+	if flagged.Failed != 4 || flagged.Rows[0].DuplicateOf != first.Rows[0].Transaction.ID {
+		t.Fatalf("flag mode must report duplicates: %+v", flagged)
+	}
+
+	if bal, _ := ledger.AccountBalance(defaultAccountID, time.Time{}); bal != -(150+150+900+200)*100 {
+		t.Fatalf("unexpected balance %d", bal)
+	}
+}
+
+func TestAddTransactionIdempotencyKey(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, err := ledger.CreateCategory("Food")
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	tx := Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -500, OccurredAt: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)}
+
+	saved, replayed, err := ledger.AddTransactionIdempotent("k1", tx)
+	if err != nil || replayed {
+		t.Fatalf("first call: replayed=%v err=%v", replayed, err)
+	}
+	again, replayed, err := ledger.AddTransactionIdempotent("k1", tx)
+	if err != nil || !replayed || again.ID != saved.ID {
+		t.Fatalf("retry must return the same transaction: %+v replayed=%v err=%v", again, replayed, err)
+	}
+
+	tx.AmountKopeks = -600
+	if _, _, err := ledger.AddTransactionIdempotent("k1", tx); !errors.Is(err, errConflict) {
+		t.Fatalf("expected errConflict for reused key, got %v", err)
+	}
+	if bal, _ := ledger.AccountBalance(defaultAccountID, time.Time{}); bal != -500 {
+		t.Fatalf("retries must not add transactions, balance=%d", bal)
+	}
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportProfile описывает, как читать выписку конкретного банка.
+// Колонки (DateColumn и т.д.) — название из заголовка или номер с 1.
+// DateFormat записывается токенами DD, MM, YYYY, YY, hh, mm, ss
+// (например "DD.MM.YYYY" или "YYYY-MM-DD hh:mm:ss").
+type ImportProfile struct {
+	ID                int64
+	Name              string
+	Delimiter         string
+	Encoding          string
+	SkipRows          int
+	HasHeader         bool
+	DateColumn        string
+	AmountColumn      string
+	DescriptionColumn string
+	// ReferenceColumn — необязательный банковский идентификатор операции, входит в отпечаток.
+	ReferenceColumn    string
+	CounterpartyColumn string
+	DateFormat         string
+	DecimalSeparator   string
+	// InvertSign для выписок, где расходы записаны положительными числами.
+	InvertSign bool
+	AccountID  int64
+	CategoryID int64
+}
+
+func (p *ImportProfile) normalize() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("название профиля пустое")
+	}
+	if p.Delimiter == "" {
+		p.Delimiter = ";"
+	}
+	if p.Delimiter == `\t` {
+		p.Delimiter = "\t"
+	}
+	if len([]rune(p.Delimiter)) != 1 {
+		return errors.New("разделитель колонок должен быть одним символом")
+	}
+	if p.Encoding == "" {
+		p.Encoding = "utf-8"
+	}
+	if _, err := decodeText(nil, p.Encoding); err != nil {
+		return err
+	}
+	if p.SkipRows < 0 {
+		return errors.New("skip_rows не может быть отрицательным")
+	}
+	if strings.TrimSpace(p.DateColumn) == "" || strings.TrimSpace(p.AmountColumn) == "" {
+		return errors.New("колонки даты и суммы обязательны")
+	}
+	if p.DateFormat == "" {
+		p.DateFormat = "DD.MM.YYYY"
+	}
+	if p.DecimalSeparator == "" {
+		p.DecimalSeparator = ","
+	}
+	if p.DecimalSeparator != "," && p.DecimalSeparator != "." {
+		return errors.New("десятичный разделитель должен быть \",\" или \".\"")
+	}
+	if !p.HasHeader {
+		for _, col := range []string{p.DateColumn, p.AmountColumn, p.DescriptionColumn, p.ReferenceColumn, p.CounterpartyColumn} {
+			if _, err := strconv.Atoi(col); col != "" && err != nil {
+				return fmt.Errorf("без строки заголовка колонка %q должна быть номером", col)
+			}
+		}
+	}
+	return nil
+}
+
+const importProfileColumns = `id, name, delimiter, encoding, skip_rows, has_header, date_column, amount_column,
+	description_column, reference_column, counterparty_column, date_format, decimal_separator, invert_sign,
+	COALESCE(account_id, 0), COALESCE(category_id, 0)`
+
+func scanImportProfile(row interface{ Scan(dest ...any) error }) (ImportProfile, error) {
+	var p ImportProfile
+	err := row.Scan(&p.ID, &p.Name, &p.Delimiter, &p.Encoding, &p.SkipRows, &p.HasHeader, &p.DateColumn, &p.AmountColumn,
+		&p.DescriptionColumn, &p.ReferenceColumn, &p.CounterpartyColumn, &p.DateFormat, &p.DecimalSeparator, &p.InvertSign, &p.AccountID, &p.CategoryID)
+	return p, err
+}
+
+// nullID превращает 0 в NULL для необязательных внешних ключей.
+func nullID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// SaveImportProfile создаёт профиль (p.ID == 0) или перезаписывает существующий.
+func (l *Ledger) SaveImportProfile(p ImportProfile) (ImportProfile, error) {
+	if err := p.normalize(); err != nil {
+		return ImportProfile{}, err
+	}
+	if p.AccountID != 0 {
+		if _, err := accountCurrency(l.db, p.AccountID); err != nil {
+			return ImportProfile{}, err
+		}
+	}
+	if p.CategoryID != 0 {
+		if err := checkCategory(l.db, p.CategoryID); err != nil {
+			return ImportProfile{}, err
+		}
+	}
+
+	args := []any{p.Name, p.Delimiter, p.Encoding, p.SkipRows, p.HasHeader, p.DateColumn, p.AmountColumn,
+		p.DescriptionColumn, p.ReferenceColumn, p.CounterpartyColumn, p.DateFormat, p.DecimalSeparator, p.InvertSign, nullID(p.AccountID), nullID(p.CategoryID)}
+	if p.ID == 0 {
+		res, err := l.db.Exec(`
+INSERT INTO import_profiles (name, delimiter, encoding, skip_rows, has_header, date_column, amount_column,
+	description_column, reference_column, counterparty_column, date_format, decimal_separator, invert_sign, account_id, category_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+		if err != nil {
+			return ImportProfile{}, fmt.Errorf("сохранение профиля импорта: %w", err)
+		}
+		p.ID, _ = res.LastInsertId()
+		return p, nil
+	}
+
+	res, err := l.db.Exec(`
+UPDATE import_profiles SET name = ?, delimiter = ?, encoding = ?, skip_rows = ?, has_header = ?, date_column = ?,
+	amount_column = ?, description_column = ?, reference_column = ?, counterparty_column = ?, date_format = ?, decimal_separator = ?, invert_sign = ?,
+	account_id = ?, category_id = ?
+WHERE id = ?`, append(args, p.ID)...)
+	if err != nil {
+		return ImportProfile{}, fmt.Errorf("обновление профиля импорта: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return ImportProfile{}, fmt.Errorf("%w: профиль импорта %d", errNotFound, p.ID)
+	}
+	return p, nil
+}
+
+func (l *Ledger) GetImportProfile(id int64) (ImportProfile, error) {
+	p, err := scanImportProfile(l.db.QueryRow("SELECT "+importProfileColumns+" FROM import_profiles WHERE id = ?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ImportProfile{}, fmt.Errorf("%w: профиль импорта %d", errNotFound, id)
+		}
+		return ImportProfile{}, fmt.Errorf("чтение профиля импорта: %w", err)
+	}
+	return p, nil
+}
+
+func (l *Ledger) ListImportProfiles() ([]ImportProfile, error) {
+	rows, err := l.db.Query("SELECT " + importProfileColumns + " FROM import_profiles ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("чтение профилей импорта: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ImportProfile
+	for rows.Next() {
+		p, err := scanImportProfile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan import profile: %w", err)
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (l *Ledger) DeleteImportProfile(id int64) error {
+	res, err := l.db.Exec("DELETE FROM import_profiles WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("удаление профиля импорта: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("%w: профиль импорта %d", errNotFound, id)
+	}
+	return nil
+}
+
+// Режимы обработки строк, которые уже были загружены раньше.
+const (
+	// duplicatesSkip — дубликат не пишется и считается в ImportReport.Skipped.
+	duplicatesSkip = "skip"
+	// duplicatesFlag — дубликат не пишется и считается ошибкой строки, чтобы его заметили.
+	duplicatesFlag = "flag"
+)
+
+// ImportOptions уточняет профиль для одной загрузки.
+type ImportOptions struct {
+	// Commit == false — только предпросмотр, в БД ничего не пишется.
+	Commit bool
+	// OnDuplicate — duplicatesSkip (по умолчанию) или duplicatesFlag.
+	OnDuplicate string
+	// AccountID и CategoryID переопределяют значения из профиля, если не 0.
+	// Явный CategoryID отключает правила; категория профиля — лишь запасной
+	// вариант для строк, к которым не подошло ни одно правило.
+	AccountID  int64
+	CategoryID int64
+}
+
+// ImportRow — результат разбора одной строки выписки. Line — номер строки в файле.
+type ImportRow struct {
+	Line        int
+	Transaction Transaction
+	Error       string
+	// DuplicateOf — ID уже существующей операции с тем же отпечатком.
+	DuplicateOf int64
+	// RuleID — правило автокатегоризации, назначившее категорию строке.
+	RuleID    int64
+	reference string
+}
+
+// ImportReport — итог предпросмотра или загрузки.
+type ImportReport struct {
+	Committed bool
+	Total     int
+	Imported  int
+	Failed    int
+	Skipped   int
+	Rows      []ImportRow
+}
+
+// ImportCSV разбирает выписку по профилю. В режиме Commit все корректные строки
+// записываются через addTransaction в одной транзакции БД; строки с ошибками
+// попадают в отчёт и пропускаются. Строки, чей отпечаток уже есть в БД,
+// не пишутся повторно (см. ImportOptions.OnDuplicate).
+func (l *Ledger) ImportCSV(profileID int64, data []byte, opts ImportOptions) (ImportReport, error) {
+	p, err := l.GetImportProfile(profileID)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	if opts.AccountID != 0 {
+		p.AccountID = opts.AccountID
+	}
+	if opts.CategoryID != 0 {
+		p.CategoryID = opts.CategoryID
+	}
+	if p.AccountID == 0 {
+		p.AccountID = defaultAccountID
+	}
+	switch opts.OnDuplicate {
+	case "":
+		opts.OnDuplicate = duplicatesSkip
+	case duplicatesSkip, duplicatesFlag:
+	default:
+		return ImportReport{}, fmt.Errorf("неизвестный режим дубликатов %q (ожидается skip или flag)", opts.OnDuplicate)
+	}
+	currency, err := accountCurrency(l.db, p.AccountID)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	rows, err := parseStatement(p, currency, data)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	report := ImportReport{Total: len(rows), Rows: rows}
+
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("begin tx: %w", err)
+	}
+	// В предпросмотре строки тоже проходят через addTransaction, чтобы проверки
+	// совпадали с настоящей загрузкой, но транзакция откатывается.
+	defer txObj.Rollback()
+
+	var rules ruleSet
+	if opts.CategoryID == 0 {
+		if rules, err = loadRuleSet(txObj); err != nil {
+			return ImportReport{}, err
+		}
+	}
+
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		if row.Error == "" {
+			if r, ok := rules.match(row.Transaction); ok {
+				row.Transaction.CategoryID = r.CategoryID
+				row.RuleID = r.ID
+			}
+			dupID, err := findByFingerprint(txObj, row.Transaction.Fingerprint)
+			if err != nil {
+				return ImportReport{}, err
+			}
+			row.DuplicateOf = dupID
+		}
+		switch {
+		case row.DuplicateOf != 0 && opts.OnDuplicate == duplicatesSkip:
+			report.Skipped++
+			continue
+		case row.DuplicateOf != 0:
+			row.Error = fmt.Sprintf("дубликат операции %d", row.DuplicateOf)
+		case row.Error == "":
+			saved, err := l.addTransaction(txObj, row.Transaction)
+			if err != nil {
+				row.Error = err.Error()
+			} else if opts.Commit {
+				row.Transaction = saved
+			}
+		}
+		if row.Error != "" {
+			report.Failed++
+		} else {
+			report.Imported++
+		}
+	}
+
+	if opts.Commit {
+		if err := txObj.Commit(); err != nil {
+			return ImportReport{}, fmt.Errorf("commit: %w", err)
+		}
+		report.Committed = true
+	}
+	return report, nil
+}
+
+// parseStatement превращает файл выписки в строки-кандидаты. Ошибка возвращается
+// только если не читается файл целиком; проблемы отдельных строк пишутся в ImportRow.Error.
+func parseStatement(p ImportProfile, currency string, data []byte) ([]ImportRow, error) {
+	text, err := decodeText(data, p.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(strings.NewReader(text))
+	cr.Comma = []rune(p.Delimiter)[0]
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	// Номера строк берём из csv.Reader: пустые строки он пропускает сам,
+	// а в отчёте пользователю нужен номер строки в исходном файле.
+	var records [][]string
+	var lines []int
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("разбор CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		records = append(records, rec)
+		lines = append(lines, line)
+	}
+	if p.SkipRows > len(records) {
+		return nil, errors.New("в файле меньше строк, чем skip_rows")
+	}
+	records, lines = records[p.SkipRows:], lines[p.SkipRows:]
+
+	var header []string
+	if p.HasHeader {
+		if len(records) == 0 {
+			return nil, errors.New("в файле нет строки заголовка")
+		}
+		header = records[0]
+		records, lines = records[1:], lines[1:]
+	}
+	dateIdx, err := columnIndex(header, p.DateColumn)
+	if err != nil {
+		return nil, err
+	}
+	amountIdx, err := columnIndex(header, p.AmountColumn)
+	if err != nil {
+		return nil, err
+	}
+	noteIdx, refIdx, counterpartyIdx := -1, -1, -1
+	if p.DescriptionColumn != "" {
+		if noteIdx, err = columnIndex(header, p.DescriptionColumn); err != nil {
+			return nil, err
+		}
+	}
+	if p.ReferenceColumn != "" {
+		if refIdx, err = columnIndex(header, p.ReferenceColumn); err != nil {
+			return nil, err
+		}
+	}
+	if p.CounterpartyColumn != "" {
+		if counterpartyIdx, err = columnIndex(header, p.CounterpartyColumn); err != nil {
+			return nil, err
+		}
+	}
+	layout := dateLayout(p.DateFormat)
+
+	var out []ImportRow
+	for i, rec := range records {
+		if isBlankRecord(rec) {
+			continue
+		}
+		row := ImportRow{Line: lines[i]}
+		t, err := parseStatementRecord(rec, dateIdx, amountIdx, noteIdx, layout, p, currency)
+		if err != nil {
+			row.Error = err.Error()
+		}
+		if refIdx >= 0 && refIdx < len(rec) {
+			row.reference = strings.TrimSpace(rec[refIdx])
+		}
+		if counterpartyIdx >= 0 && counterpartyIdx < len(rec) {
+			t.Counterparty = strings.TrimSpace(rec[counterpartyIdx])
+		}
+		row.Transaction = t
+		out = append(out, row)
+	}
+
+	seen := make(map[string]int)
+	for i := range out {
+		if out[i].Error != "" {
+			continue
+		}
+		base := transactionFingerprint(out[i].Transaction, out[i].reference, 0)
+		seen[base]++
+		out[i].Transaction.Fingerprint = transactionFingerprint(out[i].Transaction, out[i].reference, seen[base])
+	}
+	return out, nil
+}
+
+func parseStatementRecord(rec []string, dateIdx, amountIdx, noteIdx int, layout string, p ImportProfile, currency string) (Transaction, error) {
+	t := Transaction{AccountID: p.AccountID, CategoryID: p.CategoryID, Currency: currency}
+	field := func(i int) (string, error) {
+		if i >= len(rec) {
+			return "", fmt.Errorf("в строке %d колонок, нужна колонка %d", len(rec), i+1)
+		}
+		return strings.TrimSpace(rec[i]), nil
+	}
+
+	rawDate, err := field(dateIdx)
+	if err != nil {
+		return t, err
+	}
+	t.OccurredAt, err = time.Parse(layout, rawDate)
+	if err != nil {
+		return t, fmt.Errorf("дата %q не в формате %s", rawDate, p.DateFormat)
+	}
+
+	rawAmount, err := field(amountIdx)
+	if err != nil {
+		return t, err
+	}
+	amount, err := parseMoneySep(normalizeStatementAmount(rawAmount, p.DecimalSeparator), currency, ".")
+	if err != nil {
+		return t, fmt.Errorf("сумма %q: %w", rawAmount, err)
+	}
+	if p.InvertSign {
+		amount = -amount
+	}
+	t.AmountKopeks = amount
+
+	if noteIdx >= 0 {
+		if t.Note, err = field(noteIdx); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// columnIndex находит колонку по названию из заголовка (без учёта регистра) или по номеру с 1.
+func columnIndex(header []string, col string) (int, error) {
+	col = strings.TrimSpace(col)
+	if n, err := strconv.Atoi(col); err == nil {
+		if n <= 0 {
+			return 0, fmt.Errorf("номер колонки %d должен начинаться с 1", n)
+		}
+		return n - 1, nil
+	}
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), col) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("колонка %q не найдена в заголовке", col)
+}
+
+// dateLayout переводит формат профиля (DD.MM.YYYY) в layout для time.Parse.
+func dateLayout(format string) string {
+	return strings.NewReplacer(
+		"YYYY", "2006",
+		"YY", "06",
+		"MM", "01",
+		"DD", "02",
+		"hh", "15",
+		"mm", "04",
+		"ss", "05",
+	).Replace(format)
+}
+
+// normalizeStatementAmount убирает пробелы-разделители разрядов, знак валюты
+// и приводит десятичный разделитель к точке.
+func normalizeStatementAmount(s, decimalSep string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f', '\'', '₽':
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "руб."), "р.")
+	if decimalSep == "," {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.ReplaceAll(s, ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	// Некоторые банки пишут минус как U+2212 или en dash.
+	return strings.NewReplacer("−", "-", "–", "-").Replace(s)
+}
+
+func isBlankRecord(rec []string) bool {
+	for _, f := range rec {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// maxStatementSize ограничивает размер загружаемой выписки.
+const maxStatementSize = 10 << 20
+
+type importProfileReq struct {
+	Name               string `json:"name"`
+	Delimiter          string `json:"delimiter"`
+	Encoding           string `json:"encoding"`
+	SkipRows           int    `json:"skip_rows"`
+	HasHeader          *bool  `json:"has_header"` // по умолчанию true
+	DateColumn         string `json:"date_column"`
+	AmountColumn       string `json:"amount_column"`
+	DescriptionColumn  string `json:"description_column"`
+	ReferenceColumn    string `json:"reference_column"`
+	CounterpartyColumn string `json:"counterparty_column"`
+	DateFormat         string `json:"date_format"`
+	DecimalSeparator   string `json:"decimal_separator"`
+	InvertSign         bool   `json:"invert_sign"`
+	AccountID          int64  `json:"account_id"`
+	CategoryID         int64  `json:"category_id"`
+}
+
+func (req importProfileReq) profile() ImportProfile {
+	hasHeader := true
+	if req.HasHeader != nil {
+		hasHeader = *req.HasHeader
+	}
+	return ImportProfile{
+		Name:               req.Name,
+		Delimiter:          req.Delimiter,
+		Encoding:           req.Encoding,
+		SkipRows:           req.SkipRows,
+		HasHeader:          hasHeader,
+		DateColumn:         req.DateColumn,
+		AmountColumn:       req.AmountColumn,
+		DescriptionColumn:  req.DescriptionColumn,
+		ReferenceColumn:    req.ReferenceColumn,
+		CounterpartyColumn: req.CounterpartyColumn,
+		DateFormat:         req.DateFormat,
+		DecimalSeparator:   req.DecimalSeparator,
+		InvertSign:         req.InvertSign,
+		AccountID:          req.AccountID,
+		CategoryID:         req.CategoryID,
+	}
+}
+
+// handleImportProfiles поддерживает GET (список) и POST (создание) профилей импорта.
+func (s *server) handleImportProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		profiles, err := s.ledger.ListImportProfiles()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profiles)
+	case http.MethodPost:
+		var req importProfileReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		p, err := s.ledger.SaveImportProfile(req.profile())
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, p)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleImportProfileByID поддерживает GET, PUT и DELETE /import/profiles/{id}.
+func (s *server) handleImportProfileByID(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromPath(r.URL.Path, "/import/profiles/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		p, err := s.ledger.GetImportProfile(id)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	case http.MethodPut:
+		var req importProfileReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		p := req.profile()
+		p.ID = id
+		p, err := s.ledger.SaveImportProfile(p)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	case http.MethodDelete:
+		if err := s.ledger.DeleteImportProfile(id); err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleImportCSV принимает выписку: multipart/form-data с полем file или сам CSV в теле.
+// Параметры (в query или полях формы): profile_id, mode=preview|commit (по умолчанию preview),
+// duplicates=skip|flag, account_id и category_id для переопределения профиля.
+func (s *server) handleImportCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body io.Reader = r.Body
+	params := r.URL.Query()
+	if err := r.ParseMultipartForm(maxStatementSize); err == nil {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("в форме нет файла file"))
+			return
+		}
+		defer file.Close()
+		body = file
+		params = mergeValues(params, r.MultipartForm.Value)
+	} else if !errors.Is(err, http.ErrNotMultipart) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("разбор формы: %w", err))
+		return
+	}
+
+	profileID, err := parseIDParam(params, "profile_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if profileID == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("profile_id обязателен"))
+		return
+	}
+	opts, err := parseImportOptions(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxStatementSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("чтение файла: %w", err))
+		return
+	}
+	if len(data) > maxStatementSize {
+		writeError(w, http.StatusRequestEntityTooLarge, errors.New("файл выписки слишком большой"))
+		return
+	}
+
+	report, err := s.ledgerFor(r).ImportCSV(profileID, data, opts)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if report.Committed {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, report)
+}
+
+func parseImportOptions(params url.Values) (ImportOptions, error) {
+	var opts ImportOptions
+	switch params.Get("mode") {
+	case "", "preview":
+	case "commit":
+		opts.Commit = true
+	default:
+		return opts, errors.New("mode должен быть preview или commit")
+	}
+	opts.OnDuplicate = params.Get("duplicates")
+	var err error
+	if opts.AccountID, err = parseIDParam(params, "account_id"); err != nil {
+		return opts, err
+	}
+	if opts.CategoryID, err = parseIDParam(params, "category_id"); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// mergeValues дополняет query полями формы; значения из query приоритетнее.
+func mergeValues(query url.Values, form map[string][]string) url.Values {
+	out := url.Values{}
+	for k, v := range form {
+		out[k] = v
+	}
+	for k, v := range query {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImportCSVWindows1251PreviewAndCommit(t *testing.T) {
+	ledger := newTestLedger(t)
+
+	food, err := ledger.CreateCategory("Food")
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	profile, err := ledger.SaveImportProfile(ImportProfile{
+		Name:              "Bank",
+		Delimiter:         ";",
+		Encoding:          "windows-1251",
+		HasHeader:         true,
+		DateColumn:        "Дата",
+		AmountColumn:      "Сумма",
+		DescriptionColumn: "Описание",
+		DateFormat:        "DD.MM.YYYY",
+		DecimalSeparator:  ",",
+		CategoryID:        food.ID,
+	})
+	if err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+
+	// "Дата;Сумма;Описание" и т.д. в cp1251.
+	statement := encodeWindows1251(t, "Дата;Сумма;Описание\n"+
+		"01.03.2024;-1 234,50;Пятёрочка\n"+
+		"02.03.2024;abc;Ошибка\n"+
+		"\n"+
+		"03.03.2024;500,00 руб.;Возврат\n")
+
+	preview, err := ledger.ImportCSV(profile.ID, statement, ImportOptions{})
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if preview.Committed || preview.Total != 3 || preview.Imported != 2 || preview.Failed != 1 {
+		t.Fatalf("preview report unexpected: %+v", preview)
+	}
+	if preview.Rows[1].Line != 3 || preview.Rows[1].Error == "" {
+		t.Fatalf("bad row not reported with its line: %+v", preview.Rows[1])
+	}
+	if preview.Rows[2].Line != 5 {
+		t.Fatalf("line numbers must count blank lines, got %d", preview.Rows[2].Line)
+	}
+	first := preview.Rows[0].Transaction
+	if first.AmountKopeks != -123_450 || first.Note != "Пятёрочка" || !first.OccurredAt.Equal(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("first row parsed wrong: %+v", first)
+	}
+	if bal, _ := ledger.AccountBalance(defaultAccountID, time.Time{}); bal != 0 {
+		t.Fatalf("preview must not write, balance=%d", bal)
+	}
+
+	report, err := ledger.ImportCSV(profile.ID, statement, ImportOptions{Commit: true})
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if !report.Committed || report.Imported != 2 || report.Rows[0].Transaction.ID == 0 {
+		t.Fatalf("commit report unexpected: %+v", report)
+	}
+	if bal, _ := ledger.AccountBalance(defaultAccountID, time.Time{}); bal != -73_450 {
+		t.Fatalf("balance after import expected -73450, got %d", bal)
+	}
+}
+
+// encodeWindows1251 — обратное к decodeWindows1251 преобразование для тестовых данных.
+func encodeWindows1251(t *testing.T, s string) []byte {
+	t.Helper()
+	reverse := make(map[rune]byte, len(cp1251High))
+	for i, r := range cp1251High {
+		reverse[r] = byte(0x80 + i)
+	}
+	var out []byte
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			out = append(out, byte(r))
+		case r >= 0x0410 && r <= 0x044F:
+			out = append(out, byte(0xC0+r-0x0410))
+		case reverse[r] != 0:
+			out = append(out, reverse[r])
+		default:
+			t.Fatalf("rune %q is not representable in cp1251", r)
+		}
+	}
+	return out
+}
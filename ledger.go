@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"math"
 	"os"
 	"path/filepath"
 	"time"
@@ -14,49 +13,131 @@ import (
 
 var errNotFound = errors.New("not found")
 
+// errValidation — запрос к отчёту, который нельзя выполнить с такими параметрами.
+var errValidation = errors.New("некорректный запрос")
+
+// rowQuerier — общее у *sql.DB и *sql.Tx для точечных проверок.
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// querier — *sql.DB или *sql.Tx, когда нужны и точечные, и многострочные выборки.
+type querier interface {
+	rowQuerier
+	rowsQuerier
+}
+
 // Category описывает пользовательскую категорию расходов/доходов.
+// ParentID == 0 у категорий верхнего уровня. Kind задаёт допустимый знак
+// операций: categoryKindIncome, categoryKindExpense или categoryKindNeutral.
+// Archived-категория скрыта из списка и не принимает новые операции.
 type Category struct {
-	ID   int64
-	Name string
+	ID       int64
+	Name     string
+	ParentID int64
+	Kind     string
+	Archived bool
 }
 
-// Transaction хранит одну операцию: доход (плюс) или расход (минус) в копейках.
+// Transaction хранит одну операцию: доход (плюс) или расход (минус) в минимальных
+// единицах валюты счёта (для рублей — в копейках).
 type Transaction struct {
 	ID           int64
+	AccountID    int64
 	CategoryID   int64
 	AmountKopeks int64
+	Currency     string
 	OccurredAt   time.Time
 	Note         string
+	Counterparty string
+	// TransferID != 0 у ног перевода между счетами; у таких строк нет категории.
+	TransferID int64
+	// Fingerprint заполняется при импорте выписки и защищает от повторной загрузки.
+	Fingerprint string
+	// Refund разрешает знак, противоположный типу категории (возврат покупки, сторно дохода).
+	Refund bool
+	// Tags — имена меток операции. В UpdateTransaction nil оставляет метки как есть.
+	Tags []string
+	// Splits — разбивка суммы по категориям; у операции с разбивкой CategoryID == 0.
+	// В UpdateTransaction nil без CategoryID оставляет разбивку как есть, а
+	// указанная CategoryID её снимает.
+	Splits []TransactionSplit
 }
 
 // CategorySummary агрегирует суммы и количество транзакций за период.
+// Суммы — в минимальных единицах Currency.
 type CategorySummary struct {
 	CategoryID    int64
+	Currency      string
 	IncomeKopeks  int64
 	ExpenseKopeks int64
 	NetKopeks     int64
 	Count         int
 }
 
-// Budget хранит лимит на категорию (в копейках).
+// SummaryFilter задаёт период сводки и необязательный фильтр по счёту.
+// Если Currency пустая, суммы группируются по валютам операций без пересчёта;
+// иначе всё пересчитывается в Currency по курсу на дату каждой операции.
+type SummaryFilter struct {
+	From      time.Time
+	To        time.Time
+	AccountID int64
+	Currency  string
+	// RollUp добавляет к строке каждой категории операции всех её подкатегорий.
+	RollUp bool
+	// KnownAt, если задан, считает сводку по операциям в том виде, в каком они
+	// были известны в этот момент (по журналу аудита): поздние правки не учитываются.
+	KnownAt time.Time
+}
+
+// Budget хранит лимит на категорию вместе с её подкатегориями (в минимальных
+// единицах Currency) на каждый период Period, отсчитываемый от StartDate. С Rollover недорасход прошлых
+// периодов увеличивает лимит текущего, а перерасход — уменьшает.
 type Budget struct {
-	CategoryID   int64
-	LimitKopeks  int64
+	CategoryID  int64
+	LimitKopeks int64 // базовый лимит периода
+	Currency    string
+	Period      string
+	StartDate   time.Time
+	Rollover    bool
+	// Thresholds — пороги предупреждений в процентах от действующего лимита (1–100), по возрастанию.
+	Thresholds   []int
 	CategoryName string
+	// CarriedKopeks и EffectiveLimitKopeks описывают текущий период и
+	// заполняются при чтении: EffectiveLimitKopeks = LimitKopeks + CarriedKopeks.
+	CarriedKopeks        int64
+	EffectiveLimitKopeks int64
 }
 
-// BudgetAlert сигнализирует о превышении лимита.
+// BudgetAlert сигнализирует о превышении лимита, пройденном пороге или прогнозе
+// перерасхода за период [PeriodStart, PeriodEnd] (обе даты включительно).
+// LimitKopeks — действующий лимит с учётом переноса CarriedKopeks,
+// BaseLimitKopeks — лимит из бюджета. Суммы — в Currency.
 type BudgetAlert struct {
-	CategoryID       int64
-	CategoryName     string
+	CategoryID   int64
+	CategoryName string
+	Currency     string
+	Period       string
+	PeriodStart  time.Time
+	PeriodEnd    time.Time
+	// Severity — severityCritical, severityWarning или severityInfo.
+	Severity         string
+	ThresholdPercent int // наибольший пройденный порог, 0 — ни одного
+	UsedPercent      int
 	LimitKopeks      int64
+	BaseLimitKopeks  int64
+	CarriedKopeks    int64
 	SpentKopeks      int64
-	ExceededByKopeks int64
+	ExceededByKopeks int64 // 0, если лимит не превышен
+	// ForecastKopeks — траты к концу периода при сохранении текущего темпа.
+	ForecastKopeks int64
 }
 
 // Ledger работает поверх SQLite.
 type Ledger struct {
 	db *sql.DB
+	// actor — автор изменений для журнала аудита (см. WithActor).
+	actor string
 }
 
 func NewLedger(db *sql.DB) *Ledger {
@@ -71,7 +152,8 @@ func ensureDataDir(path string) error {
 	return os.MkdirAll(dir, 0o755)
 }
 
-// InitDB создаёт файл БД (если нет) и накатывает минимальную схему.
+// InitDB создаёт файл БД (если нет) и применяет недостающие миграции.
+// Если БД создана более новой версией приложения, возвращает errSchemaTooNew.
 func InitDB(path string) (*sql.DB, error) {
 	if err := ensureDataDir(path); err != nil {
 		return nil, fmt.Errorf("создание директории данных: %w", err)
@@ -82,24 +164,7 @@ func InitDB(path string) (*sql.DB, error) {
 		return nil, fmt.Errorf("открытие БД: %w", err)
 	}
 
-	schema := `
-CREATE TABLE IF NOT EXISTS categories (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	name TEXT NOT NULL UNIQUE
-);
-CREATE TABLE IF NOT EXISTS budgets (
-	category_id INTEGER PRIMARY KEY REFERENCES categories(id) ON DELETE CASCADE,
-	limit_kopeks INTEGER NOT NULL
-);
-CREATE TABLE IF NOT EXISTS transactions (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
-	amount_kopeks INTEGER NOT NULL,
-	occurred_at TEXT NOT NULL,
-	note TEXT NOT NULL DEFAULT ''
-);
-`
-	if _, err := db.Exec(schema); err != nil {
+	if err := migrate(db); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("миграция схемы: %w", err)
 	}
@@ -107,20 +172,67 @@ CREATE TABLE IF NOT EXISTS transactions (
 	return db, nil
 }
 
+// CreateCategory создаёт нейтральную категорию верхнего уровня.
 func (l *Ledger) CreateCategory(name string) (Category, error) {
-	if name == "" {
+	return l.AddCategory(Category{Name: name})
+}
+
+// AddCategory создаёт категорию c внутри c.ParentID (0 — верхний уровень).
+// Без Kind подкатегория наследует тип родителя, а категория верхнего уровня
+// становится нейтральной.
+func (l *Ledger) AddCategory(c Category) (Category, error) {
+	if c.Name == "" {
 		return Category{}, errors.New("название категории пустое")
 	}
-	res, err := l.db.Exec("INSERT INTO categories (name) VALUES (?)", name)
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Category{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	if err := checkCategoryName(txObj, c.Name, 0); err != nil {
+		return Category{}, err
+	}
+	if c.ParentID != 0 {
+		parentKind, err := categoryKind(txObj, c.ParentID)
+		if err != nil {
+			return Category{}, err
+		}
+		if c.Kind == "" {
+			c.Kind = parentKind
+		}
+	}
+	if c.Kind == "" {
+		c.Kind = categoryKindNeutral
+	}
+	if !categoryKinds[c.Kind] {
+		return Category{}, fmt.Errorf("неизвестный тип категории %q (ожидается income, expense или neutral)", c.Kind)
+	}
+	res, err := txObj.Exec("INSERT INTO categories (name, parent_id, kind) VALUES (?, ?, ?)", c.Name, nullID(c.ParentID), c.Kind)
 	if err != nil {
 		return Category{}, fmt.Errorf("сохранение категории: %w", err)
 	}
-	id, _ := res.LastInsertId()
-	return Category{ID: id, Name: name}, nil
+	c.ID, _ = res.LastInsertId()
+	if err := l.audit(txObj, auditCreate, auditCategory, c.ID, nil, c); err != nil {
+		return Category{}, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return Category{}, fmt.Errorf("commit: %w", err)
+	}
+	return c, nil
 }
 
-func (l *Ledger) ListCategories() ([]Category, error) {
-	rows, err := l.db.Query("SELECT id, name FROM categories ORDER BY name")
+const categoryColumns = `id, name, COALESCE(parent_id, 0), kind, archived`
+
+func scanCategory(row interface{ Scan(dest ...any) error }) (Category, error) {
+	var c Category
+	err := row.Scan(&c.ID, &c.Name, &c.ParentID, &c.Kind, &c.Archived)
+	return c, err
+}
+
+// ListCategories возвращает категории по имени; архивные — только с includeArchived.
+func (l *Ledger) ListCategories(includeArchived bool) ([]Category, error) {
+	rows, err := l.db.Query("SELECT "+categoryColumns+" FROM categories WHERE (? OR archived = 0) ORDER BY name", includeArchived)
 	if err != nil {
 		return nil, fmt.Errorf("чтение категорий: %w", err)
 	}
@@ -128,8 +240,8 @@ func (l *Ledger) ListCategories() ([]Category, error) {
 
 	var out []Category
 	for rows.Next() {
-		var c Category
-		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+		c, err := scanCategory(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan category: %w", err)
 		}
 		out = append(out, c)
@@ -137,121 +249,364 @@ func (l *Ledger) ListCategories() ([]Category, error) {
 	return out, rows.Err()
 }
 
-func (l *Ledger) DeleteCategory(id int64) error {
+// CategoryDeleteOptions задаёт, что делать с операциями удаляемой категории.
+type CategoryDeleteOptions struct {
+	// ReassignTo — категория, которая получит операции, бюджет, правила и шаблоны
+	// удаляемой (см. MergeCategories).
+	ReassignTo int64
+	// Cascade удаляет категорию вместе со всеми её операциями и бюджетом.
+	Cascade bool
+}
+
+// DeleteCategory удаляет категорию. Если в ней есть операции, нужен либо
+// opts.ReassignTo, либо явный opts.Cascade, иначе возвращается errConflict.
+// Подкатегории переходят к родителю удалённой категории.
+func (l *Ledger) DeleteCategory(id int64, opts CategoryDeleteOptions) error {
 	if id == 0 {
 		return errors.New("id категории не указан")
 	}
-	res, err := l.db.Exec("DELETE FROM categories WHERE id = ?", id)
-	if err != nil {
-		return fmt.Errorf("удаление категории: %w", err)
+	if opts.ReassignTo != 0 {
+		if opts.Cascade {
+			return errors.New("укажите либо категорию для переноса, либо cascade, но не оба")
+		}
+		_, err := l.MergeCategories(id, opts.ReassignTo)
+		return err
 	}
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
-		return fmt.Errorf("%w: категория %d", errNotFound, id)
+
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
 	}
-	return nil
-}
+	defer txObj.Rollback()
 
-func (l *Ledger) AddTransaction(categoryID int64, amountKopeks int64, occurredAt time.Time, note string) (Transaction, error) {
-	if categoryID == 0 {
-		return Transaction{}, errors.New("categoryID не указан")
+	if err := checkCategory(txObj, id); err != nil {
+		return err
 	}
-	if occurredAt.IsZero() {
-		return Transaction{}, errors.New("дата операции не указана")
+	if !opts.Cascade {
+		// Считаем и операции в корзине: удаление категории стирает их насовсем,
+		// и восстановить их было бы уже нельзя.
+		var count int
+		if err := txObj.QueryRow(`
+SELECT (SELECT COUNT(*) FROM transactions WHERE category_id = ?)
+	+ (SELECT COUNT(*) FROM transaction_splits WHERE category_id = ?)`, id, id).Scan(&count); err != nil {
+			return fmt.Errorf("проверка операций категории: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: в категории %d операций (с корзиной): %d; укажите категорию для переноса или cascade", errConflict, id, count)
+		}
+	}
+	if err := l.removeCategory(txObj, id, auditDelete); err != nil {
+		return err
+	}
+	if err := txObj.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
 	}
-	occurredAt = occurredAt.UTC()
+	return nil
+}
 
+// AddTransaction сохраняет операцию t и возвращает её с присвоенным ID.
+// Без категории операция проходит через правила автокатегоризации; если ни одно
+// не подошло, она сохраняется без категории.
+func (l *Ledger) AddTransaction(t Transaction) (Transaction, error) {
 	txObj, err := l.db.Begin()
 	if err != nil {
 		return Transaction{}, fmt.Errorf("begin tx: %w", err)
 	}
-
-	// Убедимся, что категория существует.
-	var exists int
-	if err := txObj.QueryRow("SELECT 1 FROM categories WHERE id = ?", categoryID).Scan(&exists); err != nil {
+	if err := categorize(txObj, &t); err != nil {
 		txObj.Rollback()
-		if errors.Is(err, sql.ErrNoRows) {
-			return Transaction{}, fmt.Errorf("%w: категория %d", errNotFound, categoryID)
+		return Transaction{}, err
+	}
+	t, err = l.addTransaction(txObj, t)
+	if err != nil {
+		txObj.Rollback()
+		return Transaction{}, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return Transaction{}, fmt.Errorf("commit: %w", err)
+	}
+	return t, nil
+}
+
+// addTransaction — тело AddTransaction внутри уже открытой транзакции БД;
+// через него пакетные операции (импорт) пишут много строк атомарно.
+// Каждая созданная операция попадает в журнал аудита.
+func (l *Ledger) addTransaction(txObj *sql.Tx, t Transaction) (Transaction, error) {
+	if t.AccountID == 0 {
+		return Transaction{}, errors.New("accountID не указан")
+	}
+	if t.OccurredAt.IsZero() {
+		return Transaction{}, errors.New("дата операции не указана")
+	}
+	t.OccurredAt = t.OccurredAt.UTC()
+
+	// Убедимся, что категория (если указана) существует, не в архиве и допускает знак суммы, а счёт существует.
+	if len(t.Splits) > 0 {
+		if err := checkSplits(txObj, t, nil); err != nil {
+			return Transaction{}, err
+		}
+	} else if t.CategoryID != 0 {
+		if err := checkCategorySign(txObj, t); err != nil {
+			return Transaction{}, err
 		}
-		return Transaction{}, fmt.Errorf("проверка категории: %w", err)
+		if err := checkCategoryActive(txObj, t.CategoryID); err != nil {
+			return Transaction{}, err
+		}
+	}
+	if err := resolveCurrency(txObj, &t); err != nil {
+		return Transaction{}, err
 	}
 
+	var fingerprint any
+	if t.Fingerprint != "" {
+		fingerprint = t.Fingerprint
+	}
 	res, err := txObj.Exec(
-		"INSERT INTO transactions (category_id, amount_kopeks, occurred_at, note) VALUES (?, ?, ?, ?)",
-		categoryID,
-		amountKopeks,
-		occurredAt.Format(time.RFC3339),
-		note,
+		"INSERT INTO transactions (account_id, category_id, amount_kopeks, currency, occurred_at, note, counterparty, fingerprint, refund, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		t.AccountID,
+		nullID(t.CategoryID),
+		t.AmountKopeks,
+		t.Currency,
+		t.OccurredAt.Format(time.RFC3339),
+		t.Note,
+		t.Counterparty,
+		fingerprint,
+		t.Refund,
+		time.Now().UTC().Format(time.RFC3339),
 	)
 	if err != nil {
-		txObj.Rollback()
 		return Transaction{}, fmt.Errorf("сохранение транзакции: %w", err)
 	}
-	id, _ := res.LastInsertId()
+	t.ID, _ = res.LastInsertId()
+	if len(t.Splits) > 0 {
+		if err := setTransactionSplits(txObj, t.ID, t.Splits); err != nil {
+			return Transaction{}, err
+		}
+	} else {
+		t.Splits = nil
+	}
+	if len(t.Tags) > 0 {
+		if t.Tags, err = setTransactionTags(txObj, t.ID, t.Tags); err != nil {
+			return Transaction{}, err
+		}
+	}
+	if err := l.audit(txObj, auditCreate, auditTransaction, t.ID, nil, t); err != nil {
+		return Transaction{}, err
+	}
+	return t, nil
+}
 
-	if err := txObj.Commit(); err != nil {
-		return Transaction{}, fmt.Errorf("commit: %w", err)
+// transactionColumns — список колонок для scanTransaction.
+const transactionColumns = `id, account_id, COALESCE(category_id, 0), amount_kopeks, currency, occurred_at, note,
+	counterparty, COALESCE(transfer_id, 0), COALESCE(fingerprint, ''), refund`
+
+func scanTransaction(row interface{ Scan(dest ...any) error }) (Transaction, error) {
+	var t Transaction
+	var ts string
+	if err := row.Scan(&t.ID, &t.AccountID, &t.CategoryID, &t.AmountKopeks, &t.Currency, &ts, &t.Note, &t.Counterparty, &t.TransferID, &t.Fingerprint, &t.Refund); err != nil {
+		return Transaction{}, err
 	}
+	t.OccurredAt, _ = time.Parse(time.RFC3339, ts)
+	return t, nil
+}
 
-	return Transaction{
-		ID:           id,
-		CategoryID:   categoryID,
-		AmountKopeks: amountKopeks,
-		OccurredAt:   occurredAt,
-		Note:         note,
-	}, nil
+func getTransaction(q querier, id int64) (Transaction, error) {
+	t, err := scanTransaction(q.QueryRow("SELECT "+transactionColumns+" FROM transactions WHERE id = ?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Transaction{}, fmt.Errorf("%w: транзакция %d", errNotFound, id)
+		}
+		return Transaction{}, fmt.Errorf("чтение транзакции: %w", err)
+	}
+	tags, err := loadTransactionTags(q, []int64{id})
+	if err != nil {
+		return Transaction{}, err
+	}
+	t.Tags = tags[id]
+	splits, err := loadTransactionSplits(q, []int64{id})
+	if err != nil {
+		return Transaction{}, err
+	}
+	t.Splits = splits[id]
+	return t, nil
 }
 
-func (l *Ledger) UpdateTransaction(id int64, categoryID int64, amountKopeks int64, occurredAt time.Time, note string) (Transaction, error) {
-	if id == 0 {
+func (l *Ledger) GetTransaction(id int64) (Transaction, error) {
+	return getTransaction(l.db, id)
+}
+
+// UpdateTransaction перезаписывает операцию t.ID значениями из t.
+func (l *Ledger) UpdateTransaction(t Transaction) (Transaction, error) {
+	if t.ID == 0 {
 		return Transaction{}, errors.New("id операции не указан")
 	}
-	if categoryID == 0 {
-		return Transaction{}, errors.New("categoryID не указан")
+	if t.AccountID == 0 {
+		return Transaction{}, errors.New("accountID не указан")
 	}
-	if occurredAt.IsZero() {
+	if t.OccurredAt.IsZero() {
 		return Transaction{}, errors.New("дата операции не указана")
 	}
+	t.OccurredAt = t.OccurredAt.UTC()
 
 	txObj, err := l.db.Begin()
 	if err != nil {
 		return Transaction{}, fmt.Errorf("begin tx: %w", err)
 	}
-	var exists int
-	if err := txObj.QueryRow("SELECT 1 FROM categories WHERE id = ?", categoryID).Scan(&exists); err != nil {
+	if err := resolveCurrency(txObj, &t); err != nil {
+		txObj.Rollback()
+		return Transaction{}, err
+	}
+
+	var transferID, prevCategoryID sql.NullInt64
+	if err := txObj.QueryRow("SELECT transfer_id, category_id FROM transactions WHERE id = ? AND deleted_at IS NULL", t.ID).Scan(&transferID, &prevCategoryID); err != nil {
 		txObj.Rollback()
 		if errors.Is(err, sql.ErrNoRows) {
-			return Transaction{}, fmt.Errorf("%w: категория %d", errNotFound, categoryID)
+			return Transaction{}, fmt.Errorf("%w: транзакция %d", errNotFound, t.ID)
+		}
+		return Transaction{}, fmt.Errorf("чтение транзакции: %w", err)
+	}
+	if transferID.Valid {
+		txObj.Rollback()
+		return Transaction{}, fmt.Errorf("%w: транзакция %d — часть перевода %d, меняйте перевод целиком", errConflict, t.ID, transferID.Int64)
+	}
+	before, err := getTransaction(txObj, t.ID)
+	if err != nil {
+		txObj.Rollback()
+		return Transaction{}, err
+	}
+	if t.Splits == nil && t.CategoryID == 0 {
+		t.Splits = before.Splits
+	}
+	if len(t.Splits) > 0 {
+		err = checkSplits(txObj, t, before.Splits)
+	} else if t.CategoryID == 0 {
+		err = errors.New("categoryID не указан")
+	} else {
+		err = checkCategorySign(txObj, t)
+		// Старые операции архивной категории можно править, но переносить в неё новые — нельзя.
+		if err == nil && prevCategoryID.Int64 != t.CategoryID {
+			err = checkCategoryActive(txObj, t.CategoryID)
 		}
-		return Transaction{}, fmt.Errorf("проверка категории: %w", err)
+	}
+	if err != nil {
+		txObj.Rollback()
+		return Transaction{}, err
 	}
 
-	res, err := txObj.Exec(`
+	if _, err := txObj.Exec(`
 UPDATE transactions
-SET category_id = ?, amount_kopeks = ?, occurred_at = ?, note = ?
-WHERE id = ?`, categoryID, amountKopeks, occurredAt.UTC().Format(time.RFC3339), note, id)
-	if err != nil {
+SET account_id = ?, category_id = ?, amount_kopeks = ?, currency = ?, occurred_at = ?, note = ?, counterparty = ?, refund = ?
+WHERE id = ?`, t.AccountID, nullID(t.CategoryID), t.AmountKopeks, t.Currency, t.OccurredAt.Format(time.RFC3339), t.Note, t.Counterparty, t.Refund, t.ID); err != nil {
 		txObj.Rollback()
 		return Transaction{}, fmt.Errorf("обновление транзакции: %w", err)
 	}
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
+	if err := setTransactionSplits(txObj, t.ID, t.Splits); err != nil {
 		txObj.Rollback()
-		return Transaction{}, fmt.Errorf("%w: транзакция %d", errNotFound, id)
+		return Transaction{}, err
+	}
+	if len(t.Splits) == 0 {
+		t.Splits = nil
+	}
+	if t.Tags != nil {
+		t.Tags, err = setTransactionTags(txObj, t.ID, t.Tags)
+	} else {
+		var tags map[int64][]string
+		tags, err = loadTransactionTags(txObj, []int64{t.ID})
+		t.Tags = tags[t.ID]
+	}
+	if err != nil {
+		txObj.Rollback()
+		return Transaction{}, err
+	}
+	after, err := getTransaction(txObj, t.ID)
+	if err == nil {
+		err = l.audit(txObj, auditUpdate, auditTransaction, t.ID, before, after)
+	}
+	if err != nil {
+		txObj.Rollback()
+		return Transaction{}, err
 	}
 	if err := txObj.Commit(); err != nil {
 		return Transaction{}, fmt.Errorf("commit: %w", err)
 	}
-	return Transaction{
-		ID:           id,
-		CategoryID:   categoryID,
-		AmountKopeks: amountKopeks,
-		OccurredAt:   occurredAt.UTC(),
-		Note:         note,
-	}, nil
+	return t, nil
 }
 
-func (l *Ledger) Summary(from, to time.Time) ([]CategorySummary, error) {
+// resolveCurrency проверяет счёт операции и подставляет его валюту, если она не указана.
+// Операция всегда в валюте своего счёта, иначе остаток счёта сложил бы разные валюты.
+func resolveCurrency(q rowQuerier, t *Transaction) error {
+	accCurrency, err := accountCurrency(q, t.AccountID)
+	if err != nil {
+		return err
+	}
+	currency, err := normalizeCurrency(t.Currency)
+	if err != nil {
+		return err
+	}
+	if currency != "" && currency != accCurrency {
+		return fmt.Errorf("валюта операции %s не совпадает с валютой счёта %s", currency, accCurrency)
+	}
+	t.Currency = accCurrency
+	return nil
+}
+
+// checkCategory проверяет существование категории (в том числе внутри транзакции БД).
+func checkCategory(q rowQuerier, categoryID int64) error {
+	var exists int
+	if err := q.QueryRow("SELECT 1 FROM categories WHERE id = ?", categoryID).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: категория %d", errNotFound, categoryID)
+		}
+		return fmt.Errorf("проверка категории: %w", err)
+	}
+	return nil
+}
+
+// Summary агрегирует операции по категориям. Переводы между счетами не являются
+// ни доходом, ни расходом и в сводку не попадают. Операции без категории
+// собираются в строку с CategoryID == 0, а каждая строка разбивки учитывается
+// в своей категории.
+func (l *Ledger) Summary(f SummaryFilter) ([]CategorySummary, error) {
+	keyExpr, joins := "COALESCE(category_id, 0)", ""
+	if f.RollUp {
+		// Группы по предкам в SQL, а не сложением строк подкатегорий: так
+		// COUNT(DISTINCT id) не считает дважды разбитую операцию со строками
+		// в двух подкатегориях одного родителя.
+		keyExpr, joins = "COALESCE(ca.ancestor_id, 0)", categoryAncestorsJoin
+	}
+	groups, err := l.aggregate(f, keyExpr, joins)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]CategorySummary, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, CategorySummary{
+			CategoryID:    g.key,
+			Currency:      g.currency,
+			IncomeKopeks:  g.income,
+			ExpenseKopeks: g.expense,
+			NetKopeks:     g.income + g.expense,
+			Count:         g.count,
+		})
+	}
+	return out, nil
+}
+
+// groupTotals — доходы и расходы одной группы сводки в одной валюте.
+type groupTotals struct {
+	key      int64
+	currency string
+	income   int64
+	expense  int64
+	count    int
+}
+
+// aggregate считает доходы и расходы за период f, группируя операции по
+// выражению keyExpr (и валюте) по строкам transactionLinesSQL, так что части
+// разбитой операции попадают каждая в свою группу. joins подключает таблицы,
+// нужные keyExpr. Count — число разных операций в группе.
+// Результат отсортирован по ключу и валюте.
+func (l *Ledger) aggregate(f SummaryFilter, keyExpr, joins string) ([]groupTotals, error) {
+	from, to := f.From, f.To
 	if to.Before(from) {
 		from, to = to, from
 	}
@@ -261,70 +616,191 @@ func (l *Ledger) Summary(from, to time.Time) ([]CategorySummary, error) {
 	if to.IsZero() {
 		to = time.Now().UTC()
 	}
+	target, err := normalizeCurrency(f.Currency)
+	if err != nil {
+		return nil, err
+	}
 
+	source, args, err := l.linesSource(f.KnownAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Для пересчёта нужен курс на дату операции, поэтому группируем ещё и по дню.
+	dayExpr := "''"
+	if target != "" {
+		dayExpr = "substr(occurred_at, 1, 10)"
+	}
 	rows, err := l.db.Query(`
 SELECT
-	category_id,
+	`+keyExpr+` AS grp,
+	currency,
+	`+dayExpr+` AS day,
 	SUM(CASE WHEN amount_kopeks >= 0 THEN amount_kopeks ELSE 0 END) AS income,
 	SUM(CASE WHEN amount_kopeks < 0 THEN amount_kopeks ELSE 0 END) AS expense,
-	SUM(amount_kopeks) AS net,
-	COUNT(*) AS cnt
-FROM transactions
+	COUNT(DISTINCT id) AS cnt
+FROM `+source+` `+joins+`
 WHERE occurred_at BETWEEN ? AND ?
-GROUP BY category_id
-`, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+AND transfer_id IS NULL
+AND (? = 0 OR account_id = ?)
+GROUP BY grp, currency, day
+ORDER BY grp, currency
+`, append(args, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), f.AccountID, f.AccountID)...)
 	if err != nil {
 		return nil, fmt.Errorf("сводка: %w", err)
 	}
 	defer rows.Close()
 
-	var out []CategorySummary
+	conv := newRateConverter(l.db)
+	var out []groupTotals
 	for rows.Next() {
-		var s CategorySummary
-		if err := rows.Scan(&s.CategoryID, &s.IncomeKopeks, &s.ExpenseKopeks, &s.NetKopeks, &s.Count); err != nil {
+		var g groupTotals
+		var day string
+		if err := rows.Scan(&g.key, &g.currency, &day, &g.income, &g.expense, &g.count); err != nil {
 			return nil, fmt.Errorf("scan summary: %w", err)
 		}
-		out = append(out, s)
+		if target != "" {
+			if g.income, err = conv.convert(g.income, g.currency, target, day); err != nil {
+				return nil, err
+			}
+			if g.expense, err = conv.convert(g.expense, g.currency, target, day); err != nil {
+				return nil, err
+			}
+			g.currency = target
+		}
+
+		// Строки отсортированы, так что одинаковые ключ+валюта идут подряд.
+		if n := len(out); n > 0 && out[n-1].key == g.key && out[n-1].currency == g.currency {
+			out[n-1].income += g.income
+			out[n-1].expense += g.expense
+			out[n-1].count += g.count
+			continue
+		}
+		out = append(out, g)
 	}
 	return out, rows.Err()
 }
 
-func (l *Ledger) UpsertBudget(categoryID int64, limitKopeks int64) (Budget, error) {
-	if categoryID == 0 {
+// UpsertBudget задаёт лимит категории: сумму в валюте b.Currency (по умолчанию рубли)
+// на каждый период b.Period (по умолчанию месяц), отсчитываемый от b.StartDate.
+// Без StartDate периоды выравниваются по календарю: неделя с понедельника,
+// месяц с 1-го числа, квартал и год — с начала квартала и года.
+func (l *Ledger) UpsertBudget(b Budget) (Budget, error) {
+	if b.CategoryID == 0 {
 		return Budget{}, errors.New("categoryID не указан")
 	}
-	if limitKopeks <= 0 {
+	if b.LimitKopeks <= 0 {
 		return Budget{}, errors.New("лимит должен быть больше 0")
 	}
+	currency, err := normalizeCurrency(b.Currency)
+	if err != nil {
+		return Budget{}, err
+	}
+	if currency == "" {
+		currency = baseCurrency
+	}
+	if b.Period == "" {
+		b.Period = periodMonthly
+	}
+	if !budgetPeriods[b.Period] {
+		return Budget{}, fmt.Errorf("неизвестный период бюджета %q (ожидается weekly, monthly, quarterly или yearly)", b.Period)
+	}
+	thresholds, err := normalizeThresholds(b.Thresholds)
+	if err != nil {
+		return Budget{}, err
+	}
+	start := b.StartDate
+	if start.IsZero() {
+		start = calendarPeriodStart(b.Period, time.Now())
+	}
 
-	_, err := l.db.Exec(`
-INSERT INTO budgets (category_id, limit_kopeks)
-VALUES (?, ?)
-ON CONFLICT(category_id) DO UPDATE SET limit_kopeks=excluded.limit_kopeks
-`, categoryID, limitKopeks)
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Budget{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	op := auditUpdate
+	if _, err := getBudget(txObj, b.CategoryID); errors.Is(err, errNotFound) {
+		op = auditCreate
+	}
+	err = l.auditChange(txObj, op, auditBudget, b.CategoryID, func() error {
+		_, err := txObj.Exec(`
+INSERT INTO budgets (category_id, limit_kopeks, currency, period, start_date, rollover, thresholds)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(category_id) DO UPDATE SET limit_kopeks=excluded.limit_kopeks, currency=excluded.currency,
+	period=excluded.period, start_date=excluded.start_date, rollover=excluded.rollover, thresholds=excluded.thresholds
+`, b.CategoryID, b.LimitKopeks, currency, b.Period, start.Format("2006-01-02"), b.Rollover, formatThresholds(thresholds))
+		if err != nil {
+			return fmt.Errorf("сохранение бюджета: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return Budget{}, fmt.Errorf("сохранение бюджета: %w", err)
+		return Budget{}, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return Budget{}, fmt.Errorf("commit: %w", err)
 	}
+	return l.GetBudget(b.CategoryID)
+}
+
+const budgetColumns = `b.category_id, b.limit_kopeks, b.currency, b.period, b.start_date, b.rollover, b.thresholds, c.name`
 
+func scanBudget(row interface{ Scan(dest ...any) error }) (Budget, error) {
 	var b Budget
-	if err := l.db.QueryRow(`
-SELECT b.category_id, b.limit_kopeks, c.name
+	var start, thresholds string
+	if err := row.Scan(&b.CategoryID, &b.LimitKopeks, &b.Currency, &b.Period, &start, &b.Rollover, &thresholds, &b.CategoryName); err != nil {
+		return Budget{}, err
+	}
+	b.Thresholds = parseThresholds(thresholds)
+	b.StartDate, _ = time.Parse("2006-01-02", start)
+	b.EffectiveLimitKopeks = b.LimitKopeks
+	return b, nil
+}
+
+// GetBudget возвращает бюджет категории с переносом на текущий период.
+func (l *Ledger) GetBudget(categoryID int64) (Budget, error) {
+	b, err := getBudget(l.db, categoryID)
+	if err != nil {
+		return Budget{}, err
+	}
+	return l.withCarry(b, time.Now())
+}
+
+func getBudget(q rowQuerier, categoryID int64) (Budget, error) {
+	b, err := scanBudget(q.QueryRow(`
+SELECT `+budgetColumns+`
 FROM budgets b
 JOIN categories c ON c.id = b.category_id
 WHERE b.category_id = ?
-`, categoryID).Scan(&b.CategoryID, &b.LimitKopeks, &b.CategoryName); err != nil {
+`, categoryID))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return Budget{}, fmt.Errorf("%w: категория %d", errNotFound, categoryID)
+			return Budget{}, fmt.Errorf("%w: бюджет категории %d", errNotFound, categoryID)
 		}
 		return Budget{}, fmt.Errorf("чтение бюджета: %w", err)
 	}
-
 	return b, nil
 }
 
+// ListBudgets возвращает бюджеты с переносом на текущий период.
 func (l *Ledger) ListBudgets() ([]Budget, error) {
+	budgets, err := l.listBudgets()
+	if err != nil {
+		return nil, err
+	}
+	for i := range budgets {
+		if budgets[i], err = l.withCarry(budgets[i], time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return budgets, nil
+}
+
+func (l *Ledger) listBudgets() ([]Budget, error) {
 	rows, err := l.db.Query(`
-SELECT b.category_id, b.limit_kopeks, c.name
+SELECT ` + budgetColumns + `
 FROM budgets b
 JOIN categories c ON c.id = b.category_id
 ORDER BY c.name
@@ -336,8 +812,8 @@ ORDER BY c.name
 
 	var out []Budget
 	for rows.Next() {
-		var b Budget
-		if err := rows.Scan(&b.CategoryID, &b.LimitKopeks, &b.CategoryName); err != nil {
+		b, err := scanBudget(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan budget: %w", err)
 		}
 		out = append(out, b)
@@ -345,57 +821,38 @@ ORDER BY c.name
 	return out, rows.Err()
 }
 
-// ExceededBudgets возвращает превышения бюджетов за период.
-func (l *Ledger) ExceededBudgets(from, to time.Time) ([]BudgetAlert, error) {
-	summary, err := l.Summary(from, to)
+// ExceededBudgets возвращает превышения бюджетов за произвольный период [from, to]:
+// траты за весь период сравниваются с лимитом одного периода бюджета как есть.
+// Траты считаются в валюте бюджета (операции пересчитываются по курсу на свою дату).
+// Непустой reportCurrency переводит суммы алертов в эту валюту по курсу на конец периода.
+// Перенос остатков здесь не учитывается: диапазон не связан с периодами бюджета.
+// Для проверки текущих периодов самих бюджетов см. BudgetAlerts.
+func (l *Ledger) ExceededBudgets(from, to time.Time, reportCurrency string) ([]BudgetAlert, error) {
+	reportCurrency, err := normalizeCurrency(reportCurrency)
 	if err != nil {
 		return nil, err
 	}
-
-	rows, err := l.db.Query(`
-SELECT b.category_id, b.limit_kopeks, c.name
-FROM budgets b
-JOIN categories c ON c.id = b.category_id
-`)
+	budgets, err := l.listBudgets()
 	if err != nil {
-		return nil, fmt.Errorf("чтение бюджетов: %w", err)
-	}
-	defer rows.Close()
-
-	byCat := make(map[int64]CategorySummary, len(summary))
-	for _, s := range summary {
-		byCat[s.CategoryID] = s
+		return nil, err
 	}
 
+	spent := newSpentCache(l)
+	conv := newRateConverter(l.db)
 	var alerts []BudgetAlert
-	for rows.Next() {
-		var categoryID, limit int64
-		var name string
-		if err := rows.Scan(&categoryID, &limit, &name); err != nil {
-			return nil, fmt.Errorf("scan budget: %w", err)
+	for _, b := range budgets {
+		amount, err := spent.get(b, from, to)
+		if err != nil {
+			return nil, err
 		}
-		spent := -byCat[categoryID].ExpenseKopeks
-		if spent > limit {
-			alerts = append(alerts, BudgetAlert{
-				CategoryID:       categoryID,
-				CategoryName:     name,
-				LimitKopeks:      limit,
-				SpentKopeks:      spent,
-				ExceededByKopeks: spent - limit,
-			})
+		if amount <= b.LimitKopeks {
+			continue
 		}
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+		a := newBudgetAlert(b, b.LimitKopeks, amount, from, to)
+		if err := a.convert(conv, reportCurrency, timeOrNow(to)); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
 	}
 	return alerts, nil
 }
-
-func rublesToKopeks(rub float64) int64 {
-	// Используем округление, а не отсечение к нулю, чтобы не терять копейки на отрицательных суммах.
-	return int64(math.Round(rub * 100))
-}
-
-func kopeksToRubles(kopeks int64) float64 {
-	return float64(kopeks) / 100
-}
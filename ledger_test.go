@@ -30,7 +30,7 @@ func TestSummaryAndBudgets(t *testing.T) {
 	}
 
 	// Бюджет на еду — 35.00
-	if _, err := ledger.UpsertBudget(food.ID, 3_500); err != nil {
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 3_500}); err != nil {
 		t.Fatalf("set budget: %v", err)
 	}
 
@@ -38,7 +38,13 @@ func TestSummaryAndBudgets(t *testing.T) {
 	end := time.Date(2024, time.March, 31, 23, 59, 0, 0, time.UTC)
 
 	mustAdd := func(categoryID int64, amount int64, day int, note string) {
-		_, err := ledger.AddTransaction(categoryID, amount, time.Date(2024, time.March, day, 12, 0, 0, 0, time.UTC), note)
+		_, err := ledger.AddTransaction(Transaction{
+			AccountID:    defaultAccountID,
+			CategoryID:   categoryID,
+			AmountKopeks: amount,
+			OccurredAt:   time.Date(2024, time.March, day, 12, 0, 0, 0, time.UTC),
+			Note:         note,
+		})
 		if err != nil {
 			t.Fatalf("add transaction: %v", err)
 		}
@@ -50,9 +56,15 @@ func TestSummaryAndBudgets(t *testing.T) {
 	mustAdd(transport.ID, -900, 11, "Taxi")
 
 	// Вне периода: не должно попасть в мартовскую сводку.
-	_, _ = ledger.AddTransaction(food.ID, -1_000, time.Date(2024, time.February, 28, 8, 0, 0, 0, time.UTC), "February groceries")
-
-	summary, err := ledger.Summary(start, end)
+	_, _ = ledger.AddTransaction(Transaction{
+		AccountID:    defaultAccountID,
+		CategoryID:   food.ID,
+		AmountKopeks: -1_000,
+		OccurredAt:   time.Date(2024, time.February, 28, 8, 0, 0, 0, time.UTC),
+		Note:         "February groceries",
+	})
+
+	summary, err := ledger.Summary(SummaryFilter{From: start, To: end})
 	if err != nil {
 		t.Fatalf("summary: %v", err)
 	}
@@ -76,7 +88,7 @@ func TestSummaryAndBudgets(t *testing.T) {
 		t.Fatalf("transport summary unexpected: %+v", transportSummary)
 	}
 
-	alerts, err := ledger.ExceededBudgets(start, end)
+	alerts, err := ledger.ExceededBudgets(start, end, "")
 	if err != nil {
 		t.Fatalf("alerts: %v", err)
 	}
@@ -103,25 +115,29 @@ func findSummary(in []CategorySummary, categoryID int64) CategorySummary {
 
 func TestAddTransactionRequiresCategory(t *testing.T) {
 	ledger := newTestLedger(t)
-	_, err := ledger.AddTransaction(999, -100, time.Now(), "Should fail")
+	_, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: 999, AmountKopeks: -100, OccurredAt: time.Now(), Note: "Should fail"})
 	if err == nil {
 		t.Fatal("expected error for missing category")
 	}
 }
 
-func TestRublesToKopeksRounding(t *testing.T) {
+func TestParseMoneyRubles(t *testing.T) {
 	tests := []struct {
-		rub   float64
+		rub   string
 		want  int64
 		label string
 	}{
-		{rub: 12.34, want: 1234, label: "positive"},
-		{rub: -32.00, want: -3200, label: "negative integer"},
-		{rub: -0.01, want: -1, label: "negative kopek"},
+		{rub: "12.34", want: 1234, label: "positive"},
+		{rub: "-32.00", want: -3200, label: "negative integer"},
+		{rub: "-0.01", want: -1, label: "negative kopek"},
 	}
 
 	for _, tc := range tests {
-		if got := rublesToKopeks(tc.rub); got != tc.want {
+		got, err := parseMoney(tc.rub, baseCurrency)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.label, err)
+		}
+		if got != tc.want {
 			t.Fatalf("%s: expected %d, got %d", tc.label, tc.want, got)
 		}
 	}
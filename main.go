@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -17,7 +18,16 @@ type server struct {
 }
 
 func main() {
-	const dbPath = "data/ledger.db"
+	const (
+		dbPath    = "data/ledger.db"
+		ratesPath = "data/rates.csv"
+	)
+
+	rounding, err := parseRoundingMode(os.Getenv("LEDGER_MONEY_ROUNDING"))
+	if err != nil {
+		log.Fatalf("LEDGER_MONEY_ROUNDING: %v", err)
+	}
+	moneyRounding = rounding
 
 	db, err := InitDB(dbPath)
 	if err != nil {
@@ -27,6 +37,17 @@ func main() {
 
 	s := &server{ledger: NewLedger(db)}
 
+	if n, err := loadRatesFile(s.ledger, ratesPath); err != nil {
+		log.Fatalf("загрузка курсов: %v", err)
+	} else if n > 0 {
+		log.Printf("Загружено курсов из %s: %d", ratesPath, n)
+	}
+
+	// Планировщик повторяющихся операций: проход при старте и затем ежедневно.
+	stop := make(chan struct{})
+	defer close(stop)
+	go runRecurringScheduler(s.ledger, stop)
+
 	// Раздача статических файлов (web фронтенд).
 	fs := http.FileServer(http.Dir("web"))
 	http.Handle("/", fs)
@@ -39,10 +60,35 @@ func main() {
 	http.HandleFunc("/categories", s.handleCategories)
 	http.HandleFunc("/transactions", s.handleTransactions)
 	http.HandleFunc("/summary", s.handleSummary)
+	http.HandleFunc("/summary/kinds", s.handleSummaryByKind)
+	http.HandleFunc("/summary/tags", s.handleSummaryByTag)
+	http.HandleFunc("/reports/timeseries", s.handleTimeseries)
+	http.HandleFunc("/tags", s.handleTags)
+	http.HandleFunc("/tags/", s.handleTagByID)
 	http.HandleFunc("/budgets", s.handleBudgets)
+	http.HandleFunc("/budgets/", s.handleBudgetByID)
 	http.HandleFunc("/alerts", s.handleAlerts)
+	http.HandleFunc("/categories/tree", s.handleCategoryTree)
 	http.HandleFunc("/categories/", s.handleCategoryByID)
+	http.HandleFunc("/audit", s.handleAudit)
+	http.HandleFunc("/transactions/trash", s.handleTrash)
+	http.HandleFunc("/transactions/trash/purge", s.handleTrashPurge)
 	http.HandleFunc("/transactions/", s.handleTransactionByID)
+	http.HandleFunc("/accounts", s.handleAccounts)
+	http.HandleFunc("/accounts/", s.handleAccountByID)
+	http.HandleFunc("/transfers", s.handleTransfers)
+	http.HandleFunc("/transfers/", s.handleTransferByID)
+	http.HandleFunc("/rates", s.handleRates)
+	http.HandleFunc("/import/profiles", s.handleImportProfiles)
+	http.HandleFunc("/import/profiles/", s.handleImportProfileByID)
+	http.HandleFunc("/import/csv", s.handleImportCSV)
+	http.HandleFunc("/rules", s.handleRules)
+	http.HandleFunc("/rules/apply", s.handleRulesApply)
+	http.HandleFunc("/rules/", s.handleRuleByID)
+	http.HandleFunc("/recurring", s.handleRecurring)
+	http.HandleFunc("/recurring/upcoming", s.handleRecurringUpcoming)
+	http.HandleFunc("/recurring/run", s.handleRecurringRun)
+	http.HandleFunc("/recurring/", s.handleRecurringByID)
 
 	addr := ":8080"
 	log.Printf("Сервер слушает %s (БД %s)", addr, dbPath)
@@ -55,7 +101,12 @@ func main() {
 func (s *server) handleCategories(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		cats, err := s.ledger.ListCategories()
+		includeArchived, err := parseBoolParam(r.URL.Query(), "include_archived")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		cats, err := s.ledger.ListCategories(includeArchived)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err)
 			return
@@ -63,7 +114,9 @@ func (s *server) handleCategories(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, cats)
 	case http.MethodPost:
 		var req struct {
-			Name string `json:"name"`
+			Name     string `json:"name"`
+			ParentID int64  `json:"parent_id"`
+			Kind     string `json:"kind"` // income, expense или neutral
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
@@ -75,9 +128,9 @@ func (s *server) handleCategories(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		cat, err := s.ledger.CreateCategory(req.Name)
+		cat, err := s.ledgerFor(r).AddCategory(Category{Name: req.Name, ParentID: req.ParentID, Kind: req.Kind})
 		if err != nil {
-			writeError(w, http.StatusBadRequest, err)
+			writeLedgerError(w, err)
 			return
 		}
 		writeJSON(w, http.StatusCreated, cat)
@@ -86,63 +139,161 @@ func (s *server) handleCategories(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleCategoryByID поддерживает DELETE /categories/{id}.
+// handleCategoryByID поддерживает GET и PATCH /categories/{id},
+// DELETE /categories/{id}?reassign_to=N или ?cascade=true,
+// PUT /categories/{id}/parent — перенос в другую категорию,
+// PUT /categories/{id}/kind — смену типа и POST /categories/{id}/merge — слияние.
 func (s *server) handleCategoryByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
+	id, action, err := splitIDPath(r.URL.Path, "/categories/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch {
+	case action == "parent":
+		s.handleCategoryParent(w, r, id)
+		return
+	case action == "kind":
+		s.handleCategoryKind(w, r, id)
+		return
+	case action == "merge":
+		s.handleCategoryMerge(w, r, id)
+		return
+	case action != "":
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case r.Method == http.MethodGet:
+		cat, err := s.ledger.GetCategory(id)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, cat)
+		return
+	case r.Method == http.MethodPatch:
+		s.handleCategoryPatch(w, r, id)
+		return
+	case r.Method != http.MethodDelete:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	id, err := parseIDFromPath(r.URL.Path, "/categories/")
-	if err != nil {
+	var opts CategoryDeleteOptions
+	if opts.ReassignTo, err = parseIDParam(r.URL.Query(), "reassign_to"); err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	if err := s.ledger.DeleteCategory(id); err != nil {
-		if errors.Is(err, errNotFound) {
-			writeError(w, http.StatusNotFound, err)
-		} else {
-			writeError(w, http.StatusBadRequest, err)
-		}
+	if opts.Cascade, err = parseBoolParam(r.URL.Query(), "cascade"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.ledgerFor(r).DeleteCategory(id, opts); err != nil {
+		writeLedgerError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// txReq — тело POST/PUT /transactions. Сумма задаётся в amount в валюте счёта;
+// amount_rub оставлен для старых клиентов и читается, только если amount пуст.
+type txReq struct {
+	AccountID    int64    `json:"account_id"`
+	CategoryID   int64    `json:"category_id"`
+	Amount       string   `json:"amount"`
+	AmountRub    string   `json:"amount_rub"`
+	Currency     string   `json:"currency"`
+	OccurredAt   string   `json:"occurred_at"` // YYYY-MM-DD
+	Note         string   `json:"note"`
+	Counterparty string   `json:"counterparty"`
+	Refund       bool     `json:"refund"`
+	Tags         []string `json:"tags"`
+	// Splits — разбивка по категориям вместо category_id; суммы в валюте операции.
+	Splits []splitReq `json:"splits"`
+}
+
+type splitReq struct {
+	CategoryID int64  `json:"category_id"`
+	Amount     string `json:"amount"`
+	Note       string `json:"note"`
+}
+
+// txFromReq разбирает txReq в Transaction. Сумма переводится в минимальные
+// единицы валюты операции, а если валюта не указана — валюты счёта.
+func (s *server) txFromReq(req txReq) (Transaction, error) {
+	if req.AccountID == 0 {
+		req.AccountID = defaultAccountID
+	}
+	currency, err := normalizeCurrency(req.Currency)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if currency == "" {
+		acc, err := s.ledger.GetAccount(req.AccountID)
+		if err != nil {
+			return Transaction{}, err
+		}
+		currency = acc.Currency
+	}
+	raw := req.Amount
+	if raw == "" {
+		raw = req.AmountRub
+	}
+	amount, err := parseMoney(raw, currency)
+	if err != nil {
+		return Transaction{}, err
+	}
+	date, err := parseDate(req.OccurredAt)
+	if err != nil {
+		return Transaction{}, err
+	}
+	var splits []TransactionSplit
+	if req.Splits != nil {
+		splits = make([]TransactionSplit, 0, len(req.Splits))
+	}
+	for i, sr := range req.Splits {
+		amount, err := parseMoney(sr.Amount, currency)
+		if err != nil {
+			return Transaction{}, fmt.Errorf("строка %d разбивки: %w", i+1, err)
+		}
+		splits = append(splits, TransactionSplit{CategoryID: sr.CategoryID, AmountKopeks: amount, Note: sr.Note})
+	}
+	return Transaction{
+		AccountID:    req.AccountID,
+		CategoryID:   req.CategoryID,
+		AmountKopeks: amount,
+		Currency:     currency,
+		OccurredAt:   date,
+		Note:         req.Note,
+		Counterparty: req.Counterparty,
+		Refund:       req.Refund,
+		Tags:         req.Tags,
+		Splits:       splits,
+	}, nil
+}
+
 // handleTransactions поддерживает POST (создание) и GET (выборка по периоду).
 func (s *server) handleTransactions(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		var req struct {
-			CategoryID int64  `json:"category_id"`
-			AmountRub  string `json:"amount_rub"`
-			OccurredAt string `json:"occurred_at"` // YYYY-MM-DD
-			Note       string `json:"note"`
-		}
+		var req txReq
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
 			return
 		}
-
-		amount, err := parseRub(req.AmountRub)
+		t, err := s.txFromReq(req)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, err)
-			return
-		}
-		date, err := parseDate(req.OccurredAt)
-		if err != nil {
-			writeError(w, http.StatusBadRequest, err)
+			writeLedgerError(w, err)
 			return
 		}
 
-		tx, err := s.ledger.AddTransaction(req.CategoryID, rublesToKopeks(amount), date, req.Note)
+		// Клиент может повторить запрос с тем же Idempotency-Key после обрыва связи.
+		tx, replayed, err := s.ledgerFor(r).AddTransactionIdempotent(r.Header.Get("Idempotency-Key"), t)
 		if err != nil {
-			if errors.Is(err, errNotFound) {
-				writeError(w, http.StatusNotFound, err)
-			} else {
-				writeError(w, http.StatusBadRequest, err)
-			}
+			writeLedgerError(w, err)
 			return
 		}
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
 		writeJSON(w, http.StatusCreated, tx)
 	case http.MethodGet:
 		params, err := parseTxQuery(r.URL.Query())
@@ -150,126 +301,206 @@ func (s *server) handleTransactions(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, err)
 			return
 		}
-		rows, err := s.ledger.db.Query(
-			`SELECT id, category_id, amount_kopeks, occurred_at, note
-			 FROM transactions
-			 WHERE occurred_at BETWEEN ? AND ?
-			 AND (? = 0 OR category_id = ?)
-			 ORDER BY occurred_at DESC
-			 LIMIT ? OFFSET ?`,
-			params.from.UTC().Format(time.RFC3339),
-			params.to.UTC().Format(time.RFC3339),
-			params.categoryID,
-			params.categoryID,
-			params.limit,
-			params.offset,
-		)
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, fmt.Errorf("получение операций: %w", err))
+		f := TransactionFilter{
+			From:         params.from,
+			To:           params.to,
+			CategoryIDs:  params.categoryIDs,
+			AccountID:    params.accountID,
+			Tags:         params.tags,
+			Sign:         params.sign,
+			NoteContains: params.noteContains,
+			Search:       params.search,
+			Sort:         params.sort,
+			Cursor:       params.cursor,
+			Limit:        params.limit,
+			Offset:       params.offset,
+		}
+		if _, err := f.cursor(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
-		defer rows.Close()
-
-		var out []Transaction
-		for rows.Next() {
-			var tx Transaction
-			var ts string
-			if err := rows.Scan(&tx.ID, &tx.CategoryID, &tx.AmountKopeks, &ts, &tx.Note); err != nil {
-				writeError(w, http.StatusInternalServerError, err)
+		// Границы суммы — в валюте счёта account_id, а без счёта — в рублях, как в правилах.
+		currency := baseCurrency
+		if params.accountID != 0 {
+			acc, err := s.ledger.GetAccount(params.accountID)
+			if err != nil {
+				writeLedgerError(w, err)
+				return
+			}
+			currency = acc.Currency
+		}
+		for _, bound := range []struct {
+			raw string
+			dst **int64
+		}{{params.minAmount, &f.MinAmountKopeks}, {params.maxAmount, &f.MaxAmountKopeks}} {
+			if bound.raw == "" {
+				continue
+			}
+			v, err := parseMoney(bound.raw, currency)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
 				return
 			}
-			t, _ := time.Parse(time.RFC3339, ts)
-			tx.OccurredAt = t
-			out = append(out, tx)
+			*bound.dst = &v
 		}
-		if err := rows.Err(); err != nil {
+		list, err := s.ledger.ListTransactions(f)
+		if err != nil {
 			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
-		writeJSON(w, http.StatusOK, out)
+
+		type totalResp struct {
+			Currency string `json:"currency"`
+			Count    int    `json:"count"`
+			Sum      Money  `json:"sum"`
+		}
+		type listResp struct {
+			Items      []Transaction `json:"items"`
+			Count      int           `json:"count"`
+			Totals     []totalResp   `json:"totals"`
+			NextCursor string        `json:"next_cursor,omitempty"`
+			PrevCursor string        `json:"prev_cursor,omitempty"`
+		}
+		resp := listResp{
+			Items:      list.Items,
+			Count:      list.Count,
+			Totals:     make([]totalResp, 0, len(list.Totals)),
+			NextCursor: list.NextCursor,
+			PrevCursor: list.PrevCursor,
+		}
+		for _, t := range list.Totals {
+			resp.Totals = append(resp.Totals, totalResp{Currency: t.Currency, Count: t.Count, Sum: fromMinorUnits(t.AmountKopeks, t.Currency)})
+		}
+		writeJSON(w, http.StatusOK, resp)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// handleTransactionByID поддерживает PUT для обновления одной транзакции по пути /transactions/{id}.
+// handleTransactionByID поддерживает PUT (обновление) и DELETE (перенос в корзину)
+// /transactions/{id}, POST /transactions/{id}/restore (возврат из корзины) и
+// GET /transactions/{id}/history (журнал изменений).
 func (s *server) handleTransactionByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-	id, err := parseIDFromPath(r.URL.Path, "/transactions/")
+	id, action, err := splitIDPath(r.URL.Path, "/transactions/")
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	var req struct {
-		CategoryID int64  `json:"category_id"`
-		AmountRub  string `json:"amount_rub"`
-		OccurredAt string `json:"occurred_at"`
-		Note       string `json:"note"`
+	if action == "history" {
+		s.handleTransactionHistory(w, r, id)
+		return
+	}
+	if action == "restore" {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		tx, err := s.ledgerFor(r).RestoreTransaction(id)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tx)
+		return
+	}
+	if action != "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+	case http.MethodDelete:
+		if err := s.ledgerFor(r).DeleteTransaction(id); err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
 	}
+
+	var req txReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
 		return
 	}
-	amount, err := parseRub(req.AmountRub)
+	t, err := s.txFromReq(req)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err)
+		writeLedgerError(w, err)
 		return
 	}
-	date, err := parseDate(req.OccurredAt)
+	t.ID = id
+
+	tx, err := s.ledgerFor(r).UpdateTransaction(t)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err)
+		writeLedgerError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, tx)
+}
 
-	tx, err := s.ledger.UpdateTransaction(id, req.CategoryID, rublesToKopeks(amount), date, req.Note)
+// parseSummaryFilter разбирает параметры сводки: from, to, account_id, currency, rollup, as_of.
+func parseSummaryFilter(q url.Values) (SummaryFilter, error) {
+	from, err := parseDate(q.Get("from"))
 	if err != nil {
-		if errors.Is(err, errNotFound) {
-			writeError(w, http.StatusNotFound, err)
-		} else {
-			writeError(w, http.StatusBadRequest, err)
-		}
-		return
+		return SummaryFilter{}, err
 	}
-	writeJSON(w, http.StatusOK, tx)
+	to, err := parseDate(q.Get("to"))
+	if err != nil {
+		return SummaryFilter{}, err
+	}
+	accountID, err := parseIDParam(q, "account_id")
+	if err != nil {
+		return SummaryFilter{}, err
+	}
+	currency, err := normalizeCurrency(q.Get("currency"))
+	if err != nil {
+		return SummaryFilter{}, err
+	}
+	rollUp, err := parseBoolParam(q, "rollup")
+	if err != nil {
+		return SummaryFilter{}, err
+	}
+	knownAt, err := parseMoment("as_of", q.Get("as_of"))
+	if err != nil {
+		return SummaryFilter{}, err
+	}
+	return SummaryFilter{From: from, To: timeOrNow(to), AccountID: accountID, Currency: currency, RollUp: rollUp, KnownAt: knownAt}, nil
 }
 
-// handleSummary возвращает агрегаты по категориям за период.
+// handleSummary возвращает агрегаты по категориям за период (опционально по одному счёту).
+// Без currency суммы разбиты по валютам операций, с currency — пересчитаны в неё.
 func (s *server) handleSummary(w http.ResponseWriter, r *http.Request) {
-	from, err := parseDate(r.URL.Query().Get("from"))
-	if err != nil && r.URL.Query().Get("from") != "" {
-		writeError(w, http.StatusBadRequest, err)
-		return
-	}
-	to, err := parseDate(r.URL.Query().Get("to"))
-	if err != nil && r.URL.Query().Get("to") != "" {
+	filter, err := parseSummaryFilter(r.URL.Query())
+	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-
-	summary, err := s.ledger.Summary(from, timeOrNow(to))
+	summary, err := s.ledger.Summary(filter)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		writeReportError(w, err)
 		return
 	}
 
 	type summaryResp struct {
-		CategoryID int64   `json:"category_id"`
-		IncomeRub  float64 `json:"income_rub"`
-		ExpenseRub float64 `json:"expense_rub"`
-		NetRub     float64 `json:"net_rub"`
-		Count      int     `json:"count"`
+		CategoryID int64  `json:"category_id"`
+		Currency   string `json:"currency"`
+		Income     Money  `json:"income"`
+		Expense    Money  `json:"expense"`
+		Net        Money  `json:"net"`
+		Count      int    `json:"count"`
 	}
 
 	resp := make([]summaryResp, 0, len(summary))
 	for _, s := range summary {
 		resp = append(resp, summaryResp{
 			CategoryID: s.CategoryID,
-			IncomeRub:  kopeksToRubles(s.IncomeKopeks),
-			ExpenseRub: kopeksToRubles(-s.ExpenseKopeks),
-			NetRub:     kopeksToRubles(s.NetKopeks),
+			Currency:   s.Currency,
+			Income:     fromMinorUnits(s.IncomeKopeks, s.Currency),
+			Expense:    fromMinorUnits(-s.ExpenseKopeks, s.Currency),
+			Net:        fromMinorUnits(s.NetKopeks, s.Currency),
 			Count:      s.Count,
 		})
 	}
@@ -290,7 +521,13 @@ func (s *server) handleBudgets(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		var req struct {
 			CategoryID int64  `json:"category_id"`
-			LimitRub   string `json:"limit_rub"`
+			Limit      string `json:"limit"`
+			LimitRub   string `json:"limit_rub"` // устаревшее имя limit для рублёвых бюджетов
+			Currency   string `json:"currency"`
+			Period     string `json:"period"`     // weekly, monthly (по умолчанию), quarterly, yearly
+			StartDate  string `json:"start_date"` // YYYY-MM-DD, по умолчанию начало текущего календарного периода
+			Rollover   bool   `json:"rollover"`   // переносить остаток/перерасход в следующий период
+			Thresholds []int  `json:"thresholds"` // пороги предупреждений, % от лимита
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
@@ -300,18 +537,39 @@ func (s *server) handleBudgets(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, errors.New("category_id обязателен"))
 			return
 		}
-		limitRub, err := parseRub(req.LimitRub)
+		currency, err := normalizeCurrency(req.Currency)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, err)
 			return
 		}
-		budget, err := s.ledger.UpsertBudget(req.CategoryID, rublesToKopeks(limitRub))
+		if currency == "" {
+			currency = baseCurrency
+		}
+		raw := req.Limit
+		if raw == "" {
+			raw = req.LimitRub
+		}
+		limit, err := parseMoney(raw, currency)
 		if err != nil {
-			if errors.Is(err, errNotFound) {
-				writeError(w, http.StatusNotFound, err)
-			} else {
-				writeError(w, http.StatusBadRequest, err)
-			}
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		start, err := parseDate(req.StartDate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		budget, err := s.ledgerFor(r).UpsertBudget(Budget{
+			CategoryID:  req.CategoryID,
+			LimitKopeks: limit,
+			Currency:    currency,
+			Period:      req.Period,
+			StartDate:   start,
+			Rollover:    req.Rollover,
+			Thresholds:  req.Thresholds,
+		})
+		if err != nil {
+			writeLedgerError(w, err)
 			return
 		}
 		writeJSON(w, http.StatusCreated, budget)
@@ -320,7 +578,9 @@ func (s *server) handleBudgets(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleAlerts возвращает превышения бюджетов за период.
+// handleAlerts возвращает превышения бюджетов; currency задаёт валюту отчёта.
+// Без from/to каждый бюджет проверяется в своём периоде, содержащем день at
+// (по умолчанию сегодня); с from/to траты за этот диапазон сравниваются с лимитом как есть.
 func (s *server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 	from, err := parseDate(r.URL.Query().Get("from"))
 	if err != nil && r.URL.Query().Get("from") != "" {
@@ -333,18 +593,45 @@ func (s *server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	alerts, err := s.ledger.ExceededBudgets(from, timeOrNow(to))
+	currency, err := normalizeCurrency(r.URL.Query().Get("currency"))
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	at, err := parseDate(r.URL.Query().Get("at"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var alerts []BudgetAlert
+	if from.IsZero() && to.IsZero() {
+		alerts, err = s.ledger.BudgetAlerts(at, currency)
+	} else {
+		alerts, err = s.ledger.ExceededBudgets(from, timeOrNow(to), currency)
+	}
+	if err != nil {
+		writeReportError(w, err)
 		return
 	}
 
 	type alertResp struct {
-		CategoryID   int64   `json:"category_id"`
-		CategoryName string  `json:"category_name"`
-		LimitRub     float64 `json:"limit_rub"`
-		SpentRub     float64 `json:"spent_rub"`
-		ExceededRub  float64 `json:"exceeded_rub"`
+		CategoryID   int64  `json:"category_id"`
+		CategoryName string `json:"category_name"`
+		Currency     string `json:"currency"`
+		Period       string `json:"period,omitempty"`
+		PeriodStart  string `json:"period_start"`
+		PeriodEnd    string `json:"period_end"`
+		Severity     string `json:"severity"` // critical, warning или info
+		Threshold    int    `json:"threshold,omitempty"`
+		UsedPercent  int    `json:"used_percent"`
+		Limit        Money  `json:"limit"` // действующий лимит: base_limit + carried
+		BaseLimit    Money  `json:"base_limit"`
+		Carried      Money  `json:"carried"`
+		Spent        Money  `json:"spent"`
+		Exceeded     Money  `json:"exceeded"`
+		Forecast     Money  `json:"forecast"`
 	}
 
 	resp := make([]alertResp, 0, len(alerts))
@@ -352,9 +639,19 @@ func (s *server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 		resp = append(resp, alertResp{
 			CategoryID:   a.CategoryID,
 			CategoryName: a.CategoryName,
-			LimitRub:     kopeksToRubles(a.LimitKopeks),
-			SpentRub:     kopeksToRubles(a.SpentKopeks),
-			ExceededRub:  kopeksToRubles(a.ExceededByKopeks),
+			Currency:     a.Currency,
+			Period:       a.Period,
+			PeriodStart:  a.PeriodStart.Format("2006-01-02"),
+			PeriodEnd:    a.PeriodEnd.Format("2006-01-02"),
+			Severity:     a.Severity,
+			Threshold:    a.ThresholdPercent,
+			UsedPercent:  a.UsedPercent,
+			Limit:        fromMinorUnits(a.LimitKopeks, a.Currency),
+			BaseLimit:    fromMinorUnits(a.BaseLimitKopeks, a.Currency),
+			Carried:      fromMinorUnits(a.CarriedKopeks, a.Currency),
+			Spent:        fromMinorUnits(a.SpentKopeks, a.Currency),
+			Exceeded:     fromMinorUnits(a.ExceededByKopeks, a.Currency),
+			Forecast:     fromMinorUnits(a.ForecastKopeks, a.Currency),
 		})
 	}
 
@@ -387,18 +684,70 @@ func parseIDFromPath(path, prefix string) (int64, error) {
 	return val, nil
 }
 
-func parseRub(s string) (float64, error) {
-	if s == "" {
-		return 0, errors.New("сумма не указана")
+// parseBoolParam читает необязательный булев параметр запроса (по умолчанию false).
+func parseBoolParam(values url.Values, name string) (bool, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return false, nil
 	}
-	s = strings.ReplaceAll(s, ",", ".")
-	val, err := strconv.ParseFloat(s, 64)
+	val, err := strconv.ParseBool(raw)
 	if err != nil {
-		return 0, fmt.Errorf("некорректная сумма: %w", err)
+		return false, fmt.Errorf("%s должен быть true или false", name)
 	}
 	return val, nil
 }
 
+// parseIDParam читает необязательный числовой идентификатор из query; пустое значение даёт 0.
+func parseIDParam(values url.Values, name string) (int64, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	val, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s должен быть числом", name)
+	}
+	return val, nil
+}
+
+// splitIDPath разбирает путь вида prefix{id}/action, action может быть пустым.
+func splitIDPath(path, prefix string) (int64, string, error) {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	id, err := parseIDFromPath(prefix+idStr, prefix)
+	if err != nil {
+		return 0, "", err
+	}
+	return id, action, nil
+}
+
+// writeLedgerError переводит ошибки Ledger в HTTP-статусы.
+func writeLedgerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errConflict):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+// writeReportError отличает отсутствие курса для пересчёта (422), неизвестный
+// объект отчёта (404) и недопустимые параметры (400) от сбоя БД (500).
+func writeReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errValidation):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, errNoRate):
+		writeError(w, http.StatusUnprocessableEntity, err)
+	case errors.Is(err, errNotFound):
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
 // parseDate ожидает формат YYYY-MM-DD. Пустая строка возвращает нулевое время.
 func parseDate(s string) (time.Time, error) {
 	if s == "" {
@@ -411,6 +760,22 @@ func parseDate(s string) (time.Time, error) {
 	return t, nil
 }
 
+// parseMoment разбирает момент из параметра name: RFC 3339 (2024-04-01T09:00:00Z)
+// или дату YYYY-MM-DD, которая означает конец этого дня по UTC.
+func parseMoment(name, s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s должен быть датой YYYY-MM-DD или моментом в формате RFC 3339", name)
+	}
+	return d.Add(24*time.Hour - time.Second), nil
+}
+
 func timeOrNow(t time.Time) time.Time {
 	if t.IsZero() {
 		return time.Now().UTC()
@@ -419,11 +784,20 @@ func timeOrNow(t time.Time) time.Time {
 }
 
 type txQuery struct {
-	from       time.Time
-	to         time.Time
-	categoryID int64
-	limit      int
-	offset     int
+	from         time.Time
+	to           time.Time
+	categoryIDs  []int64
+	accountID    int64
+	tags         []string
+	minAmount    string
+	maxAmount    string
+	sign         string
+	noteContains string
+	search       string
+	sort         string
+	cursor       string
+	limit        int
+	offset       int
 }
 
 func parseTxQuery(values url.Values) (txQuery, error) {
@@ -448,12 +822,40 @@ func parseTxQuery(values url.Values) (txQuery, error) {
 		q.to = to.UTC()
 	}
 
-	if cid := values.Get("category_id"); cid != "" {
-		parsed, err := strconv.ParseInt(cid, 10, 64)
-		if err != nil {
-			return q, fmt.Errorf("category_id должен быть числом")
+	// category_id можно повторить или перечислить через запятую.
+	for _, raw := range values["category_id"] {
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil || id <= 0 {
+				return q, fmt.Errorf("category_id должен быть числом")
+			}
+			q.categoryIDs = append(q.categoryIDs, id)
+		}
+	}
+	if q.accountID, err = parseIDParam(values, "account_id"); err != nil {
+		return q, err
+	}
+	if q.tags, err = normalizeTags(values["tag"]); err != nil {
+		return q, err
+	}
+	q.minAmount = strings.TrimSpace(values.Get("min_amount"))
+	q.maxAmount = strings.TrimSpace(values.Get("max_amount"))
+	q.sign = values.Get("sign")
+	if q.sign != "" && q.sign != categoryKindIncome && q.sign != categoryKindExpense {
+		return q, fmt.Errorf("sign должен быть %s или %s", categoryKindIncome, categoryKindExpense)
+	}
+	q.noteContains = values.Get("note_contains")
+	if q.sort = values.Get("sort"); q.sort != "" {
+		if _, err := parseTransactionSort(q.sort); err != nil {
+			return q, err
+		}
+	}
+	q.cursor = values.Get("cursor")
+	if search := strings.TrimSpace(values.Get("q")); search != "" {
+		if _, err := ftsQuery(search); err != nil {
+			return q, err
 		}
-		q.categoryID = parsed
+		q.search = search
 	}
 
 	q.limit = 100
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var errSchemaTooNew = errors.New("схема БД новее, чем поддерживает приложение")
+
+// migration — один шаг изменения схемы из файла migrations/NNNN_name.sql.
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// loadMigrations читает встроенные миграции и проверяет, что версии идут подряд с 1.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("чтение миграций: %w", err)
+	}
+
+	var out []migration
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+		num, title, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("миграция %s: имя должно быть вида NNNN_name.sql", name)
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("миграция %s: некорректный номер версии", name)
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, fmt.Errorf("миграция %s: %w", name, err)
+		}
+		out = append(out, migration{Version: version, Name: title, SQL: string(body)})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("миграции: ожидалась версия %d, найдена %d", i+1, m.Version)
+		}
+	}
+	return out, nil
+}
+
+// schemaVersion возвращает номер последней применённой миграции (0 для пустой БД).
+func schemaVersion(db *sql.DB) (int, error) {
+	var v int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&v); err != nil {
+		return 0, fmt.Errorf("чтение версии схемы: %w", err)
+	}
+	return v, nil
+}
+
+// migrate доводит схему до последней версии. Каждая миграция выполняется
+// в отдельной транзакции вместе с записью в schema_version, поэтому
+// упавший шаг не оставляет схему в промежуточном состоянии.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TEXT NOT NULL
+)`); err != nil {
+		return fmt.Errorf("создание schema_version: %w", err)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("%w: версия БД %d, приложение знает до %d", errSchemaTooNew, current, len(migrations))
+	}
+
+	for _, m := range migrations[current:] {
+		txObj, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("begin tx: %w", err)
+		}
+		if _, err := txObj.Exec(m.SQL); err != nil {
+			txObj.Rollback()
+			return fmt.Errorf("миграция %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if _, err := txObj.Exec(
+			"INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now().UTC().Format(time.RFC3339),
+		); err != nil {
+			txObj.Rollback()
+			return fmt.Errorf("запись версии %d: %w", m.Version, err)
+		}
+		if err := txObj.Commit(); err != nil {
+			return fmt.Errorf("commit миграции %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
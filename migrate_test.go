@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateFreshDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fresh.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	v, err := schemaVersion(db)
+	if err != nil {
+		t.Fatalf("schema version: %v", err)
+	}
+	if v != len(migrations) {
+		t.Fatalf("expected version %d, got %d", len(migrations), v)
+	}
+
+	// Повторный запуск не должен ничего менять.
+	if err := migrate(db); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+}
+
+func TestMigrateLegacyDBKeepsData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	raw, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// Схема и данные в том виде, в каком их создавал InitDB до появления миграций.
+	if _, err := raw.Exec(`
+CREATE TABLE categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE);
+CREATE TABLE budgets (category_id INTEGER PRIMARY KEY REFERENCES categories(id) ON DELETE CASCADE, limit_kopeks INTEGER NOT NULL);
+CREATE TABLE transactions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	amount_kopeks INTEGER NOT NULL,
+	occurred_at TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO categories (name) VALUES ('Food');
+INSERT INTO transactions (category_id, amount_kopeks, occurred_at, note) VALUES (1, -2300, '2024-03-10T12:00:00Z', 'Groceries');
+`); err != nil {
+		t.Fatalf("legacy schema: %v", err)
+	}
+	raw.Close()
+
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	var cnt int
+	if err := db.QueryRow("SELECT COUNT(*) FROM transactions").Scan(&cnt); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if cnt != 1 {
+		t.Fatalf("expected legacy transaction to survive, got %d rows", cnt)
+	}
+}
+
+func TestMigrateRefusesNewerDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "newer.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (9999, 'future', '2099-01-01T00:00:00Z')"); err != nil {
+		t.Fatalf("bump version: %v", err)
+	}
+	db.Close()
+
+	if _, err := InitDB(path); !errors.Is(err, errSchemaTooNew) {
+		t.Fatalf("expected errSchemaTooNew, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+-- Исходная схема. IF NOT EXISTS оставлен, чтобы базы, созданные до появления
+-- миграций, подхватились без ошибок и получили версию 1.
+CREATE TABLE IF NOT EXISTS categories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS budgets (
+	category_id INTEGER PRIMARY KEY REFERENCES categories(id) ON DELETE CASCADE,
+	limit_kopeks INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS transactions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	amount_kopeks INTEGER NOT NULL,
+	occurred_at TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT ''
+);
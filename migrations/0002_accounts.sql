@@ -0,0 +1,11 @@
+-- Счета (наличные, карты, вклады). Существующие операции привязываются к счёту по умолчанию.
+CREATE TABLE accounts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	kind TEXT NOT NULL DEFAULT 'cash'
+);
+INSERT INTO accounts (id, name, kind) VALUES (1, 'Основной счёт', 'cash');
+
+ALTER TABLE transactions ADD COLUMN account_id INTEGER REFERENCES accounts(id);
+UPDATE transactions SET account_id = 1;
+CREATE INDEX idx_transactions_account ON transactions(account_id, occurred_at);
@@ -0,0 +1,28 @@
+-- Переводы между счетами. Обе ноги перевода — обычные строки transactions
+-- со ссылкой transfer_id и без категории, поэтому category_id становится
+-- необязательным. SQLite не умеет менять NOT NULL у колонки, таблица пересоздаётся.
+CREATE TABLE transfers (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	from_account_id INTEGER NOT NULL REFERENCES accounts(id),
+	to_account_id INTEGER NOT NULL REFERENCES accounts(id),
+	amount_kopeks INTEGER NOT NULL,
+	occurred_at TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE transactions_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER REFERENCES accounts(id),
+	category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+	amount_kopeks INTEGER NOT NULL,
+	occurred_at TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	transfer_id INTEGER REFERENCES transfers(id) ON DELETE CASCADE
+);
+INSERT INTO transactions_new (id, account_id, category_id, amount_kopeks, occurred_at, note)
+SELECT id, account_id, category_id, amount_kopeks, occurred_at, note FROM transactions;
+DROP TABLE transactions;
+ALTER TABLE transactions_new RENAME TO transactions;
+
+CREATE INDEX idx_transactions_account ON transactions(account_id, occurred_at);
+CREATE INDEX idx_transactions_transfer ON transactions(transfer_id);
@@ -0,0 +1,18 @@
+-- Валюты: у счёта, операции и бюджета свой ISO 4217 код, суммы хранятся
+-- в минимальных единицах этой валюты. Всё, что было до миграции, — в рублях.
+ALTER TABLE accounts ADD COLUMN currency TEXT NOT NULL DEFAULT 'RUB';
+ALTER TABLE transactions ADD COLUMN currency TEXT NOT NULL DEFAULT 'RUB';
+ALTER TABLE budgets ADD COLUMN currency TEXT NOT NULL DEFAULT 'RUB';
+
+-- Сумма зачисления перевода; отличается от списания, если валюты счетов разные.
+ALTER TABLE transfers ADD COLUMN to_amount_kopeks INTEGER;
+UPDATE transfers SET to_amount_kopeks = amount_kopeks;
+
+-- rate — сколько единиц quote стоит одна единица currency на дату rate_date.
+CREATE TABLE exchange_rates (
+	rate_date TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	quote TEXT NOT NULL,
+	rate REAL NOT NULL CHECK (rate > 0),
+	PRIMARY KEY (currency, quote, rate_date)
+);
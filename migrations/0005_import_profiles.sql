@@ -0,0 +1,18 @@
+-- Профили разбора банковских выписок в CSV. Колонки задаются либо названием
+-- из строки заголовка, либо номером с 1.
+CREATE TABLE import_profiles (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	delimiter TEXT NOT NULL DEFAULT ';',
+	encoding TEXT NOT NULL DEFAULT 'utf-8',
+	skip_rows INTEGER NOT NULL DEFAULT 0,
+	has_header INTEGER NOT NULL DEFAULT 1,
+	date_column TEXT NOT NULL,
+	amount_column TEXT NOT NULL,
+	description_column TEXT NOT NULL DEFAULT '',
+	date_format TEXT NOT NULL DEFAULT 'DD.MM.YYYY',
+	decimal_separator TEXT NOT NULL DEFAULT ',',
+	invert_sign INTEGER NOT NULL DEFAULT 0,
+	account_id INTEGER REFERENCES accounts(id),
+	category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL
+);
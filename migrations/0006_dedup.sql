@@ -0,0 +1,16 @@
+-- Отпечаток импортированной операции (дата, сумма, счёт, нормализованный
+-- комментарий, банковский референс). У операций, введённых вручную, он NULL,
+-- а NULL уникальный индекс не ограничивает.
+ALTER TABLE transactions ADD COLUMN fingerprint TEXT;
+CREATE UNIQUE INDEX ux_transactions_fingerprint ON transactions(fingerprint);
+
+ALTER TABLE import_profiles ADD COLUMN reference_column TEXT NOT NULL DEFAULT '';
+
+-- Ключи Idempotency-Key для POST /transactions: повтор запроса с тем же ключом
+-- возвращает уже созданную операцию.
+CREATE TABLE idempotency_keys (
+	key TEXT PRIMARY KEY,
+	request_hash TEXT NOT NULL,
+	transaction_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+	created_at TEXT NOT NULL
+);
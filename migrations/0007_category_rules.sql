@@ -0,0 +1,18 @@
+-- Контрагент операции (из выписки или запроса) — по нему тоже работают правила.
+ALTER TABLE transactions ADD COLUMN counterparty TEXT NOT NULL DEFAULT '';
+ALTER TABLE import_profiles ADD COLUMN counterparty_column TEXT NOT NULL DEFAULT '';
+
+-- Правила автокатегоризации. Пустые условия не проверяются, заданные
+-- объединяются по И; из подходящих правил побеждает большее priority.
+CREATE TABLE category_rules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	priority INTEGER NOT NULL DEFAULT 0,
+	note_contains TEXT NOT NULL DEFAULT '',
+	note_regex TEXT NOT NULL DEFAULT '',
+	min_amount_kopeks INTEGER,
+	max_amount_kopeks INTEGER,
+	account_id INTEGER REFERENCES accounts(id) ON DELETE CASCADE,
+	counterparty TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_category_rules_priority ON category_rules(priority DESC, id);
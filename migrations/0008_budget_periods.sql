@@ -0,0 +1,10 @@
+-- Бюджет действует по периодам (неделя, месяц, квартал, год), отсчитываемым от start_date.
+ALTER TABLE budgets ADD COLUMN period TEXT NOT NULL DEFAULT 'monthly';
+ALTER TABLE budgets ADD COLUMN start_date TEXT NOT NULL DEFAULT '1970-01-01';
+
+-- Существующие лимиты становятся месячными с начала месяца первой операции категории,
+-- чтобы история «план/факт» охватывала уже накопленные данные.
+UPDATE budgets SET start_date = COALESCE(
+	(SELECT date(MIN(occurred_at), 'start of month') FROM transactions WHERE category_id = budgets.category_id),
+	date('now', 'start of month')
+);
@@ -0,0 +1,4 @@
+-- Перенос остатка бюджета между периодами. Переносимые суммы не хранятся:
+-- они каждый раз считаются по операциям, поэтому правка прошлых операций
+-- сразу отражается на текущем лимите.
+ALTER TABLE budgets ADD COLUMN rollover INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Пороги предупреждений бюджета в процентах от действующего лимита, через запятую
+-- (например '50,80,100'). Пустая строка — только превышение лимита.
+ALTER TABLE budgets ADD COLUMN thresholds TEXT NOT NULL DEFAULT '';
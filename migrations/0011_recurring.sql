@@ -0,0 +1,29 @@
+-- Шаблоны повторяющихся операций (зарплата, аренда, подписки).
+-- posted_through — последний день, по который шаблон уже превращён в операции.
+CREATE TABLE recurring_templates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL REFERENCES accounts(id),
+	category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+	amount_kopeks INTEGER NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	counterparty TEXT NOT NULL DEFAULT '',
+	frequency TEXT NOT NULL,
+	interval INTEGER NOT NULL DEFAULT 1,
+	day_of_month INTEGER NOT NULL DEFAULT 0,
+	start_date TEXT NOT NULL,
+	end_date TEXT,
+	posted_through TEXT
+);
+
+-- Отдельные даты шаблона: пропуск, изменённые сумма/дата/комментарий
+-- или уже созданная операция.
+CREATE TABLE recurring_occurrences (
+	template_id INTEGER NOT NULL REFERENCES recurring_templates(id) ON DELETE CASCADE,
+	occurrence_date TEXT NOT NULL,
+	status TEXT NOT NULL,
+	amount_kopeks INTEGER,
+	occurred_at TEXT,
+	note TEXT,
+	transaction_id INTEGER REFERENCES transactions(id) ON DELETE SET NULL,
+	PRIMARY KEY (template_id, occurrence_date)
+);
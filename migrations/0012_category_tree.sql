@@ -0,0 +1,5 @@
+-- Иерархия категорий: parent_id ссылается на родительскую категорию
+-- (NULL — категория верхнего уровня). При удалении родителя дочерние
+-- категории поднимаются на верхний уровень.
+ALTER TABLE categories ADD COLUMN parent_id INTEGER REFERENCES categories(id) ON DELETE SET NULL;
+CREATE INDEX idx_categories_parent ON categories(parent_id);
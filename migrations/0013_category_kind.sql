@@ -0,0 +1,6 @@
+-- Тип категории: income (только доходы), expense (только расходы) или neutral
+-- (любой знак). Существующие категории остаются нейтральными, чтобы не
+-- забраковать уже внесённые операции. refund отмечает операцию с «чужим»
+-- знаком, например возврат покупки в категории расходов.
+ALTER TABLE categories ADD COLUMN kind TEXT NOT NULL DEFAULT 'neutral';
+ALTER TABLE transactions ADD COLUMN refund INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Архивные категории скрыты из списка и не принимают новые операции,
+-- но старые операции и отчёты по ним остаются.
+ALTER TABLE categories ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
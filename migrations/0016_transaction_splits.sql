@@ -0,0 +1,11 @@
+-- Разбивка операции по категориям: строки с категорией и частью суммы.
+-- У операции с разбивкой transactions.category_id пуст, сумма строк равна её сумме.
+CREATE TABLE transaction_splits (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transaction_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+	category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	amount_kopeks INTEGER NOT NULL,
+	note TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_transaction_splits_transaction ON transaction_splits(transaction_id);
+CREATE INDEX idx_transaction_splits_category ON transaction_splits(category_id);
@@ -0,0 +1,4 @@
+-- Корзина операций: удалённая операция помечается deleted_at и не попадает
+-- в отчёты, остатки и выборки, пока её не восстановят или не очистят корзину.
+ALTER TABLE transactions ADD COLUMN deleted_at TEXT;
+CREATE INDEX idx_transactions_deleted_at ON transactions(deleted_at);
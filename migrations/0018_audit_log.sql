@@ -0,0 +1,14 @@
+-- Журнал аудита: неизменяемая история изменений категорий, бюджетов и операций.
+-- before/after — JSON-снимки сущности до и после изменения (NULL при создании и удалении).
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	at TEXT NOT NULL,
+	actor TEXT NOT NULL,
+	operation TEXT NOT NULL,
+	entity TEXT NOT NULL,
+	entity_id INTEGER NOT NULL,
+	before TEXT,
+	after TEXT
+);
+CREATE INDEX idx_audit_log_entity ON audit_log(entity, entity_id);
+CREATE INDEX idx_audit_log_at ON audit_log(at);
@@ -0,0 +1,58 @@
+-- Полнотекстовый поиск по операциям: заметка, контрагент и метки.
+-- unicode61 сворачивает регистр, в том числе кириллицы; ё приводится к е
+-- при записи (здесь) и в запросе (ftsQuery). rowid совпадает с transactions.id.
+CREATE VIRTUAL TABLE transactions_fts USING fts5(
+	note, counterparty, tags,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+INSERT INTO transactions_fts (rowid, note, counterparty, tags)
+SELECT t.id,
+	replace(replace(t.note, 'ё', 'е'), 'Ё', 'Е'),
+	replace(replace(t.counterparty, 'ё', 'е'), 'Ё', 'Е'),
+	COALESCE((SELECT replace(group_concat(g.name, ' '), 'ё', 'е')
+		FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.transaction_id = t.id), '')
+FROM transactions t;
+
+CREATE TRIGGER transactions_fts_insert AFTER INSERT ON transactions BEGIN
+	INSERT INTO transactions_fts (rowid, note, counterparty, tags)
+	VALUES (new.id,
+		replace(replace(new.note, 'ё', 'е'), 'Ё', 'Е'),
+		replace(replace(new.counterparty, 'ё', 'е'), 'Ё', 'Е'),
+		'');
+END;
+
+CREATE TRIGGER transactions_fts_update AFTER UPDATE OF note, counterparty ON transactions BEGIN
+	UPDATE transactions_fts SET
+		note = replace(replace(new.note, 'ё', 'е'), 'Ё', 'Е'),
+		counterparty = replace(replace(new.counterparty, 'ё', 'е'), 'Ё', 'Е')
+	WHERE rowid = new.id;
+END;
+
+CREATE TRIGGER transactions_fts_delete AFTER DELETE ON transactions BEGIN
+	DELETE FROM transactions_fts WHERE rowid = old.id;
+END;
+
+-- Метки пересобираются целиком при любом изменении набора меток операции.
+CREATE TRIGGER transactions_fts_tag_insert AFTER INSERT ON transaction_tags BEGIN
+	UPDATE transactions_fts SET tags = COALESCE((SELECT replace(group_concat(g.name, ' '), 'ё', 'е')
+		FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.transaction_id = new.transaction_id), '')
+	WHERE rowid = new.transaction_id;
+END;
+
+CREATE TRIGGER transactions_fts_tag_delete AFTER DELETE ON transaction_tags BEGIN
+	UPDATE transactions_fts SET tags = COALESCE((SELECT replace(group_concat(g.name, ' '), 'ё', 'е')
+		FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.transaction_id = old.transaction_id), '')
+	WHERE rowid = old.transaction_id;
+END;
+
+CREATE TRIGGER transactions_fts_tag_rename AFTER UPDATE OF name ON tags BEGIN
+	UPDATE transactions_fts SET tags = COALESCE((SELECT replace(group_concat(g.name, ' '), 'ё', 'е')
+		FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.transaction_id = transactions_fts.rowid), '')
+	WHERE rowid IN (SELECT transaction_id FROM transaction_tags WHERE tag_id = new.id);
+END;
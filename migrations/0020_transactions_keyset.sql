@@ -0,0 +1,4 @@
+-- Индексы для постраничной выдачи операций курсором по (occurred_at, id)
+-- и для выборки по категории за период.
+CREATE INDEX idx_transactions_occurred ON transactions(occurred_at, id);
+CREATE INDEX idx_transactions_category ON transactions(category_id, occurred_at);
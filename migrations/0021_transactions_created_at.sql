@@ -0,0 +1,4 @@
+-- Момент внесения операции: отчёты на прошлую дату (as_of) не видят операции,
+-- внесённые позже, даже если по ним нет записей в журнале аудита.
+-- У операций, внесённых до этой миграции, момент неизвестен (NULL).
+ALTER TABLE transactions ADD COLUMN created_at TEXT;
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// roundingMode — что делать с цифрами дробной части сверх точности валюты
+// (третий знак для рублей, любой для йен).
+type roundingMode int
+
+const (
+	roundReject   roundingMode = iota // ошибка, если отброшенные цифры не нули
+	roundHalfUp                       // половина — от нуля: 0.005 → 0.01, -0.005 → -0.01
+	roundHalfEven                     // банковское: половина — к чётному
+)
+
+// moneyRounding — режим для сумм из запросов и выписок. По умолчанию лишние
+// знаки — ошибка; при старте режим можно сменить переменной окружения
+// LEDGER_MONEY_ROUNDING (см. parseRoundingMode).
+var moneyRounding = roundReject
+
+// parseRoundingMode разбирает название режима: reject, half_up или half_even.
+// Пустая строка — roundReject.
+func parseRoundingMode(s string) (roundingMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "reject":
+		return roundReject, nil
+	case "half_up":
+		return roundHalfUp, nil
+	case "half_even":
+		return roundHalfEven, nil
+	}
+	return 0, fmt.Errorf("неизвестный режим округления %q (ожидается reject, half_up или half_even)", s)
+}
+
+// Money — сумма в минимальных единицах валюты. В JSON пишется точной десятичной
+// строкой с числом знаков по валюте: "-1234.50", "1500" для JPY, "1.234" для BHD.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+func (m Money) String() string {
+	exp := currencyExponents[m.Currency]
+	abs := uint64(m.Minor)
+	if m.Minor < 0 {
+		abs = -abs
+	}
+	digits := strconv.FormatUint(abs, 10)
+	if exp > 0 {
+		if len(digits) <= exp {
+			digits = strings.Repeat("0", exp-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+	}
+	if m.Minor < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// parseMoney переводит сумму из запроса или выписки в минимальные единицы
+// currency без плавающей точки, округляя лишние знаки по moneyRounding.
+func parseMoney(s, currency string) (int64, error) {
+	return parseMoneyWith(s, currency, moneyRounding)
+}
+
+// parseMoneySep — parseMoney для строк с известным десятичным разделителем
+// decimalSep (как в профиле импорта): другой из точки и запятой — разделитель
+// тысяч, и "1,000" не приходится угадывать.
+func parseMoneySep(s, currency, decimalSep string) (int64, error) {
+	return parseAmount(s, currency, decimalSep, moneyRounding)
+}
+
+// parseMoneyWith — parseMoney с явным режимом округления. Принимает знак
+// (в том числе U+2212), пробелы и апострофы между разрядами, суффикс "₽",
+// точку или запятую как десятичный разделитель и другой из них как разделитель
+// тысяч ("1,234.56", "1.234,56"). Экспоненту, NaN и Inf не принимает.
+func parseMoneyWith(s, currency string, mode roundingMode) (int64, error) {
+	return parseAmount(s, currency, "", mode)
+}
+
+// parseAmount разбирает сумму; пустой decimalSep — разделитель определяется
+// по строке (см. splitDecimal).
+func parseAmount(s, currency, decimalSep string, mode roundingMode) (int64, error) {
+	raw := s
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\u00a0', '\u202f', '\'':
+			return -1
+		case '−', '–':
+			return '-'
+		}
+		return r
+	}, s)
+	s = strings.TrimSuffix(s, "₽")
+	if s == "" {
+		return 0, errors.New("сумма не указана")
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	exp := currencyExponents[currency]
+	intPart, frac, err := splitDecimal(s, decimalSep, exp)
+	if err != nil {
+		return 0, fmt.Errorf("некорректная сумма %q: %w", raw, err)
+	}
+	if intPart == "" && frac == "" {
+		return 0, fmt.Errorf("некорректная сумма %q", raw)
+	}
+	for _, part := range []string{intPart, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("некорректная сумма %q", raw)
+			}
+		}
+	}
+
+	kept, dropped := frac, ""
+	if len(frac) > exp {
+		kept, dropped = frac[:exp], frac[exp:]
+	}
+	kept += strings.Repeat("0", exp-len(kept))
+
+	var minor int64
+	for _, c := range intPart + kept {
+		d := int64(c - '0')
+		if minor > (math.MaxInt64-d)/10 {
+			return 0, fmt.Errorf("сумма %q слишком велика", raw)
+		}
+		minor = minor*10 + d
+	}
+
+	if strings.Trim(dropped, "0") != "" {
+		up := false
+		switch mode {
+		case roundHalfUp:
+			up = dropped[0] >= '5'
+		case roundHalfEven:
+			up = dropped[0] > '5' || dropped[0] == '5' && (strings.Trim(dropped[1:], "0") != "" || minor%2 == 1)
+		default:
+			return 0, fmt.Errorf("сумма %q: больше %d знаков после запятой для %s", raw, exp, currency)
+		}
+		if up {
+			if minor == math.MaxInt64 {
+				return 0, fmt.Errorf("сумма %q слишком велика", raw)
+			}
+			minor++
+		}
+	}
+
+	if neg {
+		minor = -minor
+	}
+	return minor, nil
+}
+
+// splitDecimal делит число без знака на целую и дробную части. decimalSep, если
+// задан, — десятичный разделитель, а другой из точки и запятой — разделитель
+// тысяч. Иначе: если в строке есть и точка, и запятая, десятичный — последний
+// из них; один разделитель, встретившийся несколько раз, — разделитель тысяч.
+// Единственная запятая перед ровно тремя цифрами ("1,000", "1,234") может быть
+// и тем и другим, поэтому для валют с exp не 3 такая строка — ошибка. Точка в
+// таком же положении — всегда десятичная: "10.005" округляется по режиму.
+// Группы после разделителя тысяч должны быть по три цифры.
+func splitDecimal(s, decimalSep string, exp int) (intPart, frac string, err error) {
+	dot, comma := strings.Count(s, "."), strings.Count(s, ",")
+	var decimal, thousands string
+	switch {
+	case decimalSep == ".":
+		decimal, thousands = ".", ","
+	case decimalSep == ",":
+		decimal, thousands = ",", "."
+	case dot > 0 && comma > 0:
+		decimal, thousands = ".", ","
+		if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+			decimal, thousands = ",", "."
+		}
+	case dot > 1:
+		thousands = "."
+	case comma > 1:
+		thousands = ","
+	case dot == 1:
+		decimal = "."
+	case comma == 1:
+		decimal = ","
+	}
+	if decimalSep == "" && decimal == "," && exp != 3 {
+		i := strings.Index(s, decimal)
+		if len(s)-i-1 == 3 && strings.Trim(s[:i], "0") != "" {
+			return "", "", errors.New("непонятно, запятая — разделитель тысяч или дробной части; уберите её или укажите копейки")
+		}
+	}
+
+	intPart = s
+	if decimal != "" && strings.Contains(s, decimal) {
+		i := strings.LastIndex(s, decimal)
+		intPart, frac = s[:i], s[i+1:]
+		if strings.Contains(intPart, decimal) {
+			return "", "", errors.New("несколько десятичных разделителей")
+		}
+	}
+	if thousands != "" {
+		groups := strings.Split(intPart, thousands)
+		if groups[0] == "" {
+			return "", "", errors.New("неверная группировка разрядов")
+		}
+		for _, g := range groups[1:] {
+			if len(g) != 3 {
+				return "", "", errors.New("неверная группировка разрядов")
+			}
+		}
+		intPart = strings.Join(groups, "")
+	}
+	return intPart, frac, nil
+}
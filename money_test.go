@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseMoneyExact(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{in: "0.29", want: 29},
+		{in: "1 234 567,89", want: 123456789},
+		{in: "1 234,5 ₽", want: 123450},
+		{in: "1,234,567.89", want: 123456789},
+		{in: "1.234.567,89", want: 123456789},
+		{in: "1'000", want: 100000},
+		{in: "−32,5", want: -3250},
+		{in: "+7", want: 700},
+		{in: ".5", want: 50},
+		{in: "12.340", want: 1234},
+		{in: "0.500", want: 50},
+		{in: "1,000,000", want: 100000000},
+		{in: "92233720368547758.07", want: 9223372036854775807},
+	}
+	for _, tc := range tests {
+		got, err := parseMoneyWith(tc.in, "RUB", roundReject)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%q: expected %d, got %d", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestParseMoneyRejectsNonDecimal(t *testing.T) {
+	for _, in := range []string{"", "1e3", "NaN", "Inf", "0x10", "--5", "1.2.3,4", "12,34,5", "1,2345.6", "92233720368547758.08", "₽", "1,000", "1,234"} {
+		if got, err := parseMoneyWith(in, "RUB", roundHalfUp); err == nil {
+			t.Fatalf("%q: expected error, got %d", in, got)
+		}
+	}
+}
+
+func TestParseMoneyRoundingModes(t *testing.T) {
+	if _, err := parseMoneyWith("10.005", "RUB", roundReject); err == nil || !strings.Contains(err.Error(), "знаков после запятой") {
+		t.Fatalf("expected extra digits error, got %v", err)
+	}
+	if _, err := parseMoneyWith("1500.5", "JPY", roundReject); err == nil {
+		t.Fatal("expected error for fractional yen")
+	}
+
+	tests := []struct {
+		in       string
+		mode     roundingMode
+		want     int64
+		currency string
+	}{
+		{in: "10.005", mode: roundHalfUp, want: 1001, currency: "RUB"},
+		{in: "-10.005", mode: roundHalfUp, want: -1001, currency: "RUB"},
+		{in: "10.0049", mode: roundHalfUp, want: 1000, currency: "RUB"},
+		{in: "10.005", mode: roundHalfEven, want: 1000, currency: "RUB"},
+		{in: "10.015", mode: roundHalfEven, want: 1002, currency: "RUB"},
+		{in: "10.0051", mode: roundHalfEven, want: 1001, currency: "RUB"},
+		{in: "1500.5", mode: roundHalfEven, want: 1500, currency: "JPY"},
+		{in: "1.2345", mode: roundHalfUp, want: 1235, currency: "BHD"},
+		{in: "1.000", mode: roundReject, want: 1000, currency: "BHD"},
+	}
+	for _, tc := range tests {
+		got, err := parseMoneyWith(tc.in, tc.currency, tc.mode)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%q (mode %d): expected %d, got %d", tc.in, tc.mode, tc.want, got)
+		}
+	}
+
+	if _, err := parseRoundingMode("ceil"); err == nil {
+		t.Fatal("expected error for unknown rounding mode")
+	}
+}
+
+func TestParseMoneyAmbiguousSeparator(t *testing.T) {
+	// Одна запятая перед тремя цифрами — то ли тысячи, то ли дробь с лишним
+	// знаком; угадывать нельзя ни при каком режиме округления.
+	for _, in := range []string{"1,000", "1,234", "-12,340"} {
+		for _, mode := range []roundingMode{roundReject, roundHalfUp, roundHalfEven} {
+			if got, err := parseMoneyWith(in, "RUB", mode); err == nil || !strings.Contains(err.Error(), "непонятно") {
+				t.Fatalf("%q (mode %d): expected ambiguity error, got %d, %v", in, mode, got, err)
+			}
+		}
+	}
+
+	// Точка всегда десятичная.
+	if got, err := parseMoneyWith("1.500", "RUB", roundReject); err != nil || got != 150 {
+		t.Fatalf("1.500: expected 150, got %d, %v", got, err)
+	}
+
+	// С известным десятичным разделителем, как в профиле импорта, неоднозначности нет.
+	tests := []struct {
+		in, sep string
+		want    int64
+	}{
+		{in: "1,000", sep: ".", want: 100000},
+		{in: "1.000", sep: ",", want: 100000},
+		{in: "1,234", sep: ",", want: 123},
+		{in: "1.000", sep: ".", want: 100},
+	}
+	for _, tc := range tests {
+		got, err := parseAmount(tc.in, "RUB", tc.sep, roundHalfUp)
+		if err != nil {
+			t.Fatalf("%q sep %q: %v", tc.in, tc.sep, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%q sep %q: expected %d, got %d", tc.in, tc.sep, tc.want, got)
+		}
+	}
+}
+
+func TestMoneyMarshalsExactDecimalString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{m: Money{Minor: 123456789, Currency: "RUB"}, want: `"1234567.89"`},
+		{m: Money{Minor: -5, Currency: "RUB"}, want: `"-0.05"`},
+		{m: Money{Minor: 0, Currency: "USD"}, want: `"0.00"`},
+		{m: Money{Minor: 1500, Currency: "JPY"}, want: `"1500"`},
+		{m: Money{Minor: -1234, Currency: "BHD"}, want: `"-1.234"`},
+		{m: Money{Minor: 9223372036854775807, Currency: "RUB"}, want: `"92233720368547758.07"`},
+		{m: Money{Minor: -9223372036854775808, Currency: "RUB"}, want: `"-92233720368547758.08"`},
+	}
+	for _, tc := range tests {
+		data, err := json.Marshal(tc.m)
+		if err != nil {
+			t.Fatalf("marshal %d: %v", tc.m.Minor, err)
+		}
+		if string(data) != tc.want {
+			t.Fatalf("%d %s: expected %s, got %s", tc.m.Minor, tc.m.Currency, tc.want, data)
+		}
+	}
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Частоты повторяющихся операций.
+const (
+	// frequencyDaily — каждые Interval дней от StartDate.
+	frequencyDaily = "daily"
+	// frequencyWeekly — каждые Interval недель в день недели StartDate.
+	frequencyWeekly = "weekly"
+	// frequencyMonthly — каждые Interval месяцев в день DayOfMonth (31 — последний день месяца).
+	frequencyMonthly = "monthly"
+	// frequencyLastBusinessDay — последний будний день каждого Interval-го месяца.
+	frequencyLastBusinessDay = "last_business_day"
+)
+
+var recurringFrequencies = map[string]bool{
+	frequencyDaily:           true,
+	frequencyWeekly:          true,
+	frequencyMonthly:         true,
+	frequencyLastBusinessDay: true,
+}
+
+// Состояния отдельной даты шаблона.
+const (
+	occurrenceSkipped  = "skipped"
+	occurrenceOverride = "override"
+	occurrencePosted   = "posted"
+)
+
+// defaultUpcomingDays — горизонт списка запланированных операций по умолчанию.
+const defaultUpcomingDays = 30
+
+// RecurringTemplate описывает повторяющуюся операцию. Сумма — в минимальных
+// единицах валюты счёта. CategoryID == 0 — категорию подберут правила.
+type RecurringTemplate struct {
+	ID           int64
+	AccountID    int64
+	CategoryID   int64
+	AmountKopeks int64
+	Currency     string
+	Note         string
+	Counterparty string
+	Frequency    string
+	Interval     int
+	DayOfMonth   int
+	StartDate    time.Time
+	EndDate      time.Time // нулевая — без окончания
+	// PostedThrough — день, по который операции уже созданы (нулевой — ещё ни одной).
+	PostedThrough time.Time
+}
+
+func (r *RecurringTemplate) normalize() error {
+	if r.AccountID == 0 {
+		r.AccountID = defaultAccountID
+	}
+	if r.AmountKopeks == 0 {
+		return errors.New("сумма повторяющейся операции не указана")
+	}
+	if !recurringFrequencies[r.Frequency] {
+		return fmt.Errorf("неизвестная частота %q (ожидается daily, weekly, monthly или last_business_day)", r.Frequency)
+	}
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	if r.Interval < 0 {
+		return errors.New("интервал должен быть положительным")
+	}
+	if r.StartDate.IsZero() {
+		return errors.New("дата начала не указана")
+	}
+	r.StartDate = dayOf(r.StartDate)
+	if r.Frequency == frequencyMonthly && r.DayOfMonth == 0 {
+		r.DayOfMonth = r.StartDate.Day()
+	}
+	if r.DayOfMonth < 0 || r.DayOfMonth > 31 {
+		return errors.New("день месяца должен быть от 1 до 31")
+	}
+	if !r.EndDate.IsZero() {
+		r.EndDate = dayOf(r.EndDate)
+		if r.EndDate.Before(r.StartDate) {
+			return errors.New("дата окончания раньше даты начала")
+		}
+	}
+	return nil
+}
+
+// occurrence возвращает k-ю по счёту дату шаблона (k с нуля, без учёта StartDate
+// для месячных частот: первая дата может оказаться раньше начала).
+func (r RecurringTemplate) occurrence(k int) time.Time {
+	switch r.Frequency {
+	case frequencyDaily:
+		return r.StartDate.AddDate(0, 0, k*r.Interval)
+	case frequencyWeekly:
+		return r.StartDate.AddDate(0, 0, 7*k*r.Interval)
+	case frequencyLastBusinessDay:
+		month := addMonthsClamped(time.Date(r.StartDate.Year(), r.StartDate.Month(), 1, 0, 0, 0, 0, time.UTC), k*r.Interval)
+		day := month.AddDate(0, 1, -1)
+		for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			day = day.AddDate(0, 0, -1)
+		}
+		return day
+	default:
+		month := addMonthsClamped(time.Date(r.StartDate.Year(), r.StartDate.Month(), 1, 0, 0, 0, 0, time.UTC), k*r.Interval)
+		lastDay := month.AddDate(0, 1, -1).Day()
+		return time.Date(month.Year(), month.Month(), min(r.DayOfMonth, lastDay), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// datesBetween перечисляет даты шаблона в [from, to] с учётом StartDate и EndDate.
+func (r RecurringTemplate) datesBetween(from, to time.Time) []time.Time {
+	if from.Before(r.StartDate) {
+		from = r.StartDate
+	}
+	if !r.EndDate.IsZero() && r.EndDate.Before(to) {
+		to = r.EndDate
+	}
+	var out []time.Time
+	for k := 0; ; k++ {
+		d := r.occurrence(k)
+		if d.After(to) {
+			return out
+		}
+		if !d.Before(from) {
+			out = append(out, d)
+		}
+	}
+}
+
+const recurringColumns = `r.id, r.account_id, COALESCE(r.category_id, 0), r.amount_kopeks, a.currency, r.note, r.counterparty,
+	r.frequency, r.interval, r.day_of_month, r.start_date, COALESCE(r.end_date, ''), COALESCE(r.posted_through, '')`
+
+const recurringFrom = ` FROM recurring_templates r JOIN accounts a ON a.id = r.account_id`
+
+func scanRecurring(row interface{ Scan(dest ...any) error }) (RecurringTemplate, error) {
+	var r RecurringTemplate
+	var start, end, posted string
+	if err := row.Scan(&r.ID, &r.AccountID, &r.CategoryID, &r.AmountKopeks, &r.Currency, &r.Note, &r.Counterparty,
+		&r.Frequency, &r.Interval, &r.DayOfMonth, &start, &end, &posted); err != nil {
+		return RecurringTemplate{}, err
+	}
+	r.StartDate, _ = time.Parse("2006-01-02", start)
+	if end != "" {
+		r.EndDate, _ = time.Parse("2006-01-02", end)
+	}
+	if posted != "" {
+		r.PostedThrough, _ = time.Parse("2006-01-02", posted)
+	}
+	return r, nil
+}
+
+// nullDate превращает нулевую дату в NULL.
+func nullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+// SaveRecurring создаёт шаблон (r.ID == 0) или меняет существующий. Изменения
+// действуют только на ещё не созданные операции.
+func (l *Ledger) SaveRecurring(r RecurringTemplate) (RecurringTemplate, error) {
+	if err := r.normalize(); err != nil {
+		return RecurringTemplate{}, err
+	}
+	if _, err := accountCurrency(l.db, r.AccountID); err != nil {
+		return RecurringTemplate{}, err
+	}
+	if r.CategoryID != 0 {
+		if err := checkCategorySign(l.db, Transaction{CategoryID: r.CategoryID, AmountKopeks: r.AmountKopeks}); err != nil {
+			return RecurringTemplate{}, err
+		}
+		if err := checkCategoryActive(l.db, r.CategoryID); err != nil {
+			return RecurringTemplate{}, err
+		}
+	}
+
+	args := []any{r.AccountID, nullID(r.CategoryID), r.AmountKopeks, r.Note, r.Counterparty, r.Frequency, r.Interval,
+		r.DayOfMonth, r.StartDate.Format("2006-01-02"), nullDate(r.EndDate)}
+	if r.ID == 0 {
+		res, err := l.db.Exec(`
+INSERT INTO recurring_templates (account_id, category_id, amount_kopeks, note, counterparty, frequency, interval,
+	day_of_month, start_date, end_date)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+		if err != nil {
+			return RecurringTemplate{}, fmt.Errorf("сохранение шаблона: %w", err)
+		}
+		r.ID, _ = res.LastInsertId()
+		return l.GetRecurring(r.ID)
+	}
+
+	res, err := l.db.Exec(`
+UPDATE recurring_templates SET account_id = ?, category_id = ?, amount_kopeks = ?, note = ?, counterparty = ?,
+	frequency = ?, interval = ?, day_of_month = ?, start_date = ?, end_date = ?
+WHERE id = ?`, append(args, r.ID)...)
+	if err != nil {
+		return RecurringTemplate{}, fmt.Errorf("обновление шаблона: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return RecurringTemplate{}, fmt.Errorf("%w: шаблон %d", errNotFound, r.ID)
+	}
+	return l.GetRecurring(r.ID)
+}
+
+func (l *Ledger) GetRecurring(id int64) (RecurringTemplate, error) {
+	r, err := scanRecurring(l.db.QueryRow("SELECT "+recurringColumns+recurringFrom+" WHERE r.id = ?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RecurringTemplate{}, fmt.Errorf("%w: шаблон %d", errNotFound, id)
+		}
+		return RecurringTemplate{}, fmt.Errorf("чтение шаблона: %w", err)
+	}
+	return r, nil
+}
+
+func (l *Ledger) ListRecurring() ([]RecurringTemplate, error) {
+	rows, err := l.db.Query("SELECT " + recurringColumns + recurringFrom + " ORDER BY r.id")
+	if err != nil {
+		return nil, fmt.Errorf("чтение шаблонов: %w", err)
+	}
+	defer rows.Close()
+
+	var out []RecurringTemplate
+	for rows.Next() {
+		r, err := scanRecurring(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan recurring: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// DeleteRecurring удаляет шаблон; уже созданные по нему операции остаются.
+func (l *Ledger) DeleteRecurring(id int64) error {
+	res, err := l.db.Exec("DELETE FROM recurring_templates WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("удаление шаблона: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("%w: шаблон %d", errNotFound, id)
+	}
+	return nil
+}
+
+// RecurringOccurrence — особая отметка для одной даты шаблона: пропуск или
+// изменённые сумма, дата проведения и комментарий (нулевые — как в шаблоне).
+type RecurringOccurrence struct {
+	TemplateID    int64
+	Date          time.Time
+	Status        string
+	AmountKopeks  int64
+	OccurredAt    time.Time
+	Note          string
+	TransactionID int64
+}
+
+func occurrenceKey(templateID int64, date time.Time) []any {
+	return []any{templateID, dayOf(date).Format("2006-01-02")}
+}
+
+// loadOccurrences возвращает отметки шаблона по дате.
+func loadOccurrences(q rowsQuerier, templateID int64) (map[string]RecurringOccurrence, error) {
+	rows, err := q.Query(`
+SELECT occurrence_date, status, COALESCE(amount_kopeks, 0), COALESCE(occurred_at, ''), COALESCE(note, ''),
+	COALESCE(transaction_id, 0)
+FROM recurring_occurrences WHERE template_id = ?`, templateID)
+	if err != nil {
+		return nil, fmt.Errorf("чтение отметок шаблона: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]RecurringOccurrence)
+	for rows.Next() {
+		o := RecurringOccurrence{TemplateID: templateID}
+		var date, occurredAt string
+		if err := rows.Scan(&date, &o.Status, &o.AmountKopeks, &occurredAt, &o.Note, &o.TransactionID); err != nil {
+			return nil, fmt.Errorf("scan occurrence: %w", err)
+		}
+		o.Date, _ = time.Parse("2006-01-02", date)
+		if occurredAt != "" {
+			o.OccurredAt, _ = time.Parse("2006-01-02", occurredAt)
+		}
+		out[date] = o
+	}
+	return out, rows.Err()
+}
+
+// SetOccurrence пропускает дату шаблона (o.Status == occurrenceSkipped) или
+// меняет для неё сумму, дату проведения и комментарий. Дату, по которой операция
+// уже создана, менять нельзя — правьте саму операцию.
+func (l *Ledger) SetOccurrence(o RecurringOccurrence) (RecurringOccurrence, error) {
+	r, err := l.GetRecurring(o.TemplateID)
+	if err != nil {
+		return RecurringOccurrence{}, err
+	}
+	o.Date = dayOf(o.Date)
+	if !containsDate(r.datesBetween(o.Date, o.Date), o.Date) {
+		return RecurringOccurrence{}, fmt.Errorf("%w: у шаблона %d нет даты %s", errNotFound, r.ID, o.Date.Format("2006-01-02"))
+	}
+	if !r.PostedThrough.IsZero() && !o.Date.After(r.PostedThrough) {
+		return RecurringOccurrence{}, fmt.Errorf("%w: дата %s уже обработана планировщиком", errConflict, o.Date.Format("2006-01-02"))
+	}
+	switch o.Status {
+	case occurrenceSkipped:
+		o.AmountKopeks, o.OccurredAt, o.Note = 0, time.Time{}, ""
+	case "", occurrenceOverride:
+		o.Status = occurrenceOverride
+		if o.AmountKopeks == 0 && o.OccurredAt.IsZero() && o.Note == "" {
+			return RecurringOccurrence{}, errors.New("укажите сумму, дату или комментарий для этой даты")
+		}
+	default:
+		return RecurringOccurrence{}, fmt.Errorf("неизвестное состояние %q (ожидается skipped или override)", o.Status)
+	}
+
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return RecurringOccurrence{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+	if err := checkOccurrenceNotPosted(txObj, o.TemplateID, o.Date); err != nil {
+		return RecurringOccurrence{}, err
+	}
+	var note any
+	if o.Note != "" {
+		note = o.Note
+	}
+	if _, err := txObj.Exec(`
+INSERT INTO recurring_occurrences (template_id, occurrence_date, status, amount_kopeks, occurred_at, note)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(template_id, occurrence_date) DO UPDATE SET status = excluded.status, amount_kopeks = excluded.amount_kopeks,
+	occurred_at = excluded.occurred_at, note = excluded.note`,
+		append(occurrenceKey(o.TemplateID, o.Date), o.Status, nullID(o.AmountKopeks), nullDate(o.OccurredAt), note)...); err != nil {
+		return RecurringOccurrence{}, fmt.Errorf("сохранение отметки шаблона: %w", err)
+	}
+	if err := txObj.Commit(); err != nil {
+		return RecurringOccurrence{}, fmt.Errorf("commit: %w", err)
+	}
+	return o, nil
+}
+
+// ClearOccurrence возвращает дате шаблона обычное поведение.
+func (l *Ledger) ClearOccurrence(templateID int64, date time.Time) error {
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+	if err := checkOccurrenceNotPosted(txObj, templateID, date); err != nil {
+		return err
+	}
+	res, err := txObj.Exec("DELETE FROM recurring_occurrences WHERE template_id = ? AND occurrence_date = ?", occurrenceKey(templateID, date)...)
+	if err != nil {
+		return fmt.Errorf("удаление отметки шаблона: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("%w: отметка шаблона %d на %s", errNotFound, templateID, dayOf(date).Format("2006-01-02"))
+	}
+	if err := txObj.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func checkOccurrenceNotPosted(q rowQuerier, templateID int64, date time.Time) error {
+	var status string
+	err := q.QueryRow("SELECT status FROM recurring_occurrences WHERE template_id = ? AND occurrence_date = ?", occurrenceKey(templateID, date)...).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("чтение отметки шаблона: %w", err)
+	}
+	if status == occurrencePosted {
+		return fmt.Errorf("%w: операция за %s уже создана", errConflict, dayOf(date).Format("2006-01-02"))
+	}
+	return nil
+}
+
+func containsDate(dates []time.Time, d time.Time) bool {
+	for _, x := range dates {
+		if x.Equal(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlannedTransaction — будущая операция по шаблону.
+type PlannedTransaction struct {
+	TemplateID   int64
+	Date         time.Time // дата по расписанию
+	OccurredAt   time.Time // дата проведения с учётом изменения
+	AccountID    int64
+	CategoryID   int64
+	AmountKopeks int64
+	Currency     string
+	Note         string
+	Skipped      bool
+	Overridden   bool
+}
+
+func planned(r RecurringTemplate, date time.Time, o RecurringOccurrence) PlannedTransaction {
+	p := PlannedTransaction{
+		TemplateID:   r.ID,
+		Date:         date,
+		OccurredAt:   date,
+		AccountID:    r.AccountID,
+		CategoryID:   r.CategoryID,
+		AmountKopeks: r.AmountKopeks,
+		Currency:     r.Currency,
+		Note:         r.Note,
+	}
+	switch o.Status {
+	case occurrenceSkipped:
+		p.Skipped = true
+	case occurrenceOverride:
+		p.Overridden = true
+		if o.AmountKopeks != 0 {
+			p.AmountKopeks = o.AmountKopeks
+		}
+		if !o.OccurredAt.IsZero() {
+			p.OccurredAt = o.OccurredAt
+		}
+		if o.Note != "" {
+			p.Note = o.Note
+		}
+	}
+	return p
+}
+
+// UpcomingRecurring перечисляет ещё не созданные операции по всем шаблонам
+// с from по to включительно (пропущенные даты тоже, с Skipped), по дате.
+func (l *Ledger) UpcomingRecurring(from, to time.Time) ([]PlannedTransaction, error) {
+	from, to = dayOf(from), dayOf(to)
+	templates, err := l.ListRecurring()
+	if err != nil {
+		return nil, err
+	}
+	var out []PlannedTransaction
+	for _, r := range templates {
+		start := from
+		if !r.PostedThrough.IsZero() && !r.PostedThrough.Before(start) {
+			start = r.PostedThrough.AddDate(0, 0, 1)
+		}
+		dates := r.datesBetween(start, to)
+		if len(dates) == 0 {
+			continue
+		}
+		marks, err := loadOccurrences(l.db, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dates {
+			out = append(out, planned(r, d, marks[d.Format("2006-01-02")]))
+		}
+	}
+	slices.SortStableFunc(out, func(a, b PlannedTransaction) int { return a.Date.Compare(b.Date) })
+	return out, nil
+}
+
+// PostDueRecurring создаёт операции по всем шаблонам за даты по today включительно,
+// которые ещё не созданы. Повторный вызов ничего не дублирует: каждый шаблон
+// помнит, по какой день он обработан, а у операций есть отпечаток шаблон+дата.
+// Ошибка одного шаблона не мешает остальным: ошибки всех шаблонов собираются
+// и возвращаются вместе после обхода.
+func (l *Ledger) PostDueRecurring(today time.Time) (int, error) {
+	today = dayOf(today)
+	templates, err := l.ListRecurring()
+	if err != nil {
+		return 0, err
+	}
+	posted := 0
+	var errs []error
+	for _, r := range templates {
+		n, err := l.postTemplate(r, today)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("шаблон %d: %w", r.ID, err))
+			continue
+		}
+		posted += n
+	}
+	return posted, errors.Join(errs...)
+}
+
+func (l *Ledger) postTemplate(r RecurringTemplate, today time.Time) (int, error) {
+	from := r.StartDate
+	if !r.PostedThrough.IsZero() {
+		from = r.PostedThrough.AddDate(0, 0, 1)
+	}
+	if from.After(today) {
+		return 0, nil
+	}
+
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	marks, err := loadOccurrences(txObj, r.ID)
+	if err != nil {
+		return 0, err
+	}
+	posted := 0
+	for _, d := range r.datesBetween(from, today) {
+		key := d.Format("2006-01-02")
+		p := planned(r, d, marks[key])
+		if p.Skipped || marks[key].Status == occurrencePosted {
+			continue
+		}
+		t := Transaction{
+			AccountID:    p.AccountID,
+			CategoryID:   p.CategoryID,
+			AmountKopeks: p.AmountKopeks,
+			OccurredAt:   p.OccurredAt,
+			Note:         p.Note,
+			Counterparty: r.Counterparty,
+			Fingerprint:  fmt.Sprintf("recurring:%d:%s", r.ID, key),
+		}
+		if err := categorize(txObj, &t); err != nil {
+			return 0, err
+		}
+		saved, err := l.addTransaction(txObj, t)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := txObj.Exec(`
+INSERT INTO recurring_occurrences (template_id, occurrence_date, status, transaction_id) VALUES (?, ?, ?, ?)
+ON CONFLICT(template_id, occurrence_date) DO UPDATE SET status = excluded.status, transaction_id = excluded.transaction_id`,
+			append(occurrenceKey(r.ID, d), occurrencePosted, saved.ID)...); err != nil {
+			return 0, fmt.Errorf("отметка созданной операции: %w", err)
+		}
+		posted++
+	}
+	if _, err := txObj.Exec("UPDATE recurring_templates SET posted_through = ? WHERE id = ?", today.Format("2006-01-02"), r.ID); err != nil {
+		return 0, fmt.Errorf("обновление шаблона: %w", err)
+	}
+	if err := txObj.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return posted, nil
+}
+
+// runRecurringScheduler создаёт операции по шаблонам сразу при запуске и затем
+// раз в сутки, вскоре после полуночи. Ошибки только логируются: следующий
+// запуск догонит пропущенные дни.
+func runRecurringScheduler(l *Ledger, stop <-chan struct{}) {
+	for {
+		n, err := l.PostDueRecurring(time.Now())
+		if err != nil {
+			log.Printf("повторяющиеся операции: %v", err)
+		}
+		if n > 0 {
+			log.Printf("Создано повторяющихся операций: %d", n)
+		}
+
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 5, 0, 0, now.Location())
+		select {
+		case <-stop:
+			return
+		case <-time.After(next.Sub(now)):
+		}
+	}
+}
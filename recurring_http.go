@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurringReq — тело POST /recurring и PUT /recurring/{id}. Сумма — в валюте счёта.
+type recurringReq struct {
+	AccountID    int64  `json:"account_id"`
+	CategoryID   int64  `json:"category_id"`
+	Amount       string `json:"amount"`
+	Note         string `json:"note"`
+	Counterparty string `json:"counterparty"`
+	Frequency    string `json:"frequency"` // daily, weekly, monthly, last_business_day
+	Interval     int    `json:"interval"`
+	DayOfMonth   int    `json:"day_of_month"`
+	StartDate    string `json:"start_date"`
+	EndDate      string `json:"end_date"`
+}
+
+func (s *server) recurringFromReq(req recurringReq) (RecurringTemplate, error) {
+	if req.AccountID == 0 {
+		req.AccountID = defaultAccountID
+	}
+	acc, err := s.ledger.GetAccount(req.AccountID)
+	if err != nil {
+		return RecurringTemplate{}, err
+	}
+	amount, err := parseMoney(req.Amount, acc.Currency)
+	if err != nil {
+		return RecurringTemplate{}, err
+	}
+	start, err := parseDate(req.StartDate)
+	if err != nil {
+		return RecurringTemplate{}, err
+	}
+	end, err := parseDate(req.EndDate)
+	if err != nil {
+		return RecurringTemplate{}, err
+	}
+	return RecurringTemplate{
+		AccountID:    req.AccountID,
+		CategoryID:   req.CategoryID,
+		AmountKopeks: amount,
+		Note:         req.Note,
+		Counterparty: req.Counterparty,
+		Frequency:    req.Frequency,
+		Interval:     req.Interval,
+		DayOfMonth:   req.DayOfMonth,
+		StartDate:    start,
+		EndDate:      end,
+	}, nil
+}
+
+// handleRecurring поддерживает GET (список) и POST (создание) шаблонов.
+func (s *server) handleRecurring(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := s.ledger.ListRecurring()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, templates)
+	case http.MethodPost:
+		var req recurringReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		tpl, err := s.recurringFromReq(req)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		tpl, err = s.ledger.SaveRecurring(tpl)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, tpl)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRecurringByID поддерживает GET/PUT/DELETE /recurring/{id} и
+// PUT/DELETE /recurring/{id}/occurrences/{YYYY-MM-DD} — пропуск или изменение одной даты.
+func (s *server) handleRecurringByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := splitIDPath(r.URL.Path, "/recurring/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if rawDate, ok := strings.CutPrefix(action, "occurrences/"); ok {
+		s.handleOccurrence(w, r, id, rawDate)
+		return
+	}
+	if action != "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tpl, err := s.ledger.GetRecurring(id)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tpl)
+	case http.MethodPut:
+		var req recurringReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		tpl, err := s.recurringFromReq(req)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		tpl.ID = id
+		tpl, err = s.ledger.SaveRecurring(tpl)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tpl)
+	case http.MethodDelete:
+		if err := s.ledger.DeleteRecurring(id); err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOccurrence: PUT с {"skip": true} пропускает дату, с amount/occurred_at/note —
+// меняет операцию за эту дату; DELETE возвращает дате обычное поведение.
+func (s *server) handleOccurrence(w http.ResponseWriter, r *http.Request, templateID int64, rawDate string) {
+	date, err := parseDate(rawDate)
+	if err != nil || date.IsZero() {
+		writeError(w, http.StatusBadRequest, errors.New("дата должна быть в формате YYYY-MM-DD"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			Skip       bool   `json:"skip"`
+			Amount     string `json:"amount"`
+			OccurredAt string `json:"occurred_at"`
+			Note       string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		o := RecurringOccurrence{TemplateID: templateID, Date: date, Note: req.Note}
+		if req.Skip {
+			o.Status = occurrenceSkipped
+		}
+		if req.Amount != "" {
+			tpl, err := s.ledger.GetRecurring(templateID)
+			if err != nil {
+				writeLedgerError(w, err)
+				return
+			}
+			if o.AmountKopeks, err = parseMoney(req.Amount, tpl.Currency); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if o.OccurredAt, err = parseDate(req.OccurredAt); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		o, err = s.ledger.SetOccurrence(o)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, o)
+	case http.MethodDelete:
+		if err := s.ledger.ClearOccurrence(templateID, date); err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRecurringUpcoming — GET /recurring/upcoming?days=30: ещё не созданные
+// операции по шаблонам с сегодняшнего дня (или from) на days дней вперёд (или по to).
+func (s *server) handleRecurringUpcoming(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	from, err := parseDate(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if from.IsZero() {
+		from = dayOf(time.Now())
+	}
+	to, err := parseDate(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if to.IsZero() {
+		days := defaultUpcomingDays
+		if raw := q.Get("days"); raw != "" {
+			if days, err = strconv.Atoi(raw); err != nil || days <= 0 {
+				writeError(w, http.StatusBadRequest, errors.New("days должен быть положительным числом"))
+				return
+			}
+		}
+		to = from.AddDate(0, 0, days)
+	}
+
+	items, err := s.ledger.UpcomingRecurring(from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// handleRecurringRun — POST /recurring/run: создать операции за наступившие даты
+// сейчас, не дожидаясь планировщика.
+func (s *server) handleRecurringRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := s.ledgerFor(r).PostDueRecurring(time.Now())
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"posted": n})
+}
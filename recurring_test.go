@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecurringOccurrenceDates(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	rent := RecurringTemplate{Frequency: frequencyMonthly, Interval: 1, DayOfMonth: 31, StartDate: day(2024, time.January, 31)}
+	got := rent.datesBetween(day(2024, time.January, 1), day(2024, time.April, 30))
+	want := []time.Time{day(2024, time.January, 31), day(2024, time.February, 29), day(2024, time.March, 31), day(2024, time.April, 30)}
+	if len(got) != len(want) {
+		t.Fatalf("monthly dates: %v", got)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("monthly date %d: got %s want %s", i, got[i], want[i])
+		}
+	}
+
+	// Июнь 2024 заканчивается воскресеньем, август — субботой.
+	salary := RecurringTemplate{Frequency: frequencyLastBusinessDay, Interval: 1, StartDate: day(2024, time.June, 1)}
+	got = salary.datesBetween(day(2024, time.June, 1), day(2024, time.August, 31))
+	want = []time.Time{day(2024, time.June, 28), day(2024, time.July, 31), day(2024, time.August, 30)}
+	for i := range want {
+		if i >= len(got) || !got[i].Equal(want[i]) {
+			t.Fatalf("last business days: got %v want %v", got, want)
+		}
+	}
+
+	every10 := RecurringTemplate{Frequency: frequencyDaily, Interval: 10, StartDate: day(2024, time.May, 1), EndDate: day(2024, time.May, 25)}
+	if got := every10.datesBetween(day(2024, time.May, 5), day(2024, time.June, 30)); len(got) != 2 || !got[0].Equal(day(2024, time.May, 11)) {
+		t.Fatalf("every 10 days: %v", got)
+	}
+}
+
+func TestPostDueRecurringContinuesPastBrokenTemplate(t *testing.T) {
+	ledger := newTestLedger(t)
+	gym, _ := ledger.CreateCategory("Gym")
+	rent, _ := ledger.CreateCategory("Rent")
+
+	start := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	var templates []RecurringTemplate
+	for _, categoryID := range []int64{gym.ID, rent.ID} {
+		tpl, err := ledger.SaveRecurring(RecurringTemplate{AccountID: defaultAccountID, CategoryID: categoryID, AmountKopeks: -1_000,
+			Frequency: frequencyMonthly, StartDate: start})
+		if err != nil {
+			t.Fatalf("save template: %v", err)
+		}
+		templates = append(templates, tpl)
+	}
+	// Первый шаблон ломается уже после сохранения: его категория ушла в архив.
+	if _, err := ledger.db.Exec("UPDATE categories SET archived = 1 WHERE id = ?", gym.ID); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	n, err := ledger.PostDueRecurring(start)
+	if n != 1 || !errors.Is(err, errConflict) || !strings.Contains(err.Error(), fmt.Sprintf("шаблон %d", templates[0].ID)) {
+		t.Fatalf("broken template must not stop the others: n=%d err=%v", n, err)
+	}
+	if posted, _ := ledger.GetRecurring(templates[1].ID); !posted.PostedThrough.Equal(start) {
+		t.Fatalf("second template must be posted: %+v", posted)
+	}
+}
+
+func TestPostDueRecurringSkipOverrideAndIdempotency(t *testing.T) {
+	ledger := newTestLedger(t)
+	subs, _ := ledger.CreateCategory("Subscriptions")
+
+	start := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	tpl, err := ledger.SaveRecurring(RecurringTemplate{
+		AccountID:    defaultAccountID,
+		CategoryID:   subs.ID,
+		AmountKopeks: -29_900,
+		Note:         "Музыка",
+		Frequency:    frequencyWeekly,
+		StartDate:    start,
+	})
+	if err != nil {
+		t.Fatalf("save template: %v", err)
+	}
+
+	if _, err := ledger.SetOccurrence(RecurringOccurrence{TemplateID: tpl.ID, Date: start.AddDate(0, 0, 7), Status: occurrenceSkipped}); err != nil {
+		t.Fatalf("skip: %v", err)
+	}
+	if _, err := ledger.SetOccurrence(RecurringOccurrence{TemplateID: tpl.ID, Date: start.AddDate(0, 0, 14), AmountKopeks: -39_900}); err != nil {
+		t.Fatalf("override: %v", err)
+	}
+	if _, err := ledger.SetOccurrence(RecurringOccurrence{TemplateID: tpl.ID, Date: start.AddDate(0, 0, 1), Status: occurrenceSkipped}); !errors.Is(err, errNotFound) {
+		t.Fatalf("date outside schedule must be rejected, got %v", err)
+	}
+
+	upcoming, err := ledger.UpcomingRecurring(start, start.AddDate(0, 0, 20))
+	if err != nil {
+		t.Fatalf("upcoming: %v", err)
+	}
+	if len(upcoming) != 3 || !upcoming[1].Skipped || upcoming[2].AmountKopeks != -39_900 {
+		t.Fatalf("unexpected upcoming: %+v", upcoming)
+	}
+
+	today := start.AddDate(0, 0, 20)
+	n, err := ledger.PostDueRecurring(today)
+	if err != nil || n != 2 {
+		t.Fatalf("first run: n=%d err=%v", n, err)
+	}
+	if n, err := ledger.PostDueRecurring(today); err != nil || n != 0 {
+		t.Fatalf("second run must not duplicate: n=%d err=%v", n, err)
+	}
+
+	summary, err := ledger.Summary(SummaryFilter{From: start, To: today})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if got := findSummary(summary, subs.ID); got.ExpenseKopeks != -(29_900 + 39_900) {
+		t.Fatalf("unexpected expense: %+v", got)
+	}
+
+	if _, err := ledger.SetOccurrence(RecurringOccurrence{TemplateID: tpl.ID, Date: start.AddDate(0, 0, 14), Status: occurrenceSkipped}); !errors.Is(err, errConflict) {
+		t.Fatalf("posted occurrence must not change, got %v", err)
+	}
+	if err := ledger.ClearOccurrence(tpl.ID, start.AddDate(0, 0, 14)); !errors.Is(err, errConflict) {
+		t.Fatalf("posted occurrence must not be cleared, got %v", err)
+	}
+
+	upcoming, err = ledger.UpcomingRecurring(start, today.AddDate(0, 0, 5))
+	if err != nil {
+		t.Fatalf("upcoming after run: %v", err)
+	}
+	if len(upcoming) != 1 || !upcoming[0].Date.Equal(start.AddDate(0, 0, 21)) {
+		t.Fatalf("only future dates expected: %+v", upcoming)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CategoryRule назначает категорию операциям, которые пришли без неё.
+// Пустые условия не проверяются, заданные должны выполниться все сразу.
+// Суммы сравниваются со знаком: расходы отрицательные.
+type CategoryRule struct {
+	ID         int64
+	CategoryID int64
+	// Priority — из нескольких подходящих правил срабатывает правило с большим
+	// приоритетом, при равенстве — созданное раньше.
+	Priority        int
+	NoteContains    string
+	NoteRegex       string
+	MinAmountKopeks *int64
+	MaxAmountKopeks *int64
+	AccountID       int64
+	Counterparty    string
+}
+
+// compiledRule — правило с уже разобранным регулярным выражением и типом категории.
+type compiledRule struct {
+	CategoryRule
+	re   *regexp.Regexp
+	kind string
+}
+
+func (r *CategoryRule) compile() (compiledRule, error) {
+	c := compiledRule{CategoryRule: *r}
+	if r.NoteRegex == "" {
+		return c, nil
+	}
+	re, err := regexp.Compile(r.NoteRegex)
+	if err != nil {
+		return c, fmt.Errorf("регулярное выражение %q: %w", r.NoteRegex, err)
+	}
+	c.re = re
+	return c, nil
+}
+
+func (r *CategoryRule) validate() error {
+	r.NoteContains = strings.TrimSpace(r.NoteContains)
+	r.Counterparty = strings.TrimSpace(r.Counterparty)
+	if r.CategoryID == 0 {
+		return errors.New("categoryID не указан")
+	}
+	if r.NoteContains == "" && r.NoteRegex == "" && r.MinAmountKopeks == nil && r.MaxAmountKopeks == nil &&
+		r.AccountID == 0 && r.Counterparty == "" {
+		return errors.New("у правила нет ни одного условия")
+	}
+	if r.MinAmountKopeks != nil && r.MaxAmountKopeks != nil && *r.MinAmountKopeks > *r.MaxAmountKopeks {
+		return errors.New("минимальная сумма больше максимальной")
+	}
+	_, err := r.compile()
+	return err
+}
+
+// matches проверяет условия правила. Правило не назначает категорию, тип
+// которой не допускает знак суммы: такую операцию нужно разобрать вручную.
+func (r compiledRule) matches(t Transaction) bool {
+	if r.AccountID != 0 && r.AccountID != t.AccountID {
+		return false
+	}
+	if !kindAllows(r.kind, t.AmountKopeks, t.Refund) {
+		return false
+	}
+	if r.MinAmountKopeks != nil && t.AmountKopeks < *r.MinAmountKopeks {
+		return false
+	}
+	if r.MaxAmountKopeks != nil && t.AmountKopeks > *r.MaxAmountKopeks {
+		return false
+	}
+	if r.NoteContains != "" && !strings.Contains(normalizeNote(t.Note), normalizeNote(r.NoteContains)) {
+		return false
+	}
+	if r.Counterparty != "" && !strings.Contains(normalizeNote(t.Counterparty), normalizeNote(r.Counterparty)) {
+		return false
+	}
+	if r.re != nil && !r.re.MatchString(t.Note) {
+		return false
+	}
+	return true
+}
+
+// ruleSet — правила в порядке убывания приоритета, кроме правил архивных категорий.
+type ruleSet []compiledRule
+
+// match возвращает первое подходящее правило.
+func (rs ruleSet) match(t Transaction) (CategoryRule, bool) {
+	for _, r := range rs {
+		if r.matches(t) {
+			return r.CategoryRule, true
+		}
+	}
+	return CategoryRule{}, false
+}
+
+// rowsQuerier — общее у *sql.DB и *sql.Tx для выборок из нескольких строк.
+type rowsQuerier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+const categoryRuleColumns = `id, category_id, priority, note_contains, note_regex, min_amount_kopeks, max_amount_kopeks,
+	COALESCE(account_id, 0), counterparty`
+
+func scanCategoryRule(row interface{ Scan(dest ...any) error }) (CategoryRule, error) {
+	var r CategoryRule
+	var minAmount, maxAmount sql.NullInt64
+	if err := row.Scan(&r.ID, &r.CategoryID, &r.Priority, &r.NoteContains, &r.NoteRegex, &minAmount, &maxAmount,
+		&r.AccountID, &r.Counterparty); err != nil {
+		return CategoryRule{}, err
+	}
+	if minAmount.Valid {
+		r.MinAmountKopeks = &minAmount.Int64
+	}
+	if maxAmount.Valid {
+		r.MaxAmountKopeks = &maxAmount.Int64
+	}
+	return r, nil
+}
+
+func listCategoryRules(q rowsQuerier) ([]CategoryRule, error) {
+	rows, err := q.Query("SELECT " + categoryRuleColumns + " FROM category_rules ORDER BY priority DESC, id")
+	if err != nil {
+		return nil, fmt.Errorf("чтение правил: %w", err)
+	}
+	defer rows.Close()
+
+	var out []CategoryRule
+	for rows.Next() {
+		r, err := scanCategoryRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan rule: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func loadRuleSet(q rowsQuerier) (ruleSet, error) {
+	rules, err := listCategoryRules(q)
+	if err != nil {
+		return nil, err
+	}
+	kinds, err := categoryKindsByID(q, false)
+	if err != nil {
+		return nil, err
+	}
+	out := make(ruleSet, 0, len(rules))
+	for _, r := range rules {
+		c, err := r.compile()
+		if err != nil {
+			return nil, fmt.Errorf("правило %d: %w", r.ID, err)
+		}
+		kind, ok := kinds[r.CategoryID]
+		if !ok {
+			continue // категория в архиве
+		}
+		c.kind = kind
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// categorize подбирает категорию по правилам, если у операции её нет.
+// Ноги переводов и операции с разбивкой не категоризуются.
+func categorize(q rowsQuerier, t *Transaction) error {
+	if t.CategoryID != 0 || t.TransferID != 0 || len(t.Splits) > 0 {
+		return nil
+	}
+	rules, err := loadRuleSet(q)
+	if err != nil {
+		return err
+	}
+	if r, ok := rules.match(*t); ok {
+		t.CategoryID = r.CategoryID
+	}
+	return nil
+}
+
+func nullAmount(v *int64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// SaveCategoryRule создаёт правило (r.ID == 0) или перезаписывает существующее.
+func (l *Ledger) SaveCategoryRule(r CategoryRule) (CategoryRule, error) {
+	if err := r.validate(); err != nil {
+		return CategoryRule{}, err
+	}
+	if err := checkCategory(l.db, r.CategoryID); err != nil {
+		return CategoryRule{}, err
+	}
+	if r.AccountID != 0 {
+		if _, err := accountCurrency(l.db, r.AccountID); err != nil {
+			return CategoryRule{}, err
+		}
+	}
+
+	args := []any{r.CategoryID, r.Priority, r.NoteContains, r.NoteRegex, nullAmount(r.MinAmountKopeks), nullAmount(r.MaxAmountKopeks),
+		nullID(r.AccountID), r.Counterparty}
+	if r.ID == 0 {
+		res, err := l.db.Exec(`
+INSERT INTO category_rules (category_id, priority, note_contains, note_regex, min_amount_kopeks, max_amount_kopeks,
+	account_id, counterparty)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+		if err != nil {
+			return CategoryRule{}, fmt.Errorf("сохранение правила: %w", err)
+		}
+		r.ID, _ = res.LastInsertId()
+		return r, nil
+	}
+
+	res, err := l.db.Exec(`
+UPDATE category_rules SET category_id = ?, priority = ?, note_contains = ?, note_regex = ?, min_amount_kopeks = ?,
+	max_amount_kopeks = ?, account_id = ?, counterparty = ?
+WHERE id = ?`, append(args, r.ID)...)
+	if err != nil {
+		return CategoryRule{}, fmt.Errorf("обновление правила: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return CategoryRule{}, fmt.Errorf("%w: правило %d", errNotFound, r.ID)
+	}
+	return r, nil
+}
+
+func (l *Ledger) GetCategoryRule(id int64) (CategoryRule, error) {
+	r, err := scanCategoryRule(l.db.QueryRow("SELECT "+categoryRuleColumns+" FROM category_rules WHERE id = ?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CategoryRule{}, fmt.Errorf("%w: правило %d", errNotFound, id)
+		}
+		return CategoryRule{}, fmt.Errorf("чтение правила: %w", err)
+	}
+	return r, nil
+}
+
+// ListCategoryRules возвращает правила в порядке применения.
+func (l *Ledger) ListCategoryRules() ([]CategoryRule, error) {
+	return listCategoryRules(l.db)
+}
+
+func (l *Ledger) DeleteCategoryRule(id int64) error {
+	res, err := l.db.Exec("DELETE FROM category_rules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("удаление правила: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("%w: правило %d", errNotFound, id)
+	}
+	return nil
+}
+
+// RuleMatch — операция, которой правило RuleID назначило (или назначило бы) категорию.
+type RuleMatch struct {
+	TransactionID int64
+	RuleID        int64
+	CategoryID    int64
+}
+
+// RuleApplyReport — итог повторного применения правил.
+type RuleApplyReport struct {
+	DryRun  bool
+	Checked int
+	Matched int
+	Matches []RuleMatch
+}
+
+// ApplyRules прогоняет правила по операциям без категории и без разбивки за
+// период [from, to] (нулевые границы — без ограничения). При dryRun ничего не меняет и только
+// показывает, какие категории были бы назначены.
+func (l *Ledger) ApplyRules(from, to time.Time, dryRun bool) (RuleApplyReport, error) {
+	if from.IsZero() {
+		from = time.Unix(0, 0)
+	}
+	to = timeOrNow(to)
+
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return RuleApplyReport{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	rules, err := loadRuleSet(txObj)
+	if err != nil {
+		return RuleApplyReport{}, err
+	}
+	rows, err := txObj.Query(`
+SELECT `+transactionColumns+`
+FROM transactions
+WHERE category_id IS NULL AND transfer_id IS NULL AND deleted_at IS NULL
+AND id NOT IN (SELECT transaction_id FROM transaction_splits)
+AND occurred_at BETWEEN ? AND ?
+ORDER BY occurred_at, id`, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	if err != nil {
+		return RuleApplyReport{}, fmt.Errorf("выборка операций без категории: %w", err)
+	}
+	var pending []Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			return RuleApplyReport{}, fmt.Errorf("scan transaction: %w", err)
+		}
+		pending = append(pending, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return RuleApplyReport{}, err
+	}
+
+	report := RuleApplyReport{DryRun: dryRun, Checked: len(pending)}
+	for _, t := range pending {
+		r, ok := rules.match(t)
+		if !ok {
+			continue
+		}
+		report.Matched++
+		report.Matches = append(report.Matches, RuleMatch{TransactionID: t.ID, RuleID: r.ID, CategoryID: r.CategoryID})
+		if dryRun {
+			continue
+		}
+		err := l.auditChange(txObj, auditUpdate, auditTransaction, t.ID, func() error {
+			if _, err := txObj.Exec("UPDATE transactions SET category_id = ? WHERE id = ?", r.CategoryID, t.ID); err != nil {
+				return fmt.Errorf("назначение категории операции %d: %w", t.ID, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return RuleApplyReport{}, err
+		}
+	}
+
+	if !dryRun {
+		if err := txObj.Commit(); err != nil {
+			return RuleApplyReport{}, fmt.Errorf("commit: %w", err)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ruleReq — тело POST /rules и PUT /rules/{id}. Границы суммы задаются со знаком
+// (расходы отрицательные) в валюте счёта account_id, а без счёта — в рублях.
+type ruleReq struct {
+	CategoryID   int64  `json:"category_id"`
+	Priority     int    `json:"priority"`
+	NoteContains string `json:"note_contains"`
+	NoteRegex    string `json:"note_regex"`
+	MinAmount    string `json:"min_amount"`
+	MaxAmount    string `json:"max_amount"`
+	AccountID    int64  `json:"account_id"`
+	Counterparty string `json:"counterparty"`
+}
+
+func (s *server) ruleFromReq(req ruleReq) (CategoryRule, error) {
+	r := CategoryRule{
+		CategoryID:   req.CategoryID,
+		Priority:     req.Priority,
+		NoteContains: req.NoteContains,
+		NoteRegex:    req.NoteRegex,
+		AccountID:    req.AccountID,
+		Counterparty: req.Counterparty,
+	}
+	currency := baseCurrency
+	if req.AccountID != 0 {
+		acc, err := s.ledger.GetAccount(req.AccountID)
+		if err != nil {
+			return CategoryRule{}, err
+		}
+		currency = acc.Currency
+	}
+	for _, bound := range []struct {
+		raw string
+		dst **int64
+	}{{req.MinAmount, &r.MinAmountKopeks}, {req.MaxAmount, &r.MaxAmountKopeks}} {
+		if bound.raw == "" {
+			continue
+		}
+		v, err := parseMoney(bound.raw, currency)
+		if err != nil {
+			return CategoryRule{}, err
+		}
+		*bound.dst = &v
+	}
+	return r, nil
+}
+
+// handleRules поддерживает GET (список в порядке применения) и POST (создание) правил.
+func (s *server) handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := s.ledger.ListCategoryRules()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rules)
+	case http.MethodPost:
+		var req ruleReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		rule, err := s.ruleFromReq(req)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		rule, err = s.ledger.SaveCategoryRule(rule)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, rule)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRuleByID поддерживает GET, PUT и DELETE /rules/{id}.
+func (s *server) handleRuleByID(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromPath(r.URL.Path, "/rules/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		rule, err := s.ledger.GetCategoryRule(id)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	case http.MethodPut:
+		var req ruleReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		rule, err := s.ruleFromReq(req)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		rule.ID = id
+		rule, err = s.ledger.SaveCategoryRule(rule)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	case http.MethodDelete:
+		if err := s.ledger.DeleteCategoryRule(id); err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRulesApply применяет правила к прошлым операциям без категории:
+// POST /rules/apply?from=YYYY-MM-DD&to=YYYY-MM-DD&dry_run=true.
+func (s *server) handleRulesApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	from, err := parseDate(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := parseDate(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	dryRun := false
+	if raw := q.Get("dry_run"); raw != "" {
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("dry_run: %w", err))
+			return
+		}
+	}
+
+	report, err := s.ledgerFor(r).ApplyRules(from, to, dryRun)
+	if err != nil {
+		writeLedgerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRulesCategorizeNewTransactionsByPriority(t *testing.T) {
+	ledger := newTestLedger(t)
+	taxi, _ := ledger.CreateCategory("Taxi")
+	food, _ := ledger.CreateCategory("Food")
+
+	maxExpense := int64(-1)
+	if _, err := ledger.SaveCategoryRule(CategoryRule{CategoryID: food.ID, NoteContains: "яндекс"}); err != nil {
+		t.Fatalf("save rule: %v", err)
+	}
+	if _, err := ledger.SaveCategoryRule(CategoryRule{CategoryID: taxi.ID, Priority: 10, NoteRegex: `(?i)такси`, MaxAmountKopeks: &maxExpense}); err != nil {
+		t.Fatalf("save rule: %v", err)
+	}
+	if _, err := ledger.SaveCategoryRule(CategoryRule{CategoryID: food.ID}); err == nil {
+		t.Fatal("rule without conditions must be rejected")
+	}
+
+	day := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	add := func(note string, amount int64) Transaction {
+		t.Helper()
+		saved, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, AmountKopeks: amount, OccurredAt: day, Note: note})
+		if err != nil {
+			t.Fatalf("add %q: %v", note, err)
+		}
+		return saved
+	}
+	if got := add("Яндекс Такси", -45_000); got.CategoryID != taxi.ID {
+		t.Fatalf("higher priority rule must win, got category %d", got.CategoryID)
+	}
+	if got := add("Яндекс Еда", -80_000); got.CategoryID != food.ID {
+		t.Fatalf("contains rule must match case-insensitively, got category %d", got.CategoryID)
+	}
+	if got := add("Возврат за такси", 45_000); got.CategoryID != 0 {
+		t.Fatalf("income is outside the amount range, got category %d", got.CategoryID)
+	}
+
+	summary, err := ledger.Summary(SummaryFilter{From: day, To: day})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if got := findSummary(summary, 0); got.IncomeKopeks != 45_000 {
+		t.Fatalf("uncategorised row expected in summary: %+v", summary)
+	}
+}
+
+func TestApplyRulesDryRunAndImport(t *testing.T) {
+	ledger := newTestLedger(t)
+	other, _ := ledger.CreateCategory("Other")
+	shops, _ := ledger.CreateCategory("Shops")
+
+	day := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	old, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, AmountKopeks: -10_000, OccurredAt: day, Counterparty: "ООО Пятёрочка"})
+	if err != nil || old.CategoryID != 0 {
+		t.Fatalf("add uncategorised: %+v %v", old, err)
+	}
+	rule, err := ledger.SaveCategoryRule(CategoryRule{CategoryID: shops.ID, Counterparty: "пятерочка"})
+	if err != nil {
+		t.Fatalf("save rule: %v", err)
+	}
+
+	preview, err := ledger.ApplyRules(time.Time{}, time.Time{}, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if preview.Matched != 1 || preview.Matches[0].RuleID != rule.ID {
+		t.Fatalf("dry run report unexpected: %+v", preview)
+	}
+	if got, _ := ledger.GetTransaction(old.ID); got.CategoryID != 0 {
+		t.Fatal("dry run must not change transactions")
+	}
+	if _, err := ledger.ApplyRules(time.Time{}, time.Time{}, false); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if got, _ := ledger.GetTransaction(old.ID); got.CategoryID != shops.ID {
+		t.Fatalf("apply must set category, got %d", got.CategoryID)
+	}
+
+	// Категория профиля — запасной вариант для строк, к которым правило не подошло.
+	profile, err := ledger.SaveImportProfile(ImportProfile{
+		Name:               "Bank",
+		Delimiter:          ";",
+		HasHeader:          true,
+		DateColumn:         "date",
+		AmountColumn:       "amount",
+		CounterpartyColumn: "payee",
+		DateFormat:         "YYYY-MM-DD",
+		CategoryID:         other.ID,
+	})
+	if err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+	report, err := ledger.ImportCSV(profile.ID, []byte("date;amount;payee\n2024-04-02;-300;Пятерочка 123\n2024-04-02;-500;Аптека\n"), ImportOptions{})
+	if err != nil {
+		t.Fatalf("import preview: %v", err)
+	}
+	if report.Rows[0].Transaction.CategoryID != shops.ID || report.Rows[0].RuleID != rule.ID {
+		t.Fatalf("rule must categorise imported row: %+v", report.Rows[0])
+	}
+	if report.Rows[1].Transaction.CategoryID != other.ID {
+		t.Fatalf("profile category expected as fallback: %+v", report.Rows[1])
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"cmp"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"modernc.org/sqlite"
+)
+
+// TransactionFilter отбирает операции для GET /transactions. Нулевые поля не
+// ограничивают выборку; To по умолчанию — текущий момент.
+type TransactionFilter struct {
+	From        time.Time
+	To          time.Time
+	CategoryIDs []int64 // любая из категорий, в том числе в строках разбивки
+	AccountID   int64
+	Tags        []string // все метки должны быть у операции
+	// MinAmountKopeks и MaxAmountKopeks ограничивают сумму со знаком
+	// (расходы отрицательные), включительно.
+	MinAmountKopeks *int64
+	MaxAmountKopeks *int64
+	// Sign — categoryKindIncome (только поступления) или categoryKindExpense (только траты).
+	Sign string
+	// NoteContains — подстрока заметки без учёта регистра и ё/е.
+	NoteContains string
+	// Search — строка полнотекстового поиска по заметке, контрагенту и меткам.
+	// Без явного Sort с ней результаты упорядочены по релевантности.
+	Search string
+	// Sort — поле из transactionSorts, с "-" в начале — по убыванию. По умолчанию "-date".
+	Sort string
+	// Cursor — NextCursor или PrevCursor прошлой страницы; только при сортировке
+	// по дате и без Offset.
+	Cursor string
+	Limit  int
+	Offset int
+}
+
+// transactionSorts — поля сортировки GET /transactions и их выражения.
+var transactionSorts = map[string]string{
+	"date":     "occurred_at",
+	"amount":   "amount_kopeks",
+	"category": "(SELECT normalize_note(c.name) FROM categories c WHERE c.id = transactions.category_id)",
+}
+
+// CurrencyTotal — число и сумма отобранных операций в одной валюте.
+type CurrencyTotal struct {
+	Currency     string
+	Count        int
+	AmountKopeks int64
+}
+
+// TransactionList — страница операций и итоги по всему фильтру (без Limit/Offset).
+// При сортировке по дате NextCursor и PrevCursor указывают на соседние страницы
+// (пустые — страниц дальше нет).
+type TransactionList struct {
+	Items      []Transaction
+	Count      int
+	Totals     []CurrencyTotal
+	NextCursor string
+	PrevCursor string
+}
+
+// transactionCursor — позиция в выдаче, отсортированной по (occurred_at, id).
+// Клиенту отдаётся непрозрачной строкой: base64 от JSON.
+type transactionCursor struct {
+	OccurredAt string `json:"t"`
+	ID         int64  `json:"id"`
+	Desc       bool   `json:"d,omitempty"` // сортировка, для которой выдан курсор
+	Before     bool   `json:"b,omitempty"` // страница перед позицией, а не после неё
+}
+
+func (c transactionCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorAt — курсор на операцию t.
+func cursorAt(t Transaction, desc, before bool) string {
+	return transactionCursor{OccurredAt: t.OccurredAt.UTC().Format(time.RFC3339), ID: t.ID, Desc: desc, Before: before}.String()
+}
+
+// dateSorted сообщает, упорядочена ли выдача по фильтру по дате, и в каком направлении.
+func (f TransactionFilter) dateSorted() (ok, desc bool) {
+	if f.Sort == "" {
+		return f.Search == "", true
+	}
+	return strings.TrimPrefix(f.Sort, "-") == "date", f.Sort != "date"
+}
+
+// cursor разбирает Cursor и проверяет, что он подходит к фильтру.
+func (f TransactionFilter) cursor() (transactionCursor, error) {
+	var c transactionCursor
+	if f.Cursor == "" {
+		return c, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.ID == 0 {
+		return c, errors.New("некорректный cursor")
+	}
+	if _, err := time.Parse(time.RFC3339, c.OccurredAt); err != nil {
+		return c, errors.New("некорректный cursor")
+	}
+	dateSorted, desc := f.dateSorted()
+	switch {
+	case !dateSorted:
+		return c, errors.New("cursor работает только с сортировкой по дате")
+	case f.Offset != 0:
+		return c, errors.New("cursor и offset нельзя задавать вместе")
+	case c.Desc != desc:
+		return c, errors.New("cursor выдан для другого направления сортировки")
+	}
+	return c, nil
+}
+
+func init() {
+	// normalize_note — normalizeNote для SQL: встроенные lower и LIKE в SQLite
+	// сворачивают регистр только у латиницы.
+	err := sqlite.RegisterDeterministicScalarFunction("normalize_note", 1,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			s, ok := args[0].(string)
+			if !ok {
+				return args[0], nil
+			}
+			return normalizeNote(s), nil
+		})
+	if err != nil {
+		panic(fmt.Sprintf("регистрация normalize_note: %v", err))
+	}
+}
+
+// parseTransactionSort проверяет поле сортировки и возвращает выражение ORDER BY.
+func parseTransactionSort(sort string) (string, error) {
+	dir := "ASC"
+	field := sort
+	if strings.HasPrefix(field, "-") {
+		dir, field = "DESC", field[1:]
+	}
+	expr, ok := transactionSorts[field]
+	if !ok {
+		return "", fmt.Errorf("неизвестная сортировка %q (ожидается date, amount или category, с - — по убыванию)", sort)
+	}
+	if field == "date" {
+		return fmt.Sprintf("occurred_at %s, id %s", dir, dir), nil
+	}
+	return fmt.Sprintf("%s %s, occurred_at DESC, id DESC", expr, dir), nil
+}
+
+// transactionsWhere собирает FROM и WHERE для выборки операций по фильтру f
+// (без удалённых в корзину) вместе с параметрами.
+func transactionsWhere(f TransactionFilter) (string, []any, error) {
+	if f.To.IsZero() {
+		f.To = time.Now()
+	}
+	var args []any
+	join := ""
+	if f.Search != "" {
+		match, err := ftsQuery(f.Search)
+		if err != nil {
+			return "", nil, err
+		}
+		join = `
+JOIN (SELECT rowid AS fts_id, rank AS fts_rank FROM transactions_fts WHERE transactions_fts MATCH ?) ON fts_id = transactions.id`
+		args = append(args, match)
+	}
+	where := `
+WHERE occurred_at BETWEEN ? AND ? AND deleted_at IS NULL
+AND (? = 0 OR account_id = ?)`
+	args = append(args,
+		f.From.UTC().Format(time.RFC3339),
+		f.To.UTC().Format(time.RFC3339),
+		f.AccountID, f.AccountID,
+	)
+	if len(f.CategoryIDs) > 0 {
+		in := "(?" + strings.Repeat(", ?", len(f.CategoryIDs)-1) + ")"
+		where += `
+AND (category_id IN ` + in + ` OR id IN (SELECT transaction_id FROM transaction_splits WHERE category_id IN ` + in + `))`
+		for range 2 {
+			for _, id := range f.CategoryIDs {
+				args = append(args, id)
+			}
+		}
+	}
+	// Каждая метка из фильтра должна быть у операции.
+	for _, tag := range f.Tags {
+		where += `
+AND id IN (SELECT tt.transaction_id FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id WHERE g.name = ?)`
+		args = append(args, tag)
+	}
+	if f.MinAmountKopeks != nil {
+		where += `
+AND amount_kopeks >= ?`
+		args = append(args, *f.MinAmountKopeks)
+	}
+	if f.MaxAmountKopeks != nil {
+		where += `
+AND amount_kopeks <= ?`
+		args = append(args, *f.MaxAmountKopeks)
+	}
+	switch f.Sign {
+	case "":
+	case categoryKindIncome:
+		where += `
+AND amount_kopeks > 0`
+	case categoryKindExpense:
+		where += `
+AND amount_kopeks < 0`
+	default:
+		return "", nil, fmt.Errorf("sign должен быть %s или %s", categoryKindIncome, categoryKindExpense)
+	}
+	if note := normalizeNote(f.NoteContains); note != "" {
+		where += `
+AND instr(normalize_note(note), ?) > 0`
+		args = append(args, note)
+	}
+	return `
+FROM transactions` + join + where, args, nil
+}
+
+// ListTransactions возвращает страницу операций по фильтру f с метками и
+// разбивкой, а также число и сумму всех подходящих операций по валютам.
+//
+// При сортировке по дате страницы листаются курсорами: условие по (occurred_at, id)
+// вместо OFFSET не замедляется к концу выборки и не сбивается, когда между
+// запросами добавляют операции.
+func (l *Ledger) ListTransactions(f TransactionFilter) (TransactionList, error) {
+	from, args, err := transactionsWhere(f)
+	if err != nil {
+		return TransactionList{}, err
+	}
+	cur, err := f.cursor()
+	if err != nil {
+		return TransactionList{}, err
+	}
+	order := "occurred_at DESC, id DESC"
+	if f.Sort != "" || f.Search == "" {
+		if order, err = parseTransactionSort(cmp.Or(f.Sort, "-date")); err != nil {
+			return TransactionList{}, err
+		}
+	} else {
+		order = "fts_rank, " + order
+	}
+	dateSorted, desc := f.dateSorted()
+	keyset := ""
+	pageArgs := slices.Clone(args)
+	if f.Cursor != "" {
+		// Страница назад читается от курсора в обратном порядке и затем разворачивается.
+		op, dir := ">", "ASC"
+		if desc != cur.Before {
+			op, dir = "<", "DESC"
+		}
+		keyset = `
+AND (occurred_at, id) ` + op + ` (?, ?)`
+		order = fmt.Sprintf("occurred_at %s, id %s", dir, dir)
+		pageArgs = append(pageArgs, cur.OccurredAt, cur.ID)
+	}
+	limit := f.Limit
+	if dateSorted {
+		limit++ // лишняя строка показывает, есть ли следующая страница
+	}
+
+	rows, err := l.db.Query(`
+SELECT `+transactionColumns+from+keyset+`
+ORDER BY `+order+`
+LIMIT ? OFFSET ?`,
+		append(pageArgs, limit, f.Offset)...,
+	)
+	if err != nil {
+		return TransactionList{}, fmt.Errorf("получение операций: %w", err)
+	}
+	defer rows.Close()
+
+	list := TransactionList{Items: []Transaction{}}
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return TransactionList{}, fmt.Errorf("scan transaction: %w", err)
+		}
+		list.Items = append(list.Items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return TransactionList{}, err
+	}
+	if dateSorted {
+		more := len(list.Items) > f.Limit
+		if more {
+			list.Items = list.Items[:f.Limit]
+		}
+		hasNext, hasPrev := more, f.Offset > 0
+		if f.Cursor != "" {
+			hasNext, hasPrev = true, true
+			if cur.Before {
+				slices.Reverse(list.Items)
+				hasPrev = more
+			} else {
+				hasNext = more
+			}
+		}
+		if n := len(list.Items); n > 0 {
+			if hasNext {
+				list.NextCursor = cursorAt(list.Items[n-1], desc, false)
+			}
+			if hasPrev {
+				list.PrevCursor = cursorAt(list.Items[0], desc, true)
+			}
+		}
+	}
+	if err := withTags(l.db, list.Items); err != nil {
+		return TransactionList{}, err
+	}
+	if err := withSplits(l.db, list.Items); err != nil {
+		return TransactionList{}, err
+	}
+
+	totals, err := l.db.Query(`
+SELECT currency, COUNT(*), SUM(amount_kopeks)`+from+`
+GROUP BY currency
+ORDER BY currency`, args...)
+	if err != nil {
+		return TransactionList{}, fmt.Errorf("итоги операций: %w", err)
+	}
+	defer totals.Close()
+	for totals.Next() {
+		var ct CurrencyTotal
+		if err := totals.Scan(&ct.Currency, &ct.Count, &ct.AmountKopeks); err != nil {
+			return TransactionList{}, fmt.Errorf("scan totals: %w", err)
+		}
+		list.Count += ct.Count
+		list.Totals = append(list.Totals, ct)
+	}
+	return list, totals.Err()
+}
+
+// ftsQuery превращает строку поиска в выражение MATCH для transactions_fts:
+// каждое слово ищется по префиксу ("озо" найдёт "Озон"), нужны все слова.
+// Регистр сворачивает токенизатор, ё приводится к е, как и в индексе.
+// Знаки препинания и операторы FTS5 из строки не попадают в выражение.
+func ftsQuery(search string) (string, error) {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return "", errors.New("в поисковом запросе нет слов")
+	}
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + strings.ReplaceAll(w, "ё", "е") + `"*`
+	}
+	return strings.Join(terms, " "), nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListTransactionsSearch(t *testing.T) {
+	ledger := newTestLedger(t)
+	shop, _ := ledger.CreateCategory("Shopping")
+
+	day := time.Date(2024, time.April, 10, 0, 0, 0, 0, time.UTC)
+	add := func(note, counterparty string, tags ...string) Transaction {
+		t.Helper()
+		saved, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: shop.ID, AmountKopeks: -100_00,
+			OccurredAt: day, Note: note, Counterparty: counterparty, Tags: tags})
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		return saved
+	}
+	ozon := add("Заказ на ОЗОНЕ: наушники", "")
+	tree := add("Ёлочные игрушки", "Озон")
+	add("Кофе", "Шоколадница", "весна")
+
+	search := func(q string) []int64 {
+		t.Helper()
+		list, err := ledger.ListTransactions(TransactionFilter{Search: q, Limit: 10})
+		if err != nil {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		var ids []int64
+		for _, tx := range list.Items {
+			ids = append(ids, tx.ID)
+		}
+		return ids
+	}
+
+	if ids := search("озон"); len(ids) != 2 {
+		t.Fatalf("expected both Ozon operations (note and counterparty), got %v", ids)
+	}
+	if ids := search("ЁЛОЧ"); len(ids) != 1 || ids[0] != tree.ID {
+		t.Fatalf("expected case-folded prefix match with ё, got %v", ids)
+	}
+	if ids := search("елочные"); len(ids) != 1 || ids[0] != tree.ID {
+		t.Fatalf("expected е to match ё, got %v", ids)
+	}
+	if ids := search("озон науш"); len(ids) != 1 || ids[0] != ozon.ID {
+		t.Fatalf("expected all words to be required, got %v", ids)
+	}
+	if ids := search(`"вес*(`); len(ids) != 1 {
+		t.Fatalf("expected tag match with FTS syntax stripped, got %v", ids)
+	}
+
+	// Индекс следует за правками, метками и корзиной.
+	ozon.Note = "Возврат наушников"
+	ozon.Tags = []string{"электроника"}
+	if _, err := ledger.UpdateTransaction(ozon); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if ids := search("заказ"); len(ids) != 0 {
+		t.Fatalf("old note must leave the index, got %v", ids)
+	}
+	if ids := search("электрон возврат"); len(ids) != 1 || ids[0] != ozon.ID {
+		t.Fatalf("expected updated note and tags to be indexed, got %v", ids)
+	}
+	tags, _ := ledger.ListTags()
+	for _, tag := range tags {
+		if tag.Name == "электроника" {
+			if _, err := ledger.RenameTag(tag.ID, "гаджеты"); err != nil {
+				t.Fatalf("rename tag: %v", err)
+			}
+		}
+	}
+	if ids := search("гаджет"); len(ids) != 1 || ids[0] != ozon.ID {
+		t.Fatalf("expected renamed tag to be indexed, got %v", ids)
+	}
+	if err := ledger.DeleteTransaction(tree.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if ids := search("озон"); len(ids) != 0 {
+		t.Fatalf("trashed operation must not be found, got %v", ids)
+	}
+	if _, err := ledger.PurgeTrash(time.Now()); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	var indexed int
+	if err := ledger.db.QueryRow("SELECT COUNT(*) FROM transactions_fts").Scan(&indexed); err != nil || indexed != 2 {
+		t.Fatalf("expected purged operation to leave the index: %d %v", indexed, err)
+	}
+}
+
+func TestListTransactionsSearchRanking(t *testing.T) {
+	ledger := newTestLedger(t)
+	shop, _ := ledger.CreateCategory("Shopping")
+
+	day := time.Date(2024, time.April, 10, 0, 0, 0, 0, time.UTC)
+	var ids []int64
+	for i, note := range []string{"Озон", "Озон озон озон: Озон", "Продукты и мелочи, доставка из магазина, Озон"} {
+		saved, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: shop.ID, AmountKopeks: -100,
+			OccurredAt: day.AddDate(0, 0, i), Note: note})
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		ids = append(ids, saved.ID)
+	}
+	list, err := ledger.ListTransactions(TransactionFilter{Search: "озон", Limit: 10})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	txs := list.Items
+	if len(txs) != 3 || txs[0].ID != ids[1] || txs[2].ID != ids[2] {
+		t.Fatalf("expected results ordered by relevance, got %+v", txs)
+	}
+}
+
+func TestFTSQueryRejectsEmptySearch(t *testing.T) {
+	if _, err := ftsQuery(` "*" - `); err == nil {
+		t.Fatal("expected error for search without words")
+	}
+}
+
+func TestListTransactionsFiltersSortAndTotals(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Еда")
+	taxi, _ := ledger.CreateCategory("Авто")
+	salary, _ := ledger.CreateCategory("Зарплата")
+	usd, err := ledger.CreateAccount("USD card", "card", "USD")
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+
+	day := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	add := func(accountID, categoryID, amount int64, offset int, note string) Transaction {
+		t.Helper()
+		saved, err := ledger.AddTransaction(Transaction{AccountID: accountID, CategoryID: categoryID, AmountKopeks: amount,
+			OccurredAt: day.AddDate(0, 0, offset), Note: note})
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		return saved
+	}
+	lunch := add(defaultAccountID, food.ID, -450_00, 0, "Обед в СТОЛОВОЙ")
+	ride := add(defaultAccountID, taxi.ID, -1_200_00, 1, "такси до вокзала")
+	pay := add(defaultAccountID, salary.ID, 100_000_00, 2, "аванс")
+	coffee := add(usd.ID, food.ID, -5_50, 3, "coffee")
+
+	list := func(f TransactionFilter) TransactionList {
+		t.Helper()
+		f.Limit = 10
+		got, err := ledger.ListTransactions(f)
+		if err != nil {
+			t.Fatalf("list %+v: %v", f, err)
+		}
+		return got
+	}
+	ids := func(l TransactionList) []int64 {
+		var out []int64
+		for _, tx := range l.Items {
+			out = append(out, tx.ID)
+		}
+		return out
+	}
+
+	all := list(TransactionFilter{})
+	if got := ids(all); len(got) != 4 || got[0] != coffee.ID || got[3] != lunch.ID {
+		t.Fatalf("expected newest first by default, got %v", got)
+	}
+	if all.Count != 4 || len(all.Totals) != 2 ||
+		all.Totals[0] != (CurrencyTotal{Currency: "RUB", Count: 3, AmountKopeks: 98_350_00}) ||
+		all.Totals[1] != (CurrencyTotal{Currency: "USD", Count: 1, AmountKopeks: -5_50}) {
+		t.Fatalf("unexpected totals: %d %+v", all.Count, all.Totals)
+	}
+
+	// Итоги считаются по всему фильтру, а не по странице.
+	expenses, err := ledger.ListTransactions(TransactionFilter{Sign: categoryKindExpense, AccountID: defaultAccountID, Limit: 1})
+	if err != nil || expenses.Count != 2 || len(expenses.Items) != 1 || expenses.Totals[0].AmountKopeks != -1_650_00 {
+		t.Fatalf("expected two RUB expenses on a one-item page: %+v %v", expenses, err)
+	}
+	if got := ids(list(TransactionFilter{Sign: categoryKindIncome})); len(got) != 1 || got[0] != pay.ID {
+		t.Fatalf("expected only income, got %v", got)
+	}
+
+	minAmount, maxAmount := int64(-1_000_00), int64(0)
+	if got := ids(list(TransactionFilter{MinAmountKopeks: &minAmount, MaxAmountKopeks: &maxAmount})); len(got) != 2 {
+		t.Fatalf("expected lunch and coffee in amount range, got %v", got)
+	}
+	if got := ids(list(TransactionFilter{CategoryIDs: []int64{taxi.ID, salary.ID}})); len(got) != 2 || got[0] != pay.ID || got[1] != ride.ID {
+		t.Fatalf("expected any of several categories, got %v", got)
+	}
+	if got := ids(list(TransactionFilter{NoteContains: "столов"})); len(got) != 1 || got[0] != lunch.ID {
+		t.Fatalf("expected case-insensitive Cyrillic substring match, got %v", got)
+	}
+
+	if got := ids(list(TransactionFilter{Sort: "amount"})); got[0] != ride.ID || got[3] != pay.ID {
+		t.Fatalf("expected ascending amount, got %v", got)
+	}
+	if got := ids(list(TransactionFilter{Sort: "-amount"})); got[0] != pay.ID || got[3] != ride.ID {
+		t.Fatalf("expected descending amount, got %v", got)
+	}
+	if got := ids(list(TransactionFilter{Sort: "category"})); got[0] != ride.ID || got[3] != pay.ID {
+		t.Fatalf("expected sort by category name, got %v", got)
+	}
+	if got := ids(list(TransactionFilter{Sort: "date"})); got[0] != lunch.ID {
+		t.Fatalf("expected oldest first, got %v", got)
+	}
+	if _, err := ledger.ListTransactions(TransactionFilter{Sort: "note"}); err == nil {
+		t.Fatal("expected error for unknown sort")
+	}
+}
+
+func TestListTransactionsCursorPagination(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	add := func(offset int) Transaction {
+		t.Helper()
+		saved, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -100,
+			OccurredAt: day.AddDate(0, 0, offset)})
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		return saved
+	}
+	// Две операции в один день: порядок внутри дня задаёт id.
+	var ids []int64
+	for _, offset := range []int{0, 1, 1, 2, 3} {
+		ids = append(ids, add(offset).ID)
+	}
+	page := func(f TransactionFilter) TransactionList {
+		t.Helper()
+		f.Limit = 2
+		got, err := ledger.ListTransactions(f)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		return got
+	}
+	pageIDs := func(l TransactionList) []int64 {
+		var out []int64
+		for _, tx := range l.Items {
+			out = append(out, tx.ID)
+		}
+		return out
+	}
+
+	first := page(TransactionFilter{})
+	if got := pageIDs(first); len(got) != 2 || got[0] != ids[4] || got[1] != ids[3] || first.PrevCursor != "" || first.NextCursor == "" {
+		t.Fatalf("unexpected first page: %v %+v", got, first)
+	}
+
+	// Новая операция между запросами не сдвигает следующую страницу.
+	add(4)
+	second := page(TransactionFilter{Cursor: first.NextCursor})
+	if got := pageIDs(second); len(got) != 2 || got[0] != ids[2] || got[1] != ids[1] || second.Count != 6 {
+		t.Fatalf("unexpected second page: %v", got)
+	}
+	last := page(TransactionFilter{Cursor: second.NextCursor})
+	if got := pageIDs(last); len(got) != 1 || got[0] != ids[0] || last.NextCursor != "" || last.PrevCursor == "" {
+		t.Fatalf("unexpected last page: %v %+v", got, last)
+	}
+
+	back := page(TransactionFilter{Cursor: last.PrevCursor})
+	if got := pageIDs(back); len(got) != 2 || got[0] != ids[2] || got[1] != ids[1] || back.NextCursor == "" || back.PrevCursor == "" {
+		t.Fatalf("unexpected page back: %v %+v", got, back)
+	}
+	top := page(TransactionFilter{Cursor: back.PrevCursor})
+	if got := pageIDs(top); len(got) != 2 || got[0] != ids[4] || got[1] != ids[3] || top.PrevCursor == "" {
+		t.Fatalf("expected page before the second one with the new operation above it: %v %+v", got, top)
+	}
+
+	asc := page(TransactionFilter{Sort: "date"})
+	if got := pageIDs(page(TransactionFilter{Sort: "date", Cursor: asc.NextCursor})); len(got) != 2 || got[0] != ids[2] || got[1] != ids[3] {
+		t.Fatalf("unexpected ascending second page: %v", got)
+	}
+
+	for _, f := range []TransactionFilter{
+		{Cursor: "not-a-cursor"},
+		{Cursor: first.NextCursor, Sort: "amount"},
+		{Cursor: first.NextCursor, Sort: "date"},
+		{Cursor: first.NextCursor, Offset: 2},
+	} {
+		if _, err := ledger.ListTransactions(f); err == nil {
+			t.Fatalf("expected error for cursor with %+v", f)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TransactionSplit — строка разбивки операции: часть суммы в своей категории,
+// например продукты и бытовая химия из одного чека.
+type TransactionSplit struct {
+	CategoryID   int64
+	AmountKopeks int64
+	Note         string
+}
+
+// transactionLinesSQL — источник строк учёта для отчётов вместо таблицы transactions:
+// операция без разбивки даёт одну строку, с разбивкой — по строке на каждую часть
+// со своей категорией и суммой. id в строке — id операции. Операции из корзины
+// в строки не попадают.
+const transactionLinesSQL = `(
+	SELECT t.id, t.account_id, COALESCE(s.category_id, t.category_id) AS category_id,
+		COALESCE(s.amount_kopeks, t.amount_kopeks) AS amount_kopeks,
+		t.currency, t.occurred_at, t.transfer_id, t.refund
+	FROM transactions t LEFT JOIN transaction_splits s ON s.transaction_id = t.id
+	WHERE t.deleted_at IS NULL
+) AS transaction_lines`
+
+// checkSplits проверяет разбивку операции t: не меньше двух строк, у каждой
+// категория допускает знак её суммы, а вместе они дают сумму операции.
+// Категории из prev (прежней разбивки) могут быть в архиве.
+func checkSplits(q rowQuerier, t Transaction, prev []TransactionSplit) error {
+	if t.CategoryID != 0 {
+		return errors.New("укажите либо категорию, либо разбивку")
+	}
+	if len(t.Splits) < 2 {
+		return errors.New("в разбивке должно быть не меньше двух строк")
+	}
+	known := make(map[int64]bool, len(prev))
+	for _, s := range prev {
+		known[s.CategoryID] = true
+	}
+	var sum int64
+	for i, s := range t.Splits {
+		if s.CategoryID == 0 {
+			return fmt.Errorf("строка %d разбивки: категория не указана", i+1)
+		}
+		if s.AmountKopeks == 0 {
+			return fmt.Errorf("строка %d разбивки: нулевая сумма", i+1)
+		}
+		if err := checkCategorySign(q, Transaction{CategoryID: s.CategoryID, AmountKopeks: s.AmountKopeks, Refund: t.Refund}); err != nil {
+			return fmt.Errorf("строка %d разбивки: %w", i+1, err)
+		}
+		if !known[s.CategoryID] {
+			if err := checkCategoryActive(q, s.CategoryID); err != nil {
+				return fmt.Errorf("строка %d разбивки: %w", i+1, err)
+			}
+		}
+		sum += s.AmountKopeks
+	}
+	if sum != t.AmountKopeks {
+		return fmt.Errorf("сумма разбивки %v не равна сумме операции %v",
+			fromMinorUnits(sum, t.Currency), fromMinorUnits(t.AmountKopeks, t.Currency))
+	}
+	return nil
+}
+
+// setTransactionSplits заменяет разбивку операции; пустой splits её снимает.
+func setTransactionSplits(txObj *sql.Tx, transactionID int64, splits []TransactionSplit) error {
+	if _, err := txObj.Exec("DELETE FROM transaction_splits WHERE transaction_id = ?", transactionID); err != nil {
+		return fmt.Errorf("снятие разбивки: %w", err)
+	}
+	for _, s := range splits {
+		if _, err := txObj.Exec(
+			"INSERT INTO transaction_splits (transaction_id, category_id, amount_kopeks, note) VALUES (?, ?, ?, ?)",
+			transactionID, s.CategoryID, s.AmountKopeks, s.Note,
+		); err != nil {
+			return fmt.Errorf("сохранение разбивки: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadTransactionSplits возвращает разбивку операций ids в порядке ввода строк.
+func loadTransactionSplits(q rowsQuerier, ids []int64) (map[int64][]TransactionSplit, error) {
+	out := make(map[int64][]TransactionSplit)
+	if len(ids) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.Query(`
+SELECT transaction_id, category_id, amount_kopeks, note
+FROM transaction_splits
+WHERE transaction_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("чтение разбивки операций: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var s TransactionSplit
+		if err := rows.Scan(&id, &s.CategoryID, &s.AmountKopeks, &s.Note); err != nil {
+			return nil, fmt.Errorf("scan split: %w", err)
+		}
+		out[id] = append(out[id], s)
+	}
+	return out, rows.Err()
+}
+
+// withSplits заполняет Splits у операций.
+func withSplits(q rowsQuerier, txs []Transaction) error {
+	ids := make([]int64, len(txs))
+	for i, t := range txs {
+		ids[i] = t.ID
+	}
+	splits, err := loadTransactionSplits(q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range txs {
+		txs[i].Splits = splits[txs[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSplitTransactionAttributesLinesToCategories(t *testing.T) {
+	ledger := newTestLedger(t)
+	groceries, _ := ledger.CreateCategory("Groceries")
+	household, _ := ledger.CreateCategory("Household")
+
+	day := time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)
+	receipt := Transaction{AccountID: defaultAccountID, AmountKopeks: -300_000, OccurredAt: day, Note: "Ашан", Splits: []TransactionSplit{
+		{CategoryID: groceries.ID, AmountKopeks: -200_000},
+		{CategoryID: household.ID, AmountKopeks: -90_000, Note: "порошок"},
+	}}
+	if _, err := ledger.AddTransaction(receipt); err == nil {
+		t.Fatal("splits not adding up to the total must be rejected")
+	}
+	receipt.Splits[1].AmountKopeks = -100_000
+	withCategory := receipt
+	withCategory.CategoryID = groceries.ID
+	if _, err := ledger.AddTransaction(withCategory); err == nil {
+		t.Fatal("category and splits together must be rejected")
+	}
+	saved, err := ledger.AddTransaction(receipt)
+	if err != nil {
+		t.Fatalf("add split: %v", err)
+	}
+	got, err := ledger.GetTransaction(saved.ID)
+	if err != nil || got.CategoryID != 0 || len(got.Splits) != 2 || got.Splits[1].Note != "порошок" {
+		t.Fatalf("splits must be stored: %+v %v", got, err)
+	}
+
+	summary, err := ledger.Summary(SummaryFilter{From: day, To: day})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if s := findSummary(summary, groceries.ID); s.ExpenseKopeks != -200_000 || s.Count != 1 {
+		t.Fatalf("groceries line: %+v", s)
+	}
+	if s := findSummary(summary, household.ID); s.ExpenseKopeks != -100_000 {
+		t.Fatalf("household line: %+v", s)
+	}
+	if s := findSummary(summary, 0); s.Count != 0 {
+		t.Fatalf("split transaction must not be uncategorised: %+v", s)
+	}
+
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: household.ID, LimitKopeks: 50_000, StartDate: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+	exceeded, err := ledger.ExceededBudgets(day, day, "")
+	if err != nil {
+		t.Fatalf("exceeded: %v", err)
+	}
+	if len(exceeded) != 1 || exceeded[0].CategoryID != household.ID || exceeded[0].SpentKopeks != 100_000 {
+		t.Fatalf("budget must count only its split line: %+v", exceeded)
+	}
+
+	// nil оставляет разбивку; новая сумма должна с ней сходиться.
+	saved.Note = "Ашан, чек 2"
+	saved.Splits = nil
+	if _, err := ledger.UpdateTransaction(saved); err != nil {
+		t.Fatalf("update keeping splits: %v", err)
+	}
+	saved.AmountKopeks = -310_000
+	if _, err := ledger.UpdateTransaction(saved); err == nil {
+		t.Fatal("changed total must match kept splits")
+	}
+	saved.CategoryID = groceries.ID
+	updated, err := ledger.UpdateTransaction(saved)
+	if err != nil || updated.Splits != nil {
+		t.Fatalf("category must replace splits: %+v %v", updated, err)
+	}
+	if got, _ := ledger.GetTransaction(saved.ID); len(got.Splits) != 0 || got.CategoryID != groceries.ID {
+		t.Fatalf("splits must be removed: %+v", got)
+	}
+}
+
+func TestDeleteCategoryCountsSplitLines(t *testing.T) {
+	ledger := newTestLedger(t)
+	groceries, _ := ledger.CreateCategory("Groceries")
+	household, _ := ledger.CreateCategory("Household")
+	cleaning, _ := ledger.CreateCategory("Cleaning")
+
+	day := time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)
+	saved, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, AmountKopeks: -3_000, OccurredAt: day, Splits: []TransactionSplit{
+		{CategoryID: groceries.ID, AmountKopeks: -2_000},
+		{CategoryID: household.ID, AmountKopeks: -1_000},
+	}})
+	if err != nil {
+		t.Fatalf("add split: %v", err)
+	}
+	if err := ledger.DeleteCategory(household.ID, CategoryDeleteOptions{}); !errors.Is(err, errConflict) {
+		t.Fatalf("category used by a split line must not be deleted silently, got %v", err)
+	}
+	merge, err := ledger.MergeCategories(household.ID, cleaning.ID)
+	if err != nil || merge.MovedTransactions != 1 {
+		t.Fatalf("merge must move split lines: %+v %v", merge, err)
+	}
+	if got, _ := ledger.GetTransaction(saved.ID); got.Splits[1].CategoryID != cleaning.ID {
+		t.Fatalf("split line must follow the merge: %+v", got.Splits)
+	}
+	if err := ledger.DeleteCategory(cleaning.ID, CategoryDeleteOptions{Cascade: true}); err != nil {
+		t.Fatalf("cascade delete: %v", err)
+	}
+	if _, err := ledger.GetTransaction(saved.ID); !errors.Is(err, errNotFound) {
+		t.Fatalf("cascade must delete the whole split transaction, got %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Tag — метка операции. Одна операция может иметь несколько меток, например
+// «казань-2024» на билетах, гостинице и ресторанах одной поездки.
+type Tag struct {
+	ID   int64
+	Name string
+}
+
+// TagSummary — итоги операций с меткой за период в минимальных единицах Currency.
+// Операция с несколькими метками учитывается в каждой из них.
+type TagSummary struct {
+	TagID         int64
+	Name          string
+	Currency      string
+	IncomeKopeks  int64
+	ExpenseKopeks int64
+	NetKopeks     int64
+	Count         int
+}
+
+// normalizeTag приводит имя метки к хранимому виду: без пробелов по краям,
+// без ведущего '#', в нижнем регистре.
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+	if name == "" {
+		return "", errors.New("имя метки пустое")
+	}
+	return name, nil
+}
+
+// normalizeTags нормализует имена, убирает повторы и сортирует.
+func normalizeTags(names []string) ([]string, error) {
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		name, err := normalizeTag(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// checkTagName возвращает errConflict, если имя занято другой меткой (не exceptID).
+func checkTagName(q rowQuerier, name string, exceptID int64) error {
+	var id int64
+	err := q.QueryRow("SELECT id FROM tags WHERE name = ? AND id != ?", name, exceptID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("проверка имени метки: %w", err)
+	}
+	return fmt.Errorf("%w: метка %q уже есть (id %d)", errConflict, name, id)
+}
+
+func (l *Ledger) CreateTag(name string) (Tag, error) {
+	name, err := normalizeTag(name)
+	if err != nil {
+		return Tag{}, err
+	}
+	if err := checkTagName(l.db, name, 0); err != nil {
+		return Tag{}, err
+	}
+	res, err := l.db.Exec("INSERT INTO tags (name) VALUES (?)", name)
+	if err != nil {
+		return Tag{}, fmt.Errorf("сохранение метки: %w", err)
+	}
+	id, _ := res.LastInsertId()
+	return Tag{ID: id, Name: name}, nil
+}
+
+func (l *Ledger) GetTag(id int64) (Tag, error) {
+	var t Tag
+	err := l.db.QueryRow("SELECT id, name FROM tags WHERE id = ?", id).Scan(&t.ID, &t.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tag{}, fmt.Errorf("%w: метка %d", errNotFound, id)
+	}
+	if err != nil {
+		return Tag{}, fmt.Errorf("чтение метки: %w", err)
+	}
+	return t, nil
+}
+
+func (l *Ledger) ListTags() ([]Tag, error) {
+	rows, err := l.db.Query("SELECT id, name FROM tags ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("чтение меток: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Tag
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// RenameTag переименовывает метку; занятое имя — errConflict (для слияния см. MergeTags).
+func (l *Ledger) RenameTag(id int64, name string) (Tag, error) {
+	name, err := normalizeTag(name)
+	if err != nil {
+		return Tag{}, err
+	}
+	if err := checkTagName(l.db, name, id); err != nil {
+		return Tag{}, err
+	}
+	res, err := l.db.Exec("UPDATE tags SET name = ? WHERE id = ?", name, id)
+	if err != nil {
+		return Tag{}, fmt.Errorf("переименование метки: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return Tag{}, fmt.Errorf("%w: метка %d", errNotFound, id)
+	}
+	return Tag{ID: id, Name: name}, nil
+}
+
+// DeleteTag удаляет метку и снимает её со всех операций; сами операции остаются.
+func (l *Ledger) DeleteTag(id int64) error {
+	res, err := l.db.Exec("DELETE FROM tags WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("удаление метки: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("%w: метка %d", errNotFound, id)
+	}
+	return nil
+}
+
+// MergeTags переносит метку sourceID на все её операции как targetID и удаляет sourceID.
+func (l *Ledger) MergeTags(sourceID, targetID int64) (Tag, error) {
+	if sourceID == targetID {
+		return Tag{}, errors.New("метку нельзя объединить с самой собой")
+	}
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Tag{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	for _, id := range []int64{sourceID, targetID} {
+		var exists int
+		if err := txObj.QueryRow("SELECT 1 FROM tags WHERE id = ?", id).Scan(&exists); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return Tag{}, fmt.Errorf("%w: метка %d", errNotFound, id)
+			}
+			return Tag{}, fmt.Errorf("чтение метки: %w", err)
+		}
+	}
+	if _, err := txObj.Exec(`
+INSERT OR IGNORE INTO transaction_tags (transaction_id, tag_id)
+SELECT transaction_id, ? FROM transaction_tags WHERE tag_id = ?`, targetID, sourceID); err != nil {
+		return Tag{}, fmt.Errorf("перенос метки: %w", err)
+	}
+	if _, err := txObj.Exec("DELETE FROM tags WHERE id = ?", sourceID); err != nil {
+		return Tag{}, fmt.Errorf("удаление метки: %w", err)
+	}
+	if err := txObj.Commit(); err != nil {
+		return Tag{}, fmt.Errorf("commit: %w", err)
+	}
+	return l.GetTag(targetID)
+}
+
+// setTransactionTags заменяет метки операции; неизвестные метки создаются.
+// Возвращает нормализованные имена.
+func setTransactionTags(txObj *sql.Tx, transactionID int64, names []string) ([]string, error) {
+	names, err := normalizeTags(names)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := txObj.Exec("DELETE FROM transaction_tags WHERE transaction_id = ?", transactionID); err != nil {
+		return nil, fmt.Errorf("снятие меток: %w", err)
+	}
+	for _, name := range names {
+		if _, err := txObj.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", name); err != nil {
+			return nil, fmt.Errorf("сохранение метки: %w", err)
+		}
+		if _, err := txObj.Exec(`
+INSERT INTO transaction_tags (transaction_id, tag_id) SELECT ?, id FROM tags WHERE name = ?`, transactionID, name); err != nil {
+			return nil, fmt.Errorf("установка метки: %w", err)
+		}
+	}
+	return names, nil
+}
+
+// loadTransactionTags возвращает имена меток для операций ids.
+func loadTransactionTags(q rowsQuerier, ids []int64) (map[int64][]string, error) {
+	out := make(map[int64][]string)
+	if len(ids) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.Query(`
+SELECT tt.transaction_id, g.name
+FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id
+WHERE tt.transaction_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+ORDER BY g.name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("чтение меток операций: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+		out[id] = append(out[id], name)
+	}
+	return out, rows.Err()
+}
+
+// withTags заполняет Tags у операций.
+func withTags(q rowsQuerier, txs []Transaction) error {
+	ids := make([]int64, len(txs))
+	for i, t := range txs {
+		ids[i] = t.ID
+	}
+	tags, err := loadTransactionTags(q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range txs {
+		txs[i].Tags = tags[txs[i].ID]
+	}
+	return nil
+}
+
+// SummaryByTag агрегирует операции периода f по меткам (RollUp не действует).
+// KnownAt не поддерживается: метки меняются в обход журнала аудита (переименование,
+// слияние, удаление), и прошлое состояние по ним не восстановить.
+func (l *Ledger) SummaryByTag(f SummaryFilter) ([]TagSummary, error) {
+	if !f.KnownAt.IsZero() {
+		return nil, fmt.Errorf("%w: сводка по меткам не строится на прошлый момент (as_of), метки не ведутся в журнале аудита", errValidation)
+	}
+	groups, err := l.aggregate(f, "tt.tag_id", "JOIN transaction_tags tt ON tt.transaction_id = transaction_lines.id")
+	if err != nil {
+		return nil, err
+	}
+	tags, err := l.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(tags))
+	for _, t := range tags {
+		names[t.ID] = t.Name
+	}
+
+	out := make([]TagSummary, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, TagSummary{
+			TagID:         g.key,
+			Name:          names[g.key],
+			Currency:      g.currency,
+			IncomeKopeks:  g.income,
+			ExpenseKopeks: g.expense,
+			NetKopeks:     g.income + g.expense,
+			Count:         g.count,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// handleTags поддерживает GET (список) и POST (создание) меток.
+func (s *server) handleTags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tags, err := s.ledger.ListTags()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tags)
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		tag, err := s.ledger.CreateTag(req.Name)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, tag)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTagByID поддерживает GET, PATCH (переименование) и DELETE /tags/{id}
+// и POST /tags/{id}/merge с {"target_id": N}.
+func (s *server) handleTagByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := splitIDPath(r.URL.Path, "/tags/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if action == "merge" {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			TargetID int64 `json:"target_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		tag, err := s.ledger.MergeTags(id, req.TargetID)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tag)
+		return
+	}
+	if action != "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tag, err := s.ledger.GetTag(id)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tag)
+	case http.MethodPatch:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		tag, err := s.ledger.RenameTag(id, req.Name)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tag)
+	case http.MethodDelete:
+		if err := s.ledger.DeleteTag(id); err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSummaryByTag — GET /summary/tags: итоги по меткам с параметрами /summary
+// (as_of не поддерживается — 400).
+func (s *server) handleSummaryByTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := parseSummaryFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	summary, err := s.ledger.SummaryByTag(filter)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+
+	type tagResp struct {
+		TagID    int64  `json:"tag_id"`
+		Tag      string `json:"tag"`
+		Currency string `json:"currency"`
+		Income   Money  `json:"income"`
+		Expense  Money  `json:"expense"`
+		Net      Money  `json:"net"`
+		Count    int    `json:"count"`
+	}
+	resp := make([]tagResp, 0, len(summary))
+	for _, t := range summary {
+		resp = append(resp, tagResp{
+			TagID:    t.TagID,
+			Tag:      t.Name,
+			Currency: t.Currency,
+			Income:   fromMinorUnits(t.IncomeKopeks, t.Currency),
+			Expense:  fromMinorUnits(-t.ExpenseKopeks, t.Currency),
+			Net:      fromMinorUnits(t.NetKopeks, t.Currency),
+			Count:    t.Count,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
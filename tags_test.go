@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTagsOnTransactionsAndSummaryByTag(t *testing.T) {
+	ledger := newTestLedger(t)
+	transport, _ := ledger.CreateCategory("Transport")
+	food, _ := ledger.CreateCategory("Food")
+
+	day := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	add := func(categoryID, amount int64, tags ...string) Transaction {
+		t.Helper()
+		saved, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: categoryID, AmountKopeks: amount, OccurredAt: day, Tags: tags})
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		return saved
+	}
+	train := add(transport.ID, -400_000, "#Kazan-2024", "travel", "kazan-2024")
+	if len(train.Tags) != 2 || train.Tags[0] != "kazan-2024" {
+		t.Fatalf("tags must be normalised and deduplicated: %v", train.Tags)
+	}
+	add(food.ID, -250_000, "kazan-2024")
+	add(food.ID, -90_000)
+
+	train.Note = "Сапсан"
+	train.Tags = nil
+	updated, err := ledger.UpdateTransaction(train)
+	if err != nil || len(updated.Tags) != 2 {
+		t.Fatalf("nil tags must keep existing: %+v %v", updated, err)
+	}
+
+	byTag, err := ledger.SummaryByTag(SummaryFilter{From: day, To: day})
+	if err != nil {
+		t.Fatalf("summary by tag: %v", err)
+	}
+	if len(byTag) != 2 || byTag[0].Name != "kazan-2024" || byTag[0].ExpenseKopeks != -650_000 || byTag[0].Count != 2 {
+		t.Fatalf("unexpected tag summary: %+v", byTag)
+	}
+	if _, err := ledger.SummaryByTag(SummaryFilter{From: day, To: day, KnownAt: day}); !errors.Is(err, errValidation) {
+		t.Fatal("summary by tag as of a past moment must be refused")
+	}
+
+	tags, _ := ledger.ListTags()
+	var kazan, travel Tag
+	for _, tag := range tags {
+		switch tag.Name {
+		case "kazan-2024":
+			kazan = tag
+		case "travel":
+			travel = tag
+		}
+	}
+	if _, err := ledger.RenameTag(travel.ID, "Kazan-2024"); !errors.Is(err, errConflict) {
+		t.Fatalf("rename onto existing tag must conflict, got %v", err)
+	}
+	if _, err := ledger.MergeTags(travel.ID, kazan.ID); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	got, err := ledger.GetTransaction(train.ID)
+	if err != nil || len(got.Tags) != 1 || got.Tags[0] != "kazan-2024" {
+		t.Fatalf("merged tag must stay once on the transaction: %+v %v", got, err)
+	}
+
+	if err := ledger.DeleteTag(kazan.ID); err != nil {
+		t.Fatalf("delete tag: %v", err)
+	}
+	if got, _ := ledger.GetTransaction(train.ID); len(got.Tags) != 0 {
+		t.Fatalf("deleted tag must be removed from transactions: %v", got.Tags)
+	}
+}
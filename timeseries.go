@@ -0,0 +1,220 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+	_ "time/tzdata" // часовые пояса отчётов работают и без системной базы zoneinfo
+)
+
+// Шаги временного ряда.
+const (
+	granularityDay   = "day"
+	granularityWeek  = "week"
+	granularityMonth = "month"
+	granularityYear  = "year"
+)
+
+var granularities = map[string]bool{
+	granularityDay:   true,
+	granularityWeek:  true,
+	granularityMonth: true,
+	granularityYear:  true,
+}
+
+// maxTimeseriesBuckets ограничивает длину ряда, чтобы день за десять лет не
+// превращался в десятки тысяч точек на каждую категорию.
+const maxTimeseriesBuckets = 1000
+
+// defaultTimeseriesPeriods — сколько периодов показывает ряд без явного начала.
+const defaultTimeseriesPeriods = 12
+
+// TimeseriesFilter задаёт временной ряд доходов и расходов. Периоды считаются
+// в часовом поясе Location (nil — UTC): день — с полуночи, неделя — с
+// понедельника, месяц и год — с первого числа. From и To — моменты; в ряд
+// попадают все периоды, пересекающиеся с [From, To].
+type TimeseriesFilter struct {
+	From        time.Time
+	To          time.Time
+	Granularity string
+	Location    *time.Location
+	AccountID   int64
+	// Currency, как в SummaryFilter: пустая — ряды по валютам операций,
+	// иначе всё пересчитывается по курсу на дату операции.
+	Currency string
+	// ByCategory разбивает ряд по категориям (строки разбивки — в своих категориях).
+	ByCategory bool
+}
+
+// TimeseriesPoint — итоги одного периода; периоды без операций — нулевые.
+type TimeseriesPoint struct {
+	PeriodStart   time.Time
+	PeriodEnd     time.Time // последний день периода
+	IncomeKopeks  int64
+	ExpenseKopeks int64 // отрицательное
+	NetKopeks     int64
+	Count         int
+}
+
+// TimeseriesSeries — ряд по одной валюте (и категории при ByCategory; 0 — без
+// категории) с точкой на каждый период.
+type TimeseriesSeries struct {
+	CategoryID int64
+	Currency   string
+	Points     []TimeseriesPoint
+}
+
+// periodStartIn — начало периода granularity, содержащего t, в часовом поясе loc.
+func periodStartIn(granularity string, t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch granularity {
+	case granularityWeek:
+		offset := (int(day.Weekday()) + 6) % 7 // понедельник — 0
+		return day.AddDate(0, 0, -offset)
+	case granularityMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, loc)
+	case granularityYear:
+		return time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, loc)
+	default:
+		return day
+	}
+}
+
+// nextPeriod — начало периода, следующего за начинающимся в start.
+func nextPeriod(granularity string, start time.Time) time.Time {
+	switch granularity {
+	case granularityWeek:
+		return start.AddDate(0, 0, 7)
+	case granularityMonth:
+		return start.AddDate(0, 1, 0)
+	case granularityYear:
+		return start.AddDate(1, 0, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Timeseries считает доходы и расходы по периодам. Переводы, как и в Summary,
+// не учитываются. Ряды отсортированы по категории и валюте.
+func (l *Ledger) Timeseries(f TimeseriesFilter) ([]TimeseriesSeries, error) {
+	if !granularities[f.Granularity] {
+		return nil, fmt.Errorf("неизвестный шаг %q (ожидается day, week, month или year)", f.Granularity)
+	}
+	loc := f.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	if f.To.IsZero() {
+		f.To = time.Now()
+	}
+	if f.To.Before(f.From) {
+		f.From, f.To = f.To, f.From
+	}
+	target, err := normalizeCurrency(f.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var starts []time.Time
+	for p := periodStartIn(f.Granularity, f.From, loc); !p.After(f.To); p = nextPeriod(f.Granularity, p) {
+		if len(starts) == maxTimeseriesBuckets {
+			return nil, fmt.Errorf("слишком длинный ряд: больше %d периодов, увеличьте шаг или сократите интервал", maxTimeseriesBuckets)
+		}
+		starts = append(starts, p)
+	}
+
+	keyExpr := "0"
+	if f.ByCategory {
+		keyExpr = "COALESCE(category_id, 0)"
+	}
+	// Группы по моменту операции: период определяется уже в Go по часовому поясу,
+	// а курс для пересчёта — по дню операции, как в aggregate.
+	rows, err := l.db.Query(`
+SELECT
+	occurred_at,
+	`+keyExpr+` AS grp,
+	currency,
+	SUM(CASE WHEN amount_kopeks >= 0 THEN amount_kopeks ELSE 0 END) AS income,
+	SUM(CASE WHEN amount_kopeks < 0 THEN amount_kopeks ELSE 0 END) AS expense,
+	COUNT(DISTINCT id) AS cnt
+FROM `+transactionLinesSQL+`
+WHERE occurred_at BETWEEN ? AND ?
+AND transfer_id IS NULL
+AND (? = 0 OR account_id = ?)
+GROUP BY occurred_at, grp, currency`,
+		f.From.UTC().Format(time.RFC3339), f.To.UTC().Format(time.RFC3339), f.AccountID, f.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("временной ряд: %w", err)
+	}
+	defer rows.Close()
+
+	type seriesKey struct {
+		category int64
+		currency string
+	}
+	conv := newRateConverter(l.db)
+	series := make(map[seriesKey][]TimeseriesPoint)
+	for rows.Next() {
+		var occurredAt string
+		var key seriesKey
+		var income, expense int64
+		var count int
+		if err := rows.Scan(&occurredAt, &key.category, &key.currency, &income, &expense, &count); err != nil {
+			return nil, fmt.Errorf("scan timeseries: %w", err)
+		}
+		at, err := time.Parse(time.RFC3339, occurredAt)
+		if err != nil {
+			return nil, fmt.Errorf("дата операции %q: %w", occurredAt, err)
+		}
+		if target != "" {
+			day := occurredAt[:10]
+			if income, err = conv.convert(income, key.currency, target, day); err != nil {
+				return nil, err
+			}
+			if expense, err = conv.convert(expense, key.currency, target, day); err != nil {
+				return nil, err
+			}
+			key.currency = target
+		}
+
+		points, ok := series[key]
+		if !ok {
+			points = make([]TimeseriesPoint, len(starts))
+			series[key] = points
+		}
+		// Начала периодов возрастают: ищем последний, начавшийся не позже операции.
+		i, found := slices.BinarySearchFunc(starts, at, func(s, t time.Time) int { return s.Compare(t) })
+		if !found {
+			i--
+		}
+		if i < 0 {
+			continue
+		}
+		points[i].IncomeKopeks += income
+		points[i].ExpenseKopeks += expense
+		points[i].Count += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Без разбивки по категориям пустой интервал — всё равно нулевой ряд.
+	if len(series) == 0 && !f.ByCategory {
+		series[seriesKey{currency: cmp.Or(target, baseCurrency)}] = make([]TimeseriesPoint, len(starts))
+	}
+	out := make([]TimeseriesSeries, 0, len(series))
+	for key, points := range series {
+		for i := range points {
+			points[i].PeriodStart = starts[i]
+			points[i].PeriodEnd = nextPeriod(f.Granularity, starts[i]).AddDate(0, 0, -1)
+			points[i].NetKopeks = points[i].IncomeKopeks + points[i].ExpenseKopeks
+		}
+		out = append(out, TimeseriesSeries{CategoryID: key.category, Currency: key.currency, Points: points})
+	}
+	slices.SortFunc(out, func(a, b TimeseriesSeries) int {
+		return cmp.Or(cmp.Compare(a.CategoryID, b.CategoryID), cmp.Compare(a.Currency, b.Currency))
+	})
+	return out, nil
+}
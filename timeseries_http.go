@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// handleTimeseries — GET /reports/timeseries?granularity=month&tz=Europe/Moscow&from=...&to=...&by_category=true&currency=RUB&account_id=...:
+// доходы и расходы по периодам, пустые периоды — нули. from и to — даты в часовом
+// поясе tz (по умолчанию UTC), to включает весь день; без from ряд охватывает
+// defaultTimeseriesPeriods периодов до to.
+func (s *server) handleTimeseries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	granularity := cmp.Or(q.Get("granularity"), granularityMonth)
+	if !granularities[granularity] {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("granularity должен быть day, week, month или year"))
+		return
+	}
+	loc, err := time.LoadLocation(cmp.Or(q.Get("tz"), "UTC"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("неизвестный часовой пояс %q", q.Get("tz")))
+		return
+	}
+	from, err := parseDate(q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := parseDate(q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	accountID, err := parseIDParam(q, "account_id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	currency, err := normalizeCurrency(q.Get("currency"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	byCategory, err := parseBoolParam(q, "by_category")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Даты из запроса — календарные дни в часовом поясе отчёта.
+	inLoc := func(d time.Time) time.Time {
+		return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)
+	}
+	end := time.Now()
+	if !to.IsZero() {
+		end = inLoc(to).AddDate(0, 0, 1).Add(-time.Second)
+	}
+	start := periodStartIn(granularity, end, loc)
+	if from.IsZero() {
+		for range defaultTimeseriesPeriods - 1 {
+			start = periodStartIn(granularity, start.Add(-time.Second), loc)
+		}
+	} else {
+		start = inLoc(from)
+	}
+
+	series, err := s.ledger.Timeseries(TimeseriesFilter{
+		From:        start,
+		To:          end,
+		Granularity: granularity,
+		Location:    loc,
+		AccountID:   accountID,
+		Currency:    currency,
+		ByCategory:  byCategory,
+	})
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+
+	type pointResp struct {
+		PeriodStart string `json:"period_start"`
+		PeriodEnd   string `json:"period_end"`
+		Income      Money  `json:"income"`
+		Expense     Money  `json:"expense"`
+		Net         Money  `json:"net"`
+		Count       int    `json:"count"`
+	}
+	type seriesResp struct {
+		CategoryID *int64      `json:"category_id,omitempty"`
+		Currency   string      `json:"currency"`
+		Points     []pointResp `json:"points"`
+	}
+	type timeseriesResp struct {
+		Granularity string       `json:"granularity"`
+		Timezone    string       `json:"timezone"`
+		Series      []seriesResp `json:"series"`
+	}
+
+	resp := timeseriesResp{Granularity: granularity, Timezone: loc.String(), Series: make([]seriesResp, 0, len(series))}
+	for _, ts := range series {
+		sr := seriesResp{Currency: ts.Currency, Points: make([]pointResp, 0, len(ts.Points))}
+		if byCategory {
+			sr.CategoryID = &ts.CategoryID
+		}
+		for _, p := range ts.Points {
+			sr.Points = append(sr.Points, pointResp{
+				PeriodStart: p.PeriodStart.Format("2006-01-02"),
+				PeriodEnd:   p.PeriodEnd.Format("2006-01-02"),
+				Income:      fromMinorUnits(p.IncomeKopeks, ts.Currency),
+				Expense:     fromMinorUnits(-p.ExpenseKopeks, ts.Currency),
+				Net:         fromMinorUnits(p.NetKopeks, ts.Currency),
+				Count:       p.Count,
+			})
+		}
+		resp.Series = append(resp.Series, sr)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeseriesBucketsAndFillsGaps(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	salary, _ := ledger.CreateCategory("Salary")
+	deposit, err := ledger.CreateAccount("Savings", "deposit", "")
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+
+	add := func(categoryID, amount int64, at time.Time) {
+		t.Helper()
+		if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: categoryID, AmountKopeks: amount, OccurredAt: at}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	add(food.ID, -300_00, time.Date(2024, time.January, 15, 12, 0, 0, 0, time.UTC))
+	add(salary.ID, 1_000_00, time.Date(2024, time.January, 20, 12, 0, 0, 0, time.UTC))
+	add(food.ID, -200_00, time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC))
+	if _, err := ledger.CreateTransfer(Transfer{FromAccountID: defaultAccountID, ToAccountID: deposit.ID, AmountKopeks: 500_00,
+		OccurredAt: time.Date(2024, time.February, 1, 12, 0, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, time.March, 31, 23, 59, 59, 0, time.UTC)
+	series, err := ledger.Timeseries(TimeseriesFilter{From: from, To: to, Granularity: granularityMonth})
+	if err != nil {
+		t.Fatalf("timeseries: %v", err)
+	}
+	if len(series) != 1 || series[0].Currency != "RUB" || len(series[0].Points) != 3 {
+		t.Fatalf("expected one RUB series with three months: %+v", series)
+	}
+	jan, feb, mar := series[0].Points[0], series[0].Points[1], series[0].Points[2]
+	if jan.IncomeKopeks != 1_000_00 || jan.ExpenseKopeks != -300_00 || jan.NetKopeks != 700_00 || jan.Count != 2 ||
+		!jan.PeriodEnd.Equal(time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected January: %+v", jan)
+	}
+	if feb.Count != 0 || feb.NetKopeks != 0 || !feb.PeriodStart.Equal(time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected empty February without the transfer: %+v", feb)
+	}
+	if mar.ExpenseKopeks != -200_00 {
+		t.Fatalf("unexpected March: %+v", mar)
+	}
+
+	byCategory, err := ledger.Timeseries(TimeseriesFilter{From: from, To: to, Granularity: granularityMonth, ByCategory: true})
+	if err != nil {
+		t.Fatalf("timeseries by category: %v", err)
+	}
+	if len(byCategory) != 2 || byCategory[0].CategoryID != food.ID || byCategory[1].CategoryID != salary.ID ||
+		len(byCategory[1].Points) != 3 || byCategory[1].Points[2].Count != 0 || byCategory[0].Points[2].ExpenseKopeks != -200_00 {
+		t.Fatalf("unexpected series by category: %+v", byCategory)
+	}
+
+	weeks, err := ledger.Timeseries(TimeseriesFilter{From: from, To: time.Date(2024, time.January, 21, 0, 0, 0, 0, time.UTC), Granularity: granularityWeek})
+	if err != nil {
+		t.Fatalf("weekly timeseries: %v", err)
+	}
+	// 1 января 2024 — понедельник: три недели, с 1, 8 и 15 января; обе операции — в последней.
+	if points := weeks[0].Points; len(points) != 3 || points[2].Count != 2 || points[0].Count != 0 {
+		t.Fatalf("unexpected weekly points: %+v", points)
+	}
+
+	if _, err := ledger.Timeseries(TimeseriesFilter{From: from, To: to, Granularity: "hour"}); err == nil {
+		t.Fatal("expected error for unknown granularity")
+	}
+	if _, err := ledger.Timeseries(TimeseriesFilter{From: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), To: to, Granularity: granularityDay}); err == nil {
+		t.Fatal("expected error for too many buckets")
+	}
+}
+
+func TestTimeseriesUsesTimezone(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	// 23:30 UTC 31 января — уже 1 февраля в Москве.
+	if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -100_00,
+		OccurredAt: time.Date(2024, time.January, 31, 23, 30, 0, 0, time.UTC)}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+
+	for _, tc := range []struct {
+		loc      *time.Location
+		february bool
+	}{{time.UTC, false}, {moscow, true}} {
+		from := time.Date(2024, time.January, 1, 0, 0, 0, 0, tc.loc)
+		to := time.Date(2024, time.February, 29, 23, 59, 59, 0, tc.loc)
+		series, err := ledger.Timeseries(TimeseriesFilter{From: from, To: to, Granularity: granularityMonth, Location: tc.loc})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.loc, err)
+		}
+		points := series[0].Points
+		if len(points) != 2 || (points[1].Count == 1) != tc.february || points[0].PeriodStart.Location() != tc.loc {
+			t.Fatalf("%s: unexpected points %+v", tc.loc, points)
+		}
+	}
+}
+
+func TestTimeseriesConvertsCurrency(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	usd, err := ledger.CreateAccount("USD card", "card", "USD")
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	if _, err := ledger.ImportRates(strings.NewReader("date,currency,quote,rate\n2024-05-01,USD,RUB,90\n")); err != nil {
+		t.Fatalf("import rates: %v", err)
+	}
+	day := time.Date(2024, time.May, 2, 0, 0, 0, 0, time.UTC)
+	for _, tx := range []Transaction{
+		{AccountID: usd.ID, CategoryID: food.ID, AmountKopeks: -10_00, OccurredAt: day},
+		{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -100_00, OccurredAt: day},
+	} {
+		if _, err := ledger.AddTransaction(tx); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+
+	from, to := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC)
+	split, err := ledger.Timeseries(TimeseriesFilter{From: from, To: to, Granularity: granularityYear})
+	if err != nil || len(split) != 2 {
+		t.Fatalf("expected a series per currency: %+v %v", split, err)
+	}
+	rub, err := ledger.Timeseries(TimeseriesFilter{From: from, To: to, Granularity: granularityYear, Currency: "RUB"})
+	if err != nil || len(rub) != 1 || rub[0].Points[0].ExpenseKopeks != -1_000_00 || rub[0].Points[0].Count != 2 {
+		t.Fatalf("expected USD converted into one RUB series: %+v %v", rub, err)
+	}
+	if _, err := ledger.Timeseries(TimeseriesFilter{From: from, To: to, Granularity: granularityYear, Currency: "EUR"}); !errors.Is(err, errNoRate) {
+		t.Fatalf("expected errNoRate, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Transfer — перемещение денег между своими счетами. Хранится как две
+// связанные строки transactions (списание и зачисление) без категории.
+// AmountKopeks списывается в валюте исходного счёта, ToAmountKopeks
+// зачисляется в валюте целевого; для одной валюты они равны.
+type Transfer struct {
+	ID             int64
+	FromAccountID  int64
+	ToAccountID    int64
+	AmountKopeks   int64
+	ToAmountKopeks int64
+	OccurredAt     time.Time
+	Note           string
+	// FromTxID и ToTxID — ноги перевода в таблице transactions.
+	FromTxID int64
+	ToTxID   int64
+}
+
+// CreateTransfer атомарно записывает перевод и обе его ноги.
+func (l *Ledger) CreateTransfer(tr Transfer) (Transfer, error) {
+	if tr.FromAccountID == 0 || tr.ToAccountID == 0 {
+		return Transfer{}, errors.New("счета перевода не указаны")
+	}
+	if tr.FromAccountID == tr.ToAccountID {
+		return Transfer{}, errors.New("перевод на тот же счёт")
+	}
+	if tr.AmountKopeks <= 0 {
+		return Transfer{}, errors.New("сумма перевода должна быть больше 0")
+	}
+	if tr.OccurredAt.IsZero() {
+		return Transfer{}, errors.New("дата перевода не указана")
+	}
+	tr.OccurredAt = tr.OccurredAt.UTC()
+	occurredAt := tr.OccurredAt.Format(time.RFC3339)
+
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Transfer{}, fmt.Errorf("begin tx: %w", err)
+	}
+	fromCurrency, err := accountCurrency(txObj, tr.FromAccountID)
+	if err != nil {
+		txObj.Rollback()
+		return Transfer{}, err
+	}
+	toCurrency, err := accountCurrency(txObj, tr.ToAccountID)
+	if err != nil {
+		txObj.Rollback()
+		return Transfer{}, err
+	}
+	if tr.ToAmountKopeks == 0 {
+		if fromCurrency != toCurrency {
+			txObj.Rollback()
+			return Transfer{}, fmt.Errorf("валюты счетов разные (%s → %s): укажите сумму зачисления", fromCurrency, toCurrency)
+		}
+		tr.ToAmountKopeks = tr.AmountKopeks
+	}
+	if tr.ToAmountKopeks < 0 {
+		txObj.Rollback()
+		return Transfer{}, errors.New("сумма зачисления должна быть больше 0")
+	}
+
+	res, err := txObj.Exec(
+		"INSERT INTO transfers (from_account_id, to_account_id, amount_kopeks, to_amount_kopeks, occurred_at, note) VALUES (?, ?, ?, ?, ?, ?)",
+		tr.FromAccountID, tr.ToAccountID, tr.AmountKopeks, tr.ToAmountKopeks, occurredAt, tr.Note,
+	)
+	if err != nil {
+		txObj.Rollback()
+		return Transfer{}, fmt.Errorf("сохранение перевода: %w", err)
+	}
+	tr.ID, _ = res.LastInsertId()
+
+	legs := []struct {
+		accountID int64
+		amount    int64
+		currency  string
+		id        *int64
+	}{
+		{tr.FromAccountID, -tr.AmountKopeks, fromCurrency, &tr.FromTxID},
+		{tr.ToAccountID, tr.ToAmountKopeks, toCurrency, &tr.ToTxID},
+	}
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	for _, leg := range legs {
+		res, err := txObj.Exec(
+			"INSERT INTO transactions (account_id, amount_kopeks, currency, occurred_at, note, transfer_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			leg.accountID, leg.amount, leg.currency, occurredAt, tr.Note, tr.ID, createdAt,
+		)
+		if err != nil {
+			txObj.Rollback()
+			return Transfer{}, fmt.Errorf("сохранение ноги перевода: %w", err)
+		}
+		*leg.id, _ = res.LastInsertId()
+		// Ноги — обычные строки transactions: журнал нужен им так же, как
+		// операциям, иначе отчёты на прошлую дату их не восстановят.
+		saved, err := getTransaction(txObj, *leg.id)
+		if err != nil {
+			txObj.Rollback()
+			return Transfer{}, err
+		}
+		if err := l.audit(txObj, auditCreate, auditTransaction, saved.ID, nil, saved); err != nil {
+			txObj.Rollback()
+			return Transfer{}, err
+		}
+	}
+
+	if err := txObj.Commit(); err != nil {
+		return Transfer{}, fmt.Errorf("commit: %w", err)
+	}
+	return tr, nil
+}
+
+const transferSelect = `
+SELECT t.id, t.from_account_id, t.to_account_id, t.amount_kopeks, t.to_amount_kopeks, t.occurred_at, t.note,
+	COALESCE((SELECT id FROM transactions WHERE transfer_id = t.id AND amount_kopeks < 0), 0),
+	COALESCE((SELECT id FROM transactions WHERE transfer_id = t.id AND amount_kopeks >= 0), 0)
+FROM transfers t`
+
+func scanTransfer(row interface{ Scan(dest ...any) error }) (Transfer, error) {
+	var tr Transfer
+	var ts string
+	if err := row.Scan(&tr.ID, &tr.FromAccountID, &tr.ToAccountID, &tr.AmountKopeks, &tr.ToAmountKopeks, &ts, &tr.Note, &tr.FromTxID, &tr.ToTxID); err != nil {
+		return Transfer{}, err
+	}
+	tr.OccurredAt, _ = time.Parse(time.RFC3339, ts)
+	return tr, nil
+}
+
+func (l *Ledger) GetTransfer(id int64) (Transfer, error) {
+	tr, err := scanTransfer(l.db.QueryRow(transferSelect+" WHERE t.id = ?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Transfer{}, fmt.Errorf("%w: перевод %d", errNotFound, id)
+		}
+		return Transfer{}, fmt.Errorf("чтение перевода: %w", err)
+	}
+	return tr, nil
+}
+
+// ListTransfers возвращает переводы за период; accountID != 0 оставляет только
+// переводы, затрагивающие этот счёт.
+func (l *Ledger) ListTransfers(from, to time.Time, accountID int64) ([]Transfer, error) {
+	rows, err := l.db.Query(transferSelect+`
+WHERE t.occurred_at BETWEEN ? AND ?
+AND (? = 0 OR t.from_account_id = ? OR t.to_account_id = ?)
+ORDER BY t.occurred_at DESC, t.id DESC`,
+		from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), accountID, accountID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("чтение переводов: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Transfer
+	for rows.Next() {
+		tr, err := scanTransfer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan transfer: %w", err)
+		}
+		out = append(out, tr)
+	}
+	return out, rows.Err()
+}
+
+// DeleteTransfer удаляет перевод; ноги удаляются каскадом, и на каждую в
+// журнале остаётся запись об удалении.
+func (l *Ledger) DeleteTransfer(id int64) error {
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	legs, err := selectIDs(txObj, "SELECT id FROM transactions WHERE transfer_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("чтение ног перевода: %w", err)
+	}
+	err = l.auditChanges(txObj, auditDelete, auditTransaction, legs, func() error {
+		res, err := txObj.Exec("DELETE FROM transfers WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("удаление перевода: %w", err)
+		}
+		affected, _ := res.RowsAffected()
+		if affected == 0 {
+			return fmt.Errorf("%w: перевод %d", errNotFound, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := txObj.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
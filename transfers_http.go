@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// handleTransfers поддерживает POST (создание перевода) и GET (список за период).
+func (s *server) handleTransfers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			FromAccountID int64  `json:"from_account_id"`
+			ToAccountID   int64  `json:"to_account_id"`
+			Amount        string `json:"amount"`      // в валюте счёта списания
+			ToAmount      string `json:"to_amount"`   // в валюте счёта зачисления, если она другая
+			OccurredAt    string `json:"occurred_at"` // YYYY-MM-DD
+			Note          string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("ошибка разбора json: %w", err))
+			return
+		}
+		fromAcc, err := s.ledger.GetAccount(req.FromAccountID)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		toAcc, err := s.ledger.GetAccount(req.ToAccountID)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		amount, err := parseMoney(req.Amount, fromAcc.Currency)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		var toAmount int64
+		if req.ToAmount != "" {
+			if toAmount, err = parseMoney(req.ToAmount, toAcc.Currency); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		date, err := parseDate(req.OccurredAt)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if date.IsZero() {
+			writeError(w, http.StatusBadRequest, errors.New("дата перевода не указана"))
+			return
+		}
+
+		tr, err := s.ledger.CreateTransfer(Transfer{
+			FromAccountID:  req.FromAccountID,
+			ToAccountID:    req.ToAccountID,
+			AmountKopeks:   amount,
+			ToAmountKopeks: toAmount,
+			OccurredAt:     date,
+			Note:           req.Note,
+		})
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, tr)
+	case http.MethodGet:
+		params, err := parseTxQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		transfers, err := s.ledger.ListTransfers(params.from, params.to, params.accountID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, transfers)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTransferByID поддерживает GET и DELETE /transfers/{id}.
+func (s *server) handleTransferByID(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromPath(r.URL.Path, "/transfers/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		tr, err := s.ledger.GetTransfer(id)
+		if err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tr)
+	case http.MethodDelete:
+		if err := s.ledger.DeleteTransfer(id); err != nil {
+			writeLedgerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
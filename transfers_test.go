@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransferMovesBalanceButNotSummary(t *testing.T) {
+	ledger := newTestLedger(t)
+
+	deposit, err := ledger.CreateAccount("Savings", "deposit", "")
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	food, err := ledger.CreateCategory("Food")
+	if err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+	if _, err := ledger.UpsertBudget(Budget{CategoryID: food.ID, LimitKopeks: 1_000}); err != nil {
+		t.Fatalf("set budget: %v", err)
+	}
+
+	day := time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)
+	if _, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -500, OccurredAt: day}); err != nil {
+		t.Fatalf("add transaction: %v", err)
+	}
+	tr, err := ledger.CreateTransfer(Transfer{
+		FromAccountID: defaultAccountID,
+		ToAccountID:   deposit.ID,
+		AmountKopeks:  50_000,
+		OccurredAt:    day,
+	})
+	if err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	if tr.FromTxID == 0 || tr.ToTxID == 0 {
+		t.Fatalf("transfer legs not linked: %+v", tr)
+	}
+
+	primary, _ := ledger.AccountBalance(defaultAccountID, day)
+	savings, _ := ledger.AccountBalance(deposit.ID, day)
+	if primary != -50_500 || savings != 50_000 {
+		t.Fatalf("balances after transfer: main=%d savings=%d", primary, savings)
+	}
+
+	summary, err := ledger.Summary(SummaryFilter{From: day, To: day})
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if len(summary) != 1 || summary[0].CategoryID != food.ID || summary[0].Count != 1 {
+		t.Fatalf("transfer leaked into summary: %+v", summary)
+	}
+	alerts, err := ledger.ExceededBudgets(day, day, "")
+	if err != nil {
+		t.Fatalf("alerts: %v", err)
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("transfer tripped budget: %+v", alerts)
+	}
+
+	if _, err := ledger.UpdateTransaction(Transaction{ID: tr.FromTxID, AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -1, OccurredAt: day}); !errors.Is(err, errConflict) {
+		t.Fatalf("expected conflict editing transfer leg, got %v", err)
+	}
+
+	if err := ledger.DeleteTransfer(tr.ID); err != nil {
+		t.Fatalf("delete transfer: %v", err)
+	}
+	if savings, _ := ledger.AccountBalance(deposit.ID, day); savings != 0 {
+		t.Fatalf("legs survived transfer deletion, savings=%d", savings)
+	}
+}
+
+func TestTransferLegsAreAudited(t *testing.T) {
+	ledger := newTestLedger(t)
+	deposit, err := ledger.CreateAccount("Savings", "deposit", "")
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	tr, err := ledger.WithActor("alice").CreateTransfer(Transfer{FromAccountID: defaultAccountID, ToAccountID: deposit.ID, AmountKopeks: 5_000,
+		OccurredAt: time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	if err := ledger.WithActor("bob").DeleteTransfer(tr.ID); err != nil {
+		t.Fatalf("delete transfer: %v", err)
+	}
+
+	for _, legID := range []int64{tr.FromTxID, tr.ToTxID} {
+		history, err := ledger.TransactionHistory(legID)
+		if err != nil {
+			t.Fatalf("history: %v", err)
+		}
+		if len(history) != 2 || history[0].Operation != auditCreate || history[0].Actor != "alice" ||
+			history[1].Operation != auditDelete || history[1].Actor != "bob" || history[1].Before == nil || history[1].After != nil {
+			t.Fatalf("leg %d: unexpected history %+v", legID, history)
+		}
+	}
+	if err := ledger.DeleteTransfer(tr.ID); !errors.Is(err, errNotFound) {
+		t.Fatalf("deleting a missing transfer must be not found, got %v", err)
+	}
+}
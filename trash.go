@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// trashRetention — сколько операции лежат в корзине, прежде чем PurgeTrash
+// удалит их без явного срока.
+const trashRetention = 30 * 24 * time.Hour
+
+// TrashedTransaction — операция в корзине и время её удаления.
+type TrashedTransaction struct {
+	Transaction
+	DeletedAt time.Time
+}
+
+// DeleteTransaction переносит операцию в корзину: она пропадает из выборок,
+// сводок, бюджетов и остатков, но её можно вернуть RestoreTransaction.
+// Ноги перевода удаляются только вместе с переводом.
+func (l *Ledger) DeleteTransaction(id int64) error {
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	var transferID sql.NullInt64
+	var deletedAt sql.NullString
+	err = txObj.QueryRow("SELECT transfer_id, deleted_at FROM transactions WHERE id = ?", id).Scan(&transferID, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: транзакция %d", errNotFound, id)
+	}
+	if err != nil {
+		return fmt.Errorf("чтение транзакции: %w", err)
+	}
+	if transferID.Valid {
+		return fmt.Errorf("%w: транзакция %d — часть перевода %d, удаляйте перевод целиком", errConflict, id, transferID.Int64)
+	}
+	if deletedAt.Valid {
+		return fmt.Errorf("%w: транзакция %d уже в корзине", errConflict, id)
+	}
+	before, err := getTransaction(txObj, id)
+	if err != nil {
+		return err
+	}
+	if _, err := txObj.Exec("UPDATE transactions SET deleted_at = ? WHERE id = ?", time.Now().UTC().Format(time.RFC3339), id); err != nil {
+		return fmt.Errorf("удаление транзакции: %w", err)
+	}
+	if err := l.audit(txObj, auditDelete, auditTransaction, id, before, nil); err != nil {
+		return err
+	}
+	if err := txObj.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// RestoreTransaction возвращает операцию из корзины.
+func (l *Ledger) RestoreTransaction(id int64) (Transaction, error) {
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return Transaction{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	res, err := txObj.Exec("UPDATE transactions SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("восстановление транзакции: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		if _, err := getTransaction(txObj, id); err != nil {
+			return Transaction{}, err
+		}
+		return Transaction{}, fmt.Errorf("%w: транзакции %d нет в корзине", errConflict, id)
+	}
+	t, err := getTransaction(txObj, id)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := l.audit(txObj, auditRestore, auditTransaction, id, nil, t); err != nil {
+		return Transaction{}, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return Transaction{}, fmt.Errorf("commit: %w", err)
+	}
+	return t, nil
+}
+
+// ListTrash возвращает операции в корзине, недавно удалённые — первыми.
+func (l *Ledger) ListTrash() ([]TrashedTransaction, error) {
+	rows, err := l.db.Query(`
+SELECT ` + transactionColumns + `, deleted_at
+FROM transactions
+WHERE deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("чтение корзины: %w", err)
+	}
+	defer rows.Close()
+
+	var txs []Transaction
+	var deleted []time.Time
+	for rows.Next() {
+		var deletedAt string
+		t, err := scanTransaction(scanWithExtra(rows, &deletedAt))
+		if err != nil {
+			return nil, fmt.Errorf("scan transaction: %w", err)
+		}
+		at, _ := time.Parse(time.RFC3339, deletedAt)
+		txs = append(txs, t)
+		deleted = append(deleted, at)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := withTags(l.db, txs); err != nil {
+		return nil, err
+	}
+	if err := withSplits(l.db, txs); err != nil {
+		return nil, err
+	}
+
+	out := make([]TrashedTransaction, len(txs))
+	for i, t := range txs {
+		out[i] = TrashedTransaction{Transaction: t, DeletedAt: deleted[i]}
+	}
+	return out, nil
+}
+
+// PurgeTrash окончательно удаляет операции, попавшие в корзину не позже before,
+// и возвращает их число.
+func (l *Ledger) PurgeTrash(before time.Time) (int64, error) {
+	txObj, err := l.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer txObj.Rollback()
+
+	cutoff := before.UTC().Format(time.RFC3339)
+	ids, err := selectIDs(txObj, "SELECT id FROM transactions WHERE deleted_at IS NOT NULL AND deleted_at <= ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("выборка корзины: %w", err)
+	}
+	var purged int64
+	err = l.auditChanges(txObj, auditPurge, auditTransaction, ids, func() error {
+		res, err := txObj.Exec("DELETE FROM transactions WHERE deleted_at IS NOT NULL AND deleted_at <= ?", cutoff)
+		if err != nil {
+			return fmt.Errorf("очистка корзины: %w", err)
+		}
+		purged, _ = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := txObj.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return purged, nil
+}
+
+// scanWithExtra дописывает к полям scanTransaction дополнительные колонки,
+// выбранные после transactionColumns.
+func scanWithExtra(row interface{ Scan(dest ...any) error }, extra ...any) interface{ Scan(dest ...any) error } {
+	return scannerFunc(func(dest ...any) error {
+		return row.Scan(append(dest, extra...)...)
+	})
+}
+
+type scannerFunc func(dest ...any) error
+
+func (f scannerFunc) Scan(dest ...any) error { return f(dest...) }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleTrash — GET /transactions/trash: операции в корзине.
+func (s *server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	trash, err := s.ledger.ListTrash()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trash)
+}
+
+// handleTrashPurge — POST /transactions/trash/purge?older_than_days=30: окончательно
+// удалить операции, пролежавшие в корзине дольше срока (по умолчанию trashRetention;
+// 0 — очистить всю корзину).
+func (s *server) handleTrashPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	retention := trashRetention
+	if raw := r.URL.Query().Get("older_than_days"); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("older_than_days должен быть неотрицательным числом"))
+			return
+		}
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+	purged, err := s.ledgerFor(r).PurgeTrash(time.Now().Add(-retention))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"purged": purged})
+}
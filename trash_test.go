@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteRestoreAndPurge(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+
+	day := time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)
+	keep, _ := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -1_000, OccurredAt: day})
+	mistake, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: food.ID, AmountKopeks: -50_000, OccurredAt: day, Tags: []string{"typo"}})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	if err := ledger.DeleteTransaction(mistake.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := ledger.DeleteTransaction(mistake.ID); !errors.Is(err, errConflict) {
+		t.Fatalf("second delete must conflict, got %v", err)
+	}
+	summary, _ := ledger.Summary(SummaryFilter{From: day, To: day})
+	if s := findSummary(summary, food.ID); s.ExpenseKopeks != -1_000 || s.Count != 1 {
+		t.Fatalf("deleted transaction must leave the summary: %+v", s)
+	}
+	if balance, _ := ledger.AccountBalance(defaultAccountID, day); balance != -1_000 {
+		t.Fatalf("deleted transaction must leave the balance: %d", balance)
+	}
+	mistake.Note = "edit"
+	if _, err := ledger.UpdateTransaction(mistake); !errors.Is(err, errNotFound) {
+		t.Fatalf("trashed transaction must not be editable, got %v", err)
+	}
+
+	trash, err := ledger.ListTrash()
+	if err != nil || len(trash) != 1 || trash[0].ID != mistake.ID || trash[0].DeletedAt.IsZero() || len(trash[0].Tags) != 1 {
+		t.Fatalf("unexpected trash: %+v %v", trash, err)
+	}
+
+	restored, err := ledger.RestoreTransaction(mistake.ID)
+	if err != nil || restored.AmountKopeks != -50_000 {
+		t.Fatalf("restore: %+v %v", restored, err)
+	}
+	if _, err := ledger.RestoreTransaction(keep.ID); !errors.Is(err, errConflict) {
+		t.Fatalf("restoring a live transaction must conflict, got %v", err)
+	}
+	if _, err := ledger.RestoreTransaction(9999); !errors.Is(err, errNotFound) {
+		t.Fatalf("restoring a missing transaction must be not found, got %v", err)
+	}
+
+	if err := ledger.DeleteTransaction(mistake.ID); err != nil {
+		t.Fatalf("delete again: %v", err)
+	}
+	if purged, err := ledger.PurgeTrash(time.Now().Add(-trashRetention)); err != nil || purged != 0 {
+		t.Fatalf("fresh trash must survive the retention window: %d %v", purged, err)
+	}
+	if purged, err := ledger.PurgeTrash(time.Now()); err != nil || purged != 1 {
+		t.Fatalf("purge: %d %v", purged, err)
+	}
+	if _, err := ledger.GetTransaction(mistake.ID); !errors.Is(err, errNotFound) {
+		t.Fatalf("purged transaction must be gone, got %v", err)
+	}
+}
+
+func TestDeleteCategoryKeepsTrashedTransactions(t *testing.T) {
+	ledger := newTestLedger(t)
+	food, _ := ledger.CreateCategory("Food")
+	trips, _ := ledger.CreateCategory("Trips")
+
+	day := time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)
+	trashed, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, CategoryID: trips.ID, AmountKopeks: -1_000, OccurredAt: day})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	split, err := ledger.AddTransaction(Transaction{AccountID: defaultAccountID, AmountKopeks: -3_000, OccurredAt: day, Splits: []TransactionSplit{
+		{CategoryID: food.ID, AmountKopeks: -2_000},
+		{CategoryID: trips.ID, AmountKopeks: -1_000},
+	}})
+	if err != nil {
+		t.Fatalf("add split: %v", err)
+	}
+	for _, id := range []int64{trashed.ID, split.ID} {
+		if err := ledger.DeleteTransaction(id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+
+	if err := ledger.DeleteCategory(trips.ID, CategoryDeleteOptions{}); !errors.Is(err, errConflict) {
+		t.Fatalf("category with trashed transactions must not be deleted, got %v", err)
+	}
+	for _, id := range []int64{trashed.ID, split.ID} {
+		if _, err := ledger.RestoreTransaction(id); err != nil {
+			t.Fatalf("trashed transaction %d must stay restorable: %v", id, err)
+		}
+	}
+}
@@ -4,6 +4,11 @@ const api = {
     if (!res.ok) throw new Error("Не удалось получить категории");
     return res.json();
   },
+  async getAccounts() {
+    const res = await fetch("/accounts");
+    if (!res.ok) throw new Error("Не удалось получить счета");
+    return res.json();
+  },
   async getBudgets() {
     const res = await fetch("/budgets");
     if (!res.ok) throw new Error("Не удалось получить бюджеты");
@@ -70,6 +75,7 @@ const api = {
 };
 
 const state = {
+  accounts: [],
   categories: [],
   transactions: [],
   summary: [],
@@ -89,6 +95,7 @@ const els = {
   budgetLimit: document.getElementById("budget-limit"),
   budgetList: document.getElementById("budget-list"),
   txForm: document.getElementById("tx-form"),
+  txAccount: document.getElementById("tx-account"),
   txCategory: document.getElementById("tx-category"),
   txAmount: document.getElementById("tx-amount"),
   txDate: document.getElementById("tx-date"),
@@ -96,6 +103,7 @@ const els = {
   filterFrom: document.getElementById("filter-from"),
   filterTo: document.getElementById("filter-to"),
   filterCategory: document.getElementById("filter-category"),
+  filterAccount: document.getElementById("filter-account"),
   filterApply: document.getElementById("filter-apply"),
   txTableBody: document.querySelector("#tx-table tbody"),
   summaryList: document.getElementById("summary-list"),
@@ -144,6 +152,18 @@ function renderCategories() {
   });
 }
 
+function renderAccounts() {
+  els.txAccount.innerHTML = "";
+  els.filterAccount.innerHTML = `<option value="">Все</option>`;
+  state.accounts.forEach((a) => {
+    const opt = document.createElement("option");
+    opt.value = a.ID ?? a.id;
+    opt.textContent = a.Name ?? a.name;
+    els.txAccount.appendChild(opt);
+    els.filterAccount.appendChild(opt.cloneNode(true));
+  });
+}
+
 function renderTransactions() {
   els.txTableBody.innerHTML = "";
   state.transactions.forEach((tx) => {
@@ -154,6 +174,7 @@ function renderTransactions() {
     const note = tx.note || tx.Note || "";
     tr.dataset.id = tx.id ?? tx.ID;
     tr.dataset.categoryId = tx.category_id ?? tx.CategoryID;
+    tr.dataset.accountId = tx.account_id ?? tx.AccountID;
     tr.dataset.amount = amount;
     tr.dataset.date = date.toISOString().slice(0, 10);
     tr.dataset.note = note;
@@ -171,9 +192,9 @@ function renderSummary() {
   els.summaryList.innerHTML = "";
   state.summary.forEach((s) => {
     const cat = s.category_id ?? s.CategoryID;
-    const income = s.income_rub ?? s.IncomeRub ?? s.income ?? 0;
-    const expense = s.expense_rub ?? s.ExpenseRub ?? s.expense ?? 0;
-    const net = s.net_rub ?? s.NetRub ?? s.net ?? 0;
+    const income = Number(s.income_rub ?? s.IncomeRub ?? s.income ?? 0);
+    const expense = Number(s.expense_rub ?? s.ExpenseRub ?? s.expense ?? 0);
+    const net = Number(s.net_rub ?? s.NetRub ?? s.net ?? 0);
     const count = s.count ?? s.Count ?? 0;
 
     const div = document.createElement("div");
@@ -197,16 +218,23 @@ function renderAlerts() {
     return;
   }
   state.alerts.forEach((a) => {
+    const cur = a.currency === "RUB" || !a.currency ? "₽" : a.currency;
     const div = document.createElement("div");
     div.className = "alert";
     div.innerHTML = `
       <strong>${a.category_name || a.CategoryName || a.category_id}</strong>
-      <div class="muted">Лимит: ${(a.limit_rub ?? a.LimitRub ?? 0).toFixed(2)} ₽ · Потрачено: ${(a.spent_rub ?? a.SpentRub ?? 0).toFixed(2)} ₽ · Превышение: ${(a.exceeded_rub ?? a.ExceededRub ?? 0).toFixed(2)} ₽</div>
+      <div class="muted">Лимит: ${Number(a.limit ?? 0).toFixed(2)} ${cur} · Потрачено: ${Number(a.spent ?? 0).toFixed(2)} ${cur} · ${alertDetail(a, cur)}</div>
     `;
     els.alertsList.appendChild(div);
   });
 }
 
+function alertDetail(a, cur) {
+  if (a.severity === "warning") return `Порог ${a.threshold}% (использовано ${a.used_percent}%)`;
+  if (a.severity === "info") return `Прогноз к концу периода: ${Number(a.forecast ?? 0).toFixed(2)} ${cur}`;
+  return `Превышение: ${Number(a.exceeded ?? 0).toFixed(2)} ${cur}`;
+}
+
 function renderBudgets() {
   if (!els.budgetList) return;
   els.budgetList.innerHTML = "";
@@ -229,6 +257,11 @@ function renderBudgets() {
 
 async function refreshAll() {
   try {
+    const filterAccount = els.filterAccount.value;
+    state.accounts = await api.getAccounts();
+    renderAccounts();
+    els.filterAccount.value = filterAccount;
+
     const cats = await api.getCategories();
     state.categories = cats;
     renderCategories();
@@ -247,7 +280,7 @@ async function refreshAll() {
       api.getSummary(filters),
       api.getAlerts(filters),
     ]);
-    state.transactions = txs;
+    state.transactions = txs.items;
     state.summary = summary;
     state.alerts = alerts;
     renderBudgets();
@@ -265,6 +298,7 @@ function buildFilters() {
   if (els.filterFrom.value) params.from = els.filterFrom.value;
   if (els.filterTo.value) params.to = els.filterTo.value;
   if (els.filterCategory.value) params.category_id = els.filterCategory.value;
+  if (els.filterAccount.value) params.account_id = els.filterAccount.value;
   params.limit = state.pageSize;
   params.offset = state.page * state.pageSize;
   // если даты не указаны, ставим from = 1970-01-01 для предсказуемости
@@ -301,6 +335,7 @@ function wireEvents() {
     const signed = kind === "expense" ? -Math.abs(numeric) : Math.abs(numeric);
 
     const payload = {
+      account_id: Number(els.txAccount.value),
       category_id: Number(els.txCategory.value),
       amount_rub: String(signed),
       occurred_at: els.txDate.value,
@@ -376,6 +411,7 @@ function wireEvents() {
     if (!tr) return;
     state.editingTxId = Number(tr.dataset.id);
     els.txCategory.value = tr.dataset.categoryId;
+    els.txAccount.value = tr.dataset.accountId;
     const amount = Number(tr.dataset.amount);
     const kind = amount >= 0 ? "income" : "expense";
     document.querySelector(`input[name="tx-kind"][value="${kind}"]`).checked = true;